@@ -0,0 +1,169 @@
+// Package routetable provides OpenTelemetry metrics of route table operations.
+package routetable
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// The results of an operation, which are the result attribute of the operation metrics.
+const (
+	ResultOK       = "ok"
+	ResultNotFound = "not_found"
+	ResultNotSame  = "not_same"
+	ResultError    = "error"
+)
+
+// Attribute keys of the route table metrics.
+const (
+	NameKey      = attribute.Key("routetable.name")
+	OperationKey = attribute.Key("routetable.operation")
+	ResultKey    = attribute.Key("routetable.result")
+)
+
+// Metrics holds route table metrics
+type Metrics struct {
+	opDuration    metric.Float64Histogram
+	hits          metric.Int64Counter
+	misses        metric.Int64Counter
+	setNxConflict metric.Int64Counter
+	notSame       metric.Int64Counter
+}
+
+// MetricsConfig holds configuration for route table metrics
+type MetricsConfig struct {
+	MeterProvider metric.MeterProvider
+	MeterName     string
+	Namespace     string
+}
+
+// DefaultMetricsConfig returns default metrics configuration
+func DefaultMetricsConfig() *MetricsConfig {
+	return &MetricsConfig{
+		MeterProvider: otel.GetMeterProvider(),
+		MeterName:     "routetable",
+		Namespace:     "routetable",
+	}
+}
+
+// NewMetrics creates route table metrics
+func NewMetrics(config *MetricsConfig) (*Metrics, error) {
+	if config == nil {
+		config = DefaultMetricsConfig()
+	}
+
+	meter := config.MeterProvider.Meter(config.MeterName)
+
+	opDuration, err := meter.Float64Histogram(
+		config.Namespace+".operation.duration",
+		metric.WithDescription("Duration of route table operations"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize operation duration")
+	}
+
+	hits, err := meter.Int64Counter(
+		config.Namespace+".lookups.hits",
+		metric.WithDescription("Number of route lookups that found a routing entry"),
+		metric.WithUnit("lookups"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize lookup hits")
+	}
+
+	misses, err := meter.Int64Counter(
+		config.Namespace+".lookups.misses",
+		metric.WithDescription("Number of route lookups that found no routing entry"),
+		metric.WithUnit("lookups"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize lookup misses")
+	}
+
+	setNxConflict, err := meter.Int64Counter(
+		config.Namespace+".setnx.conflicts",
+		metric.WithDescription("Number of SetNx operations that found an existing routing entry"),
+		metric.WithUnit("operations"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize setnx conflicts")
+	}
+
+	notSame, err := meter.Int64Counter(
+		config.Namespace+".value_not_same",
+		metric.WithDescription("Number of conditional operations rejected because the routing entry has changed"),
+		metric.WithUnit("operations"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize value not same")
+	}
+
+	return &Metrics{
+		opDuration:    opDuration,
+		hits:          hits,
+		misses:        misses,
+		setNxConflict: setNxConflict,
+		notSame:       notSame,
+	}, nil
+}
+
+// Result classifies the error of an operation.
+func Result(err error) string {
+	switch {
+	case err == nil:
+		return ResultOK
+	case errors.Is(err, xerrors.ErrRouteTableNotFound):
+		return ResultNotFound
+	case errors.Is(err, xerrors.ErrRouteTableValueNotSame):
+		return ResultNotSame
+	default:
+		return ResultError
+	}
+}
+
+// RecordOperation records the duration of an operation of the route table name started at start,
+// and counts err if it is ErrRouteTableValueNotSame.
+func (m *Metrics) RecordOperation(ctx context.Context, name, op string, start time.Time, err error) {
+	result := Result(err)
+
+	m.opDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		NameKey.String(name), OperationKey.String(op), ResultKey.String(result)))
+
+	if result == ResultNotSame {
+		m.RecordNotSame(ctx, name, op, 1)
+	}
+}
+
+// RecordLookups counts the hits and misses of route lookups.
+func (m *Metrics) RecordLookups(ctx context.Context, name string, hits, misses int64) {
+	attrs := metric.WithAttributes(NameKey.String(name))
+
+	if hits > 0 {
+		m.hits.Add(ctx, hits, attrs)
+	}
+
+	if misses > 0 {
+		m.misses.Add(ctx, misses, attrs)
+	}
+}
+
+// RecordSetNxConflicts counts the SetNx operations that found an existing routing entry.
+func (m *Metrics) RecordSetNxConflicts(ctx context.Context, name string, n int64) {
+	if n > 0 {
+		m.setNxConflict.Add(ctx, n, metric.WithAttributes(NameKey.String(name)))
+	}
+}
+
+// RecordNotSame counts the conditional operations rejected with ErrRouteTableValueNotSame.
+func (m *Metrics) RecordNotSame(ctx context.Context, name, op string, n int64) {
+	if n > 0 {
+		m.notSame.Add(ctx, n, metric.WithAttributes(NameKey.String(name), OperationKey.String(op)))
+	}
+}
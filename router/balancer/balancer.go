@@ -3,6 +3,7 @@ package balancer
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/selector"
@@ -14,25 +15,43 @@ import (
 
 var _ selector.Balancer = (*weightBalancer)(nil)
 
-// weightBalancer is a weighted round-robin load balancer that supports route tables.
+// weightBalancer is a load balancer that supports route tables. The nodes of new oids are selected
+// with its Strategy, weighted round-robin by default.
 type weightBalancer struct {
 	mu sync.Mutex
 
 	balancerType  Type
 	currentWeight map[string]float64
 	routeTable    routetable.ReadOnlyRouteTable
+	colorFallback ColorFallback
+
+	takeoverGrace time.Duration
+	takeoverHook  TakeoverHook
+	missing       *missingAddrs
+
+	strategy Strategy
+	loads    *loads
+	reports  *reports
+
+	zoneAffinity *zoneAffinity
 }
 
-func newWeightBalancer(balancerType Type, routeTable routetable.ReadOnlyRouteTable) selector.Balancer {
+func newWeightBalancer(o options, s *balancerState) selector.Balancer {
 	return &weightBalancer{
-		balancerType:  balancerType,
+		balancerType:  o.balancerType,
 		currentWeight: make(map[string]float64),
-		routeTable:    routeTable,
+		routeTable:    o.routeTable,
+		colorFallback: o.colorFallback,
+		takeoverGrace: o.takeoverGrace,
+		takeoverHook:  o.takeoverHook,
+		missing:       s.missing,
+		strategy:      o.strategy,
+		loads:         s.loads,
+		reports:       s.reports,
+		zoneAffinity:  o.zoneAffinity,
 	}
 }
 
-var emptyDoneFunc = func(ctx context.Context, di selector.DoneInfo) {}
-
 // Pick is pick a weighted node
 func (p *weightBalancer) Pick(ctx context.Context, nodes []selector.WeightedNode) (selector.WeightedNode, selector.DoneFunc, error) {
 	if len(nodes) == 0 {
@@ -44,7 +63,9 @@ func (p *weightBalancer) Pick(ctx context.Context, nodes []selector.WeightedNode
 		return nil, nil, err
 	}
 
-	color := xcontext.ColorFromOutgoingContext(ctx)
+	// the routing entries are kept under the color of the nodes serving the request,
+	// which is a fallback of the requested color if the service is not deployed in it
+	color := pickColor(p.colorFallback, xcontext.ColorFromOutgoingContext(ctx), nodes)
 
 	// select node by oid from routeTable
 	addr, err := p.routeTable.Get(ctx, color, oid)
@@ -52,20 +73,18 @@ func (p *weightBalancer) Pick(ctx context.Context, nodes []selector.WeightedNode
 		return nil, nil, err
 	}
 
-	for _, node := range nodes {
-		if node.Address() == addr {
-			return node, emptyDoneFunc, nil
-		}
+	if node := findNode(nodes, addr); node != nil {
+		return node, p.done(node), nil
 	}
 
-	selected := p.weightSelect(nodes)
+	selected := p.selectNode(ctx, color, nodes)
 	if selected == nil {
 		return nil, nil, errors.New("the selected node is nil")
 	}
 
 	// the select action is done, return the selected node if the balancer type is not master
 	if p.balancerType != TypeMaster {
-		return selected, selected.Pick(), nil
+		return selected, p.done(selected), nil
 	}
 
 	mrt, ok := p.routeTable.(routetable.MasterRouteTable)
@@ -73,30 +92,38 @@ func (p *weightBalancer) Pick(ctx context.Context, nodes []selector.WeightedNode
 		return nil, nil, errors.New("the route table is not a RouteTable")
 	}
 
+	// the route points to a node that has disappeared
+	if addr != "" {
+		return p.takeover(ctx, mrt, color, oid, addr, selected, nodes)
+	}
+
 	// update route table if the balancer type is master
 	// the route table may be set by other connections at the same time, so we need to judge it with SetNx before setting
-	ok, addr, err = mrt.SetNxOrGet(ctx, color, oid, selected.Address())
+	ok, cur, err := mrt.SetNxOrGetEntry(ctx, color, oid, routetable.RouteEntry{
+		Addr:    selected.Address(),
+		Version: selected.Version(),
+	})
 	if err != nil {
 		return nil, nil, err
 	}
 
+	addr = cur.Addr
+
 	if ok {
 		// the route table is set by this balancer
-		return selected, selected.Pick(), nil
+		return selected, p.done(selected), nil
 	}
 
 	log.Warnf("routeTable is set by other balancers. oid=%d color=%s old-addr=%s new-addr=%s", oid, color, addr, selected.Address())
 
-	for _, node := range nodes {
-		if node.Address() == addr {
-			return node, node.Pick(), nil
-		}
+	if node := findNode(nodes, addr); node != nil {
+		return node, p.done(node), nil
 	}
 
-	return nil, nil, errors.Errorf("the existed address in routeTable is not found. addr=%s", addr)
+	return p.takeover(ctx, mrt, color, oid, addr, selected, nodes)
 }
 
-// weightSelect select a new node by weight from nodes
+// weightSelect select a new node by the effective weight from nodes
 // the algorithm is the implement of nginx wrr, copied from https://github.com/go-kratos/kratos/blob/main/selector/wrr/wrr.go
 func (p *weightBalancer) weightSelect(nodes []selector.WeightedNode) selector.WeightedNode {
 	var (
@@ -105,13 +132,16 @@ func (p *weightBalancer) weightSelect(nodes []selector.WeightedNode) selector.We
 		selectWeight float64
 	)
 
+	now := time.Now()
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	for _, node := range nodes {
-		totalWeight += node.Weight()
+		w := p.weight(node, now)
+		totalWeight += w
 		cwt := p.currentWeight[node.Address()]
-		cwt += node.Weight()
+		cwt += w
 		p.currentWeight[node.Address()] = cwt
 
 		if selected == nil || selectWeight < cwt {
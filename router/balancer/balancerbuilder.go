@@ -1,6 +1,8 @@
 package balancer
 
 import (
+	"time"
+
 	"github.com/go-kratos/kratos/v2/selector"
 	"github.com/go-kratos/kratos/v2/selector/node/direct"
 	"github.com/go-pantheon/fabrica-kit/router/routetable"
@@ -10,8 +12,14 @@ import (
 type Option func(o *options)
 
 type options struct {
-	balancerType Type
-	routeTable   routetable.ReadOnlyRouteTable
+	balancerType  Type
+	routeTable    routetable.ReadOnlyRouteTable
+	takeoverGrace time.Duration
+	takeoverHook  TakeoverHook
+	strategy      Strategy
+	loadScore     LoadScore
+	zoneAffinity  *zoneAffinity
+	colorFallback ColorFallback
 }
 
 // WithRouteTable sets the route table for the balancer.
@@ -32,27 +40,49 @@ var _ selector.BalancerBuilder = (*balancerBuilder)(nil)
 
 // balancerBuilder is a selector builder for creating weighted round-robin balancers.
 type balancerBuilder struct {
-	balancerType Type
-	routeTable   routetable.ReadOnlyRouteTable
+	options options
+	state   *balancerState
 }
 
-// newBalancerBuilder returns a selector builder with wrr balancer
-func newBalancerBuilder(opts ...Option) selector.Builder {
-	var option options
+// balancerState is the state of the nodes shared by the balancers of a builder, keyed by node address.
+// Kratos builds a new balancer whenever the nodes change, so the state must outlive the balancers.
+type balancerState struct {
+	loads   *loads
+	reports *reports
+	missing *missingAddrs
+}
+
+func newBalancerState(o options) *balancerState {
+	return &balancerState{
+		loads:   newLoads(),
+		reports: newReports(o.loadScore),
+		missing: newMissingAddrs(),
+	}
+}
+
+// newOptions returns the default options configured by opts.
+func newOptions(opts ...Option) options {
+	option := options{takeoverGrace: defaultTakeoverGrace, strategy: StrategyWeight}
 	for _, opt := range opts {
 		opt(&option)
 	}
 
+	return option
+}
+
+// newBalancerBuilder returns a selector builder with wrr balancer
+func newBalancerBuilder(option options) selector.Builder {
 	return &selector.DefaultBuilder{
-		Balancer: &balancerBuilder{
-			balancerType: option.balancerType,
-			routeTable:   option.routeTable,
-		},
-		Node: &direct.Builder{},
+		Balancer: &balancerBuilder{options: option, state: newBalancerState(option)},
+		Node:     &direct.Builder{},
 	}
 }
 
 // Build creates a new balancer instance.
 func (b *balancerBuilder) Build() selector.Balancer {
-	return newWeightBalancer(b.balancerType, b.routeTable)
+	if b.options.balancerType == TypeHash {
+		return newHashBalancer()
+	}
+
+	return newWeightBalancer(b.options, b.state)
 }
@@ -0,0 +1,112 @@
+package balancer
+
+import (
+	"maps"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-pantheon/fabrica-kit/profile"
+	"github.com/go-pantheon/fabrica-util/errors"
+)
+
+// AnyColor is the key of a ColorFallback entry that applies to every color without an entry of its own.
+const AnyColor = "*"
+
+// ColorFallback maps a color to the color a request falls back to when the target service
+// has no nodes of it. A chain such as feature-x -> dev -> base lets a color be deployed only
+// for the services it changes, while the requests to the others are served by dev or base nodes.
+type ColorFallback map[string]string
+
+// WithColorFallback makes the balancer and the node filter of NewFilter serve the requests
+// with the nodes of the first color of the fallback chain of their color that has any.
+// The routes are kept under the color of the serving nodes. Without it, colors match exactly.
+func WithColorFallback(f ColorFallback) Option {
+	return func(o *options) {
+		if len(f) == 0 {
+			o.colorFallback = nil
+			return
+		}
+
+		o.colorFallback = maps.Clone(f)
+	}
+}
+
+// ParseColorFallback parses a comma-separated list of chains, each a list of colors separated by ->,
+// such as "feature-x -> dev -> base, * -> base". The same color must not fall back to different colors.
+func ParseColorFallback(spec string) (ColorFallback, error) {
+	f := make(ColorFallback)
+
+	for chain := range strings.SplitSeq(spec, ",") {
+		if strings.TrimSpace(chain) == "" {
+			continue
+		}
+
+		colors := strings.Split(chain, "->")
+		if len(colors) < 2 {
+			return nil, errors.Errorf("color fallback chain has no fallback. chain=%s", chain)
+		}
+
+		for i := range colors {
+			colors[i] = strings.TrimSpace(colors[i])
+			if colors[i] == "" {
+				return nil, errors.Errorf("color fallback chain has an empty color. chain=%s", chain)
+			}
+		}
+
+		for i, c := range colors[:len(colors)-1] {
+			next := colors[i+1]
+			if next == AnyColor {
+				return nil, errors.Errorf("color fallback cannot fall back to %s. chain=%s", AnyColor, chain)
+			}
+
+			if old, ok := f[c]; ok && old != next {
+				return nil, errors.Errorf("color fallback of %s is both %s and %s", c, old, next)
+			}
+
+			f[c] = next
+		}
+	}
+
+	return f, nil
+}
+
+// Chain returns color followed by the colors it falls back to in order. A cycle ends the chain.
+func (f ColorFallback) Chain(color string) []string {
+	chain := []string{color}
+
+	for c := color; ; {
+		next, ok := f[c]
+		if !ok {
+			if next, ok = f[AnyColor]; !ok {
+				return chain
+			}
+		}
+
+		for _, seen := range chain {
+			if seen == next {
+				return chain
+			}
+		}
+
+		chain = append(chain, next)
+		c = next
+	}
+}
+
+// pickColor returns the first color of the fallback chain of color that is carried by any of nodes,
+// or color itself if there is none.
+func pickColor[N selector.Node](f ColorFallback, color string, nodes []N) string {
+	if len(f) == 0 {
+		return color
+	}
+
+	for _, c := range f.Chain(color) {
+		for _, n := range nodes {
+			if n.Metadata()[profile.ColorKey] == c {
+				return c
+			}
+		}
+	}
+
+	return color
+}
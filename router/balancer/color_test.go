@@ -0,0 +1,105 @@
+package balancer
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-kratos/kratos/v2/selector/node/direct"
+	"github.com/go-pantheon/fabrica-kit/profile"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/memory"
+	"github.com/go-pantheon/fabrica-kit/xcontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	grpcmd "google.golang.org/grpc/metadata"
+)
+
+func newTestNode(addr, color string) selector.Node {
+	return selector.NewNode("grpc", addr, &registry.ServiceInstance{
+		Metadata: map[string]string{profile.ColorKey: color},
+	})
+}
+
+func outgoing(color string, oid int64) context.Context {
+	return grpcmd.AppendToOutgoingContext(context.Background(),
+		xcontext.CtxColor, color, xcontext.CtxOID, strconv.FormatInt(oid, 10))
+}
+
+func TestParseColorFallback(t *testing.T) {
+	t.Parallel()
+
+	f, err := ParseColorFallback("feature-x -> dev -> base, feature-y->dev, * -> base")
+	require.NoError(t, err)
+	assert.Equal(t, ColorFallback{"feature-x": "dev", "feature-y": "dev", "dev": "base", "*": "base"}, f)
+
+	assert.Equal(t, []string{"feature-x", "dev", "base"}, f.Chain("feature-x"))
+	assert.Equal(t, []string{"other", "base"}, f.Chain("other"))
+	assert.Equal(t, []string{"base"}, f.Chain("base"))
+
+	for _, spec := range []string{"dev", "dev -> ", "dev -> base, dev -> prod", "dev -> *"} {
+		_, err := ParseColorFallback(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestColorFallbackCycle(t *testing.T) {
+	t.Parallel()
+
+	f := ColorFallback{"a": "b", "b": "a"}
+	assert.Equal(t, []string{"a", "b"}, f.Chain("a"))
+}
+
+func TestFilterColorFallback(t *testing.T) {
+	t.Parallel()
+
+	f := ColorFallback{"feature-x": "dev", "dev": "base"}
+	filter := NewFilter(WithStrategy(StrategyP2C), WithColorFallback(f))
+
+	nodes := []selector.Node{
+		newTestNode("10.0.0.1:9000", "base"),
+		newTestNode("10.0.0.2:9000", "dev"),
+		newTestNode("10.0.0.3:9000", "dev"),
+	}
+
+	got := filter(outgoing("feature-x", 1), nodes)
+	require.Len(t, got, 2)
+	assert.Equal(t, "10.0.0.2:9000", got[0].Address())
+
+	got = filter(outgoing("base", 1), nodes)
+	require.Len(t, got, 1)
+	assert.Equal(t, "10.0.0.1:9000", got[0].Address())
+
+	// exact matching without a fallback
+	assert.Empty(t, NewFilter()(outgoing("feature-x", 1), nodes))
+
+	// the fallback is copied
+	f["feature-x"] = "base"
+	got = filter(outgoing("feature-x", 1), nodes)
+	require.Len(t, got, 2)
+}
+
+func TestBalancerColorFallback(t *testing.T) {
+	t.Parallel()
+
+	mem := memory.New()
+	t.Cleanup(func() { _ = mem.Close() })
+
+	rt := routetable.NewMasterRouteTable(mem, "test")
+	o := newOptions(WithBalancerType(TypeMaster), WithRouteTable(rt), WithColorFallback(ColorFallback{"feature-x": "dev"}))
+	b := newWeightBalancer(o, newBalancerState(o)).(*weightBalancer)
+
+	builder := &direct.Builder{}
+	nodes := []selector.WeightedNode{builder.Build(newTestNode("10.0.0.2:9000", "dev"))}
+
+	selected, _, err := b.Pick(outgoing("feature-x", 1), nodes)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2:9000", selected.Address())
+
+	// the route is kept under the color of the serving nodes
+	addr, err := rt.Get(context.Background(), "dev", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2:9000", addr)
+}
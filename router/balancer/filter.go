@@ -9,13 +9,18 @@ import (
 )
 
 // NewFilter creates a node filter that filters nodes based on color.
-// It returns a selector.NodeFilter that selects nodes matching the color from context.
-func NewFilter() selector.NodeFilter {
+// It returns a selector.NodeFilter that selects nodes matching the color from context,
+// or the first color of its fallback chain that has nodes, see WithColorFallback.
+// The options other than WithColorFallback are ignored, so the options of the balancer can be passed as is.
+func NewFilter(opts ...Option) selector.NodeFilter {
+	fallback := newOptions(opts...).colorFallback
+
 	return func(ctx context.Context, nodes []selector.Node) []selector.Node {
+		color := pickColor(fallback, xcontext.ColorFromOutgoingContext(ctx), nodes)
 		newNodes := make([]selector.Node, 0, len(nodes))
 
 		for _, n := range nodes {
-			if n.Metadata()[profile.ColorKey] == xcontext.ColorFromOutgoingContext(ctx) {
+			if n.Metadata()[profile.ColorKey] == color {
 				newNodes = append(newNodes, n)
 			}
 		}
@@ -0,0 +1,86 @@
+package balancer
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-pantheon/fabrica-kit/xcontext"
+)
+
+var _ selector.Balancer = (*hashBalancer)(nil)
+
+// hashBalancer maps the oid of a request onto the nodes with weighted rendezvous hashing.
+// Every node scores every oid, and the highest score wins, so a node joining or leaving only
+// moves the oids it wins or won, and a node wins a share of the oids proportional to its weight.
+// It keeps no state and needs no route table.
+type hashBalancer struct{}
+
+func newHashBalancer() selector.Balancer {
+	return &hashBalancer{}
+}
+
+// Pick picks the node with the highest rendezvous score for the oid of the request.
+func (p *hashBalancer) Pick(ctx context.Context, nodes []selector.WeightedNode) (selector.WeightedNode, selector.DoneFunc, error) {
+	if len(nodes) == 0 {
+		return nil, nil, selector.ErrNoAvailable
+	}
+
+	oid, err := xcontext.OIDFromOutgoingContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selected := rendezvous(nodes, oid)
+	if selected == nil {
+		return nil, nil, selector.ErrNoAvailable
+	}
+
+	return selected, selected.Pick(), nil
+}
+
+// rendezvous returns the node with the highest weighted score for oid, which is -weight/ln(u)
+// for a uniform u in (0, 1) derived from the address of the node and oid. Nodes without weight are skipped.
+func rendezvous(nodes []selector.WeightedNode, oid int64) selector.WeightedNode {
+	var (
+		selected selector.WeightedNode
+		best     = math.Inf(-1)
+	)
+
+	for _, node := range nodes {
+		w := node.Weight()
+		if w <= 0 {
+			continue
+		}
+
+		h := mix64(hashAddr(node.Address()) ^ uint64(oid))
+		// the top 53 bits as a float in (0, 1)
+		u := (float64(h>>11) + 0.5) / (1 << 53)
+
+		if score := -w / math.Log(u); score > best {
+			best = score
+			selected = node
+		}
+	}
+
+	return selected
+}
+
+func hashAddr(addr string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(addr))
+
+	return h.Sum64()
+}
+
+// mix64 is the finalizer of SplitMix64, which spreads the bits of a hash combined with the oid.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return x
+}
@@ -0,0 +1,88 @@
+package balancer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-kratos/kratos/v2/selector/node/direct"
+	"github.com/go-pantheon/fabrica-kit/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWeightedNodes(n int) []selector.WeightedNode {
+	builder := &direct.Builder{}
+	nodes := make([]selector.WeightedNode, 0, n)
+
+	for i := range n {
+		nodes = append(nodes, builder.Build(newTestNode(fmt.Sprintf("10.0.0.%d:9000", i+1), "blue")))
+	}
+
+	return nodes
+}
+
+func TestHashBalancerStable(t *testing.T) {
+	t.Parallel()
+
+	b := newHashBalancer()
+	nodes := newTestWeightedNodes(5)
+
+	for oid := range int64(100) {
+		first, done, err := b.Pick(outgoing("blue", oid), nodes)
+		require.NoError(t, err)
+		done(t.Context(), selector.DoneInfo{})
+
+		// the order of the nodes does not matter
+		reversed := make([]selector.WeightedNode, len(nodes))
+		for i, n := range nodes {
+			reversed[len(nodes)-1-i] = n
+		}
+
+		second, _, err := b.Pick(outgoing("blue", oid), reversed)
+		require.NoError(t, err)
+		assert.Equal(t, first.Address(), second.Address())
+	}
+
+	_, _, err := b.Pick(outgoing("blue", 1), nil)
+	require.ErrorIs(t, err, selector.ErrNoAvailable)
+}
+
+func TestHashBalancerMinimalMovement(t *testing.T) {
+	t.Parallel()
+
+	nodes := newTestWeightedNodes(5)
+	removed := nodes[2].Address()
+	rest := append(append([]selector.WeightedNode{}, nodes[:2]...), nodes[3:]...)
+
+	for oid := range int64(1000) {
+		before := rendezvous(nodes, oid).Address()
+		after := rendezvous(rest, oid).Address()
+
+		if before != removed {
+			assert.Equal(t, before, after, "oid=%d", oid)
+		}
+	}
+}
+
+func TestHashBalancerWeight(t *testing.T) {
+	t.Parallel()
+
+	builder := &direct.Builder{}
+	nodes := []selector.WeightedNode{
+		builder.Build(selector.NewNode("grpc", "10.0.0.1:9000", &registry.ServiceInstance{
+			Metadata: map[string]string{profile.ColorKey: "blue", "weight": "300"},
+		})),
+		builder.Build(selector.NewNode("grpc", "10.0.0.2:9000", &registry.ServiceInstance{
+			Metadata: map[string]string{profile.ColorKey: "blue", "weight": "100"},
+		})),
+	}
+
+	counts := make(map[string]int)
+	for oid := range int64(10000) {
+		counts[rendezvous(nodes, oid).Address()]++
+	}
+
+	assert.InDelta(t, 7500, counts["10.0.0.1:9000"], 400)
+}
@@ -0,0 +1,208 @@
+package balancer
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+)
+
+// Strategy selects the node of an oid that has no route yet.
+type Strategy string
+
+const (
+	// StrategyWeight is the default strategy, weighted round-robin on the node weights adjusted by their load reports.
+	StrategyWeight Strategy = "weight"
+	// StrategyP2C picks the less loaded of two random nodes, where the load is the EWMA latency
+	// multiplied by the in-flight requests of the node, divided by its weight.
+	StrategyP2C Strategy = "p2c"
+	// StrategyLeastRoutes picks the one of two random nodes that owns fewer routes relative to its weight.
+	// It requires a master route table with an AddrIndex, and falls back to StrategyWeight otherwise.
+	StrategyLeastRoutes Strategy = "least-routes"
+)
+
+const (
+	// loadDecay is the time constant of the EWMA latency of a node.
+	loadDecay = 10 * time.Second
+	// errorPenalty is the latency recorded for a request that failed.
+	errorPenalty = time.Second
+	// loadExpiry is how long a node without requests in flight keeps its load after its last request.
+	loadExpiry = 10 * loadDecay
+)
+
+// WithStrategy sets the strategy the balancer uses to select the node of an oid that has no route yet.
+// The routed requests are always sent to the node of their route.
+func WithStrategy(s Strategy) Option {
+	return func(o *options) {
+		o.strategy = s
+	}
+}
+
+// nodeLoad is the load of a node, fed by the DoneInfo of the requests sent to it.
+type nodeLoad struct {
+	inflight int64
+	lag      float64 // EWMA latency in nanoseconds
+	stamp    time.Time
+}
+
+// loads tracks the load of the nodes by address.
+type loads struct {
+	mu     sync.Mutex
+	nodes  map[string]*nodeLoad
+	pruned time.Time
+}
+
+func newLoads() *loads {
+	return &loads{nodes: make(map[string]*nodeLoad)}
+}
+
+// start records a request sent to addr. The returned DoneFunc records its completion and then calls done.
+func (l *loads) start(addr string, done selector.DoneFunc) selector.DoneFunc {
+	start := time.Now()
+
+	l.mu.Lock()
+	nl, ok := l.nodes[addr]
+	if !ok {
+		nl = &nodeLoad{stamp: start}
+		l.nodes[addr] = nl
+	}
+	nl.inflight++
+	l.mu.Unlock()
+
+	return func(ctx context.Context, di selector.DoneInfo) {
+		now := time.Now()
+		rtt := now.Sub(start)
+
+		if di.Err != nil {
+			rtt = max(rtt, errorPenalty)
+		}
+
+		l.mu.Lock()
+		nl.inflight--
+
+		w := math.Exp(-float64(now.Sub(nl.stamp)) / float64(loadDecay))
+		nl.lag = nl.lag*w + float64(rtt)*(1-w)
+		nl.stamp = now
+		l.mu.Unlock()
+
+		if done != nil {
+			done(ctx, di)
+		}
+	}
+}
+
+// score returns the load of addr. A node that has not been used yet has no load.
+func (l *loads) score(addr string) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	nl, ok := l.nodes[addr]
+	if !ok {
+		return 0
+	}
+
+	return (nl.lag + 1) * float64(nl.inflight+1)
+}
+
+// prune forgets the nodes without requests in flight since loadExpiry, at most once per loadDecay.
+// The nodes are not pruned by the nodes of a pick, which are filtered by color and shared by several balancers.
+func (l *loads) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.pruned) < loadDecay {
+		return
+	}
+
+	l.pruned = now
+
+	for addr, nl := range l.nodes {
+		if nl.inflight == 0 && now.Sub(nl.stamp) > loadExpiry {
+			delete(l.nodes, addr)
+		}
+	}
+}
+
+// done returns the DoneFunc of a request sent to node, which feeds the load of the node and its load reports.
+func (p *weightBalancer) done(node selector.WeightedNode) selector.DoneFunc {
+	addr := node.Address()
+	nodeDone := node.Pick()
+
+	return p.loads.start(addr, func(ctx context.Context, di selector.DoneInfo) {
+		p.reports.ingest(addr, di.ReplyMD, time.Now())
+		nodeDone(ctx, di)
+	})
+}
+
+// selectNode selects the node of an oid that has no route yet with the strategy of the balancer,
+// among the nodes of its zone if it has zone affinity.
+func (p *weightBalancer) selectNode(ctx context.Context, color string, nodes []selector.WeightedNode) selector.WeightedNode {
+	now := time.Now()
+	p.loads.prune(now)
+	p.reports.prune(now)
+
+	nodes = p.zoneNodes(nodes)
+
+	if len(nodes) < 2 {
+		return p.weightSelect(nodes)
+	}
+
+	switch p.strategy {
+	case StrategyP2C:
+		return p.p2cSelect(nodes, func(n selector.WeightedNode) (float64, error) {
+			return p.loads.score(n.Address()), nil
+		})
+	case StrategyLeastRoutes:
+		mrt, ok := p.routeTable.(routetable.MasterRouteTable)
+		if !ok {
+			return p.weightSelect(nodes)
+		}
+
+		return p.p2cSelect(nodes, func(n selector.WeightedNode) (float64, error) {
+			count, err := mrt.CountByAddr(ctx, color, n.Address())
+			return float64(count), err
+		})
+	default:
+		return p.weightSelect(nodes)
+	}
+}
+
+// p2cSelect picks two random nodes and returns the one with the lower load relative to its effective weight.
+// It falls back to weightSelect if the load of either cannot be measured.
+func (p *weightBalancer) p2cSelect(nodes []selector.WeightedNode, load func(selector.WeightedNode) (float64, error)) selector.WeightedNode {
+	i := rand.IntN(len(nodes))
+	j := rand.IntN(len(nodes) - 1)
+
+	if j >= i {
+		j++
+	}
+
+	a, b := nodes[i], nodes[j]
+
+	la, err := load(a)
+	if err != nil {
+		log.Warnf("node load is unavailable, fall back to weighted round-robin. strategy=%s addr=%s err=%+v", p.strategy, a.Address(), err)
+		return p.weightSelect(nodes)
+	}
+
+	lb, err := load(b)
+	if err != nil {
+		log.Warnf("node load is unavailable, fall back to weighted round-robin. strategy=%s addr=%s err=%+v", p.strategy, b.Address(), err)
+		return p.weightSelect(nodes)
+	}
+
+	now := time.Now()
+	wa := max(p.weight(a, now), math.SmallestNonzeroFloat64)
+	wb := max(p.weight(b, now), math.SmallestNonzeroFloat64)
+
+	if la*wb <= lb*wa {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,130 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-kratos/kratos/v2/selector/node/direct"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadsFeedback(t *testing.T) {
+	t.Parallel()
+
+	l := newLoads()
+	assert.Zero(t, l.score("10.0.0.1:9000"))
+
+	called := false
+	done := l.start("10.0.0.1:9000", func(context.Context, selector.DoneInfo) { called = true })
+
+	busy := l.score("10.0.0.1:9000")
+	assert.Greater(t, busy, l.score("10.0.0.2:9000"))
+
+	// a failed request is recorded with the error penalty
+	time.Sleep(time.Millisecond)
+	done(context.Background(), selector.DoneInfo{Err: errors.New("unavailable")})
+	assert.True(t, called)
+	assert.Greater(t, l.score("10.0.0.1:9000"), float64(1))
+	assert.Less(t, l.score("10.0.0.1:9000"), float64(errorPenalty))
+
+	// a node is forgotten once idle for the expiry, but not while requests are in flight
+	l.start("10.0.0.2:9000", nil)
+	l.prune(time.Now().Add(loadExpiry + time.Second))
+	assert.Zero(t, l.score("10.0.0.1:9000"))
+	assert.Greater(t, l.score("10.0.0.2:9000"), float64(1))
+}
+
+func TestBalancerBuilderLoads(t *testing.T) {
+	t.Parallel()
+
+	mem := memory.New()
+	t.Cleanup(func() { _ = mem.Close() })
+
+	o := newOptions(WithBalancerType(TypeMaster), WithRouteTable(routetable.NewMasterRouteTable(mem, "test")), WithStrategy(StrategyP2C))
+	builder := &balancerBuilder{options: o, state: newBalancerState(o)}
+	nodes := newTestWeightedNodes(2)
+
+	// saturate the first node through a balancer that is then rebuilt on a change of the nodes
+	b := builder.Build().(*weightBalancer)
+	for range 10 {
+		b.done(nodes[0])
+	}
+
+	b = builder.Build().(*weightBalancer)
+
+	selected, _, err := b.Pick(outgoing("blue", 1), nodes)
+	require.NoError(t, err)
+	assert.Equal(t, nodes[1].Address(), selected.Address())
+}
+
+func TestBalancerStrategyP2C(t *testing.T) {
+	t.Parallel()
+
+	b, _ := newTestMasterBalancer(t, WithStrategy(StrategyP2C))
+	nodes := newTestWeightedNodes(2)
+
+	// saturate the first node
+	for range 10 {
+		b.done(nodes[0])
+	}
+
+	for oid := range int64(20) {
+		selected, done, err := b.Pick(outgoing("blue", oid), nodes)
+		require.NoError(t, err)
+		assert.Equal(t, nodes[1].Address(), selected.Address())
+		done(context.Background(), selector.DoneInfo{})
+	}
+}
+
+func TestBalancerStrategyLeastRoutes(t *testing.T) {
+	t.Parallel()
+
+	mem := memory.New(memory.WithAddrIndex(routetable.LegacyKeyCodec))
+	t.Cleanup(func() { _ = mem.Close() })
+
+	rt := routetable.NewMasterRouteTable(mem, "test", routetable.WithAddrIndex(mem.AddrIndex()))
+	o := options{balancerType: TypeMaster, routeTable: rt, strategy: StrategyLeastRoutes}
+	b := newWeightBalancer(o, newBalancerState(o)).(*weightBalancer)
+
+	nodes := newTestWeightedNodes(2)
+
+	_, err := rt.BatchSet(context.Background(), "blue", []int64{100, 101, 102}, nodes[0].Address())
+	require.NoError(t, err)
+
+	selected, _, err := b.Pick(outgoing("blue", 1), nodes)
+	require.NoError(t, err)
+	assert.Equal(t, nodes[1].Address(), selected.Address())
+
+	// without an AddrIndex the counts are unavailable and the balancer falls back to weighted round-robin
+	b2, _ := newTestMasterBalancer(t, WithStrategy(StrategyLeastRoutes))
+	_, _, err = b2.Pick(outgoing("blue", 1), nodes)
+	require.NoError(t, err)
+}
+
+func TestP2CSelectWeight(t *testing.T) {
+	t.Parallel()
+
+	o := options{strategy: StrategyP2C}
+	b := newWeightBalancer(o, newBalancerState(o)).(*weightBalancer)
+	builder := &direct.Builder{}
+	nodes := []selector.WeightedNode{
+		builder.Build(newTestNode("10.0.0.1:9000", "blue")),
+		builder.Build(newTestNode("10.0.0.2:9000", "blue")),
+	}
+
+	// equal loads pick either node, a lower load relative to weight wins
+	selected := b.p2cSelect(nodes, func(n selector.WeightedNode) (float64, error) {
+		if n.Address() == "10.0.0.1:9000" {
+			return 2, nil
+		}
+
+		return 1, nil
+	})
+	assert.Equal(t, "10.0.0.2:9000", selected.Address())
+}
@@ -1,10 +1,15 @@
 package balancer
 
 import (
-	"sync/atomic"
+	"maps"
+	"reflect"
+	"strings"
+	"sync"
 
+	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/selector"
 	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-util/errors"
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
 )
@@ -17,42 +22,146 @@ const (
 	TypeMaster Type = "master"
 	// TypeReader is the balancer type for reader nodes.
 	TypeReader Type = "reader"
+	// TypeHash is the balancer type for nodes sharded by oid with consistent hashing, without a route table.
+	TypeHash Type = "hash"
 )
 
 var (
-	// readerBalancerBuilderRegistered indicates whether the reader balancer has been registered.
-	readerBalancerBuilderRegistered atomic.Bool
-	// masterBalancerBuilderRegistered indicates whether the master balancer has been registered.
-	masterBalancerBuilderRegistered atomic.Bool
+	registeredMu sync.Mutex
+	// registered maps the names of the registered balancers to their options.
+	registered = make(map[string]options)
 )
 
-// RegisterMasterBalancer registers a balancer for master nodes.
-// It uses the provided route table for routing decisions.
-func RegisterMasterBalancer(rt routetable.MasterRouteTable) {
-	if masterBalancerBuilderRegistered.Load() {
-		return
+// Name returns the name of the gRPC balancer of type t for service, such as master-player.
+func Name(t Type, service string) string {
+	// gRPC looks up balancers by lowercase names
+	return strings.ToLower(string(t) + "-" + service)
+}
+
+// RegisterServiceBalancer registers the balancer of type t for service with the route table rt and opts,
+// and returns its name to be used in the loadBalancingConfig of the connections to service.
+// The route table of TypeMaster must be a MasterRouteTable, and TypeHash needs none.
+// Registering a service again is a no-op with the same route table and options, and an error otherwise,
+// which it always is if either registration has function options such as WithTakeoverHook.
+// Route tables are compared by identity, so a route table that is not a pointer must be comparable
+// to be registered again.
+func RegisterServiceBalancer(t Type, service string, rt routetable.ReadOnlyRouteTable, opts ...Option) (string, error) {
+	name := Name(t, service)
+
+	if err := register(name, t, rt, opts); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// RegisterMasterBalancer registers a balancer for master nodes named master.
+// It uses the provided route table for routing decisions, and opts such as WithTakeoverGrace and WithStrategy.
+//
+// Deprecated: The balancer is shared by every service of the process. Use RegisterServiceBalancer.
+func RegisterMasterBalancer(rt routetable.MasterRouteTable, opts ...Option) {
+	registerGlobal(TypeMaster, rt, opts)
+}
+
+// RegisterReadOnlyBalancer registers a balancer for reader nodes named reader.
+// It uses the provided route table for routing decisions, and opts such as WithStrategy.
+//
+// Deprecated: The balancer is shared by every service of the process. Use RegisterServiceBalancer.
+func RegisterReadOnlyBalancer(rt routetable.ReadOnlyRouteTable, opts ...Option) {
+	registerGlobal(TypeReader, rt, opts)
+}
+
+// RegisterHashBalancer registers a balancer for nodes sharded by oid named hash.
+// It maps the oid of every request onto the nodes with weighted rendezvous hashing.
+//
+// Deprecated: Use RegisterServiceBalancer.
+func RegisterHashBalancer() {
+	registerGlobal(TypeHash, nil, nil)
+}
+
+func registerGlobal(t Type, rt routetable.ReadOnlyRouteTable, opts []Option) {
+	if err := register(string(t), t, rt, opts); err != nil {
+		log.Warnf("register balancer failed. type=%s err=%+v", t, err)
+	}
+}
+
+func register(name string, t Type, rt routetable.ReadOnlyRouteTable, opts []Option) error {
+	switch t {
+	case TypeMaster:
+		if _, ok := rt.(routetable.MasterRouteTable); !ok {
+			return errors.Errorf("route table is not a master route table. balancer=%s", name)
+		}
+	case TypeReader:
+		if rt == nil {
+			return errors.Errorf("route table is nil. balancer=%s", name)
+		}
+	case TypeHash:
+		rt = nil
+	default:
+		return errors.Errorf("invalid balancer type: %s", t)
+	}
+
+	o := newOptions(append([]Option{WithBalancerType(t), WithRouteTable(rt)}, opts...)...)
+
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+
+	if old, ok := registered[name]; ok {
+		if !sameRouteTable(old.routeTable, o.routeTable) {
+			return errors.Errorf("balancer is already registered with another route table. balancer=%s", name)
+		}
+
+		if hasFuncOptions(old) || hasFuncOptions(o) {
+			return errors.Errorf("balancer is already registered with function options, which cannot be compared. balancer=%s", name)
+		}
+
+		if !sameOptions(old, o) {
+			return errors.Errorf("balancer is already registered with other options. balancer=%s", name)
+		}
+
+		return nil
 	}
 
-	t := TypeMaster
-	registerBalancerBuilder(t, newBalancerBuilder(WithBalancerType(t), WithRouteTable(rt)))
-	masterBalancerBuilderRegistered.Store(true)
+	registerBalancerBuilder(name, newBalancerBuilder(o))
+	registered[name] = o
+
+	return nil
 }
 
-// RegisterReadOnlyBalancer registers a balancer for reader nodes.
-// It uses the provided route table for routing decisions.
-func RegisterReadOnlyBalancer(rt routetable.ReadOnlyRouteTable) {
-	if readerBalancerBuilderRegistered.Load() {
-		return
+// sameRouteTable reports whether a and b are the same route table. Pointers are compared by address,
+// and route tables that cannot be compared are never the same.
+func sameRouteTable(a, b routetable.ReadOnlyRouteTable) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Type() != vb.Type() || !va.Comparable() || !vb.Comparable() {
+		return false
 	}
 
-	t := TypeReader
-	registerBalancerBuilder(t, newBalancerBuilder(WithBalancerType(t), WithRouteTable(rt)))
-	readerBalancerBuilderRegistered.Store(true)
+	return va.Equal(vb)
+}
+
+// sameOptions reports whether a and b configure the same balancer, apart from the route table
+// and the function options, see hasFuncOptions.
+func sameOptions(a, b options) bool {
+	return a.balancerType == b.balancerType &&
+		a.takeoverGrace == b.takeoverGrace &&
+		a.strategy == b.strategy &&
+		reflect.DeepEqual(a.zoneAffinity, b.zoneAffinity) &&
+		maps.Equal(a.colorFallback, b.colorFallback)
+}
+
+// hasFuncOptions reports whether o is configured with functions, such as a TakeoverHook or a LoadScore.
+// Functions cannot be compared, so a balancer registered with them cannot be registered again.
+func hasFuncOptions(o options) bool {
+	return o.takeoverHook != nil || o.loadScore != nil
 }
 
-func registerBalancerBuilder(balancerType Type, builder selector.Builder) {
+func registerBalancerBuilder(name string, builder selector.Builder) {
 	b := base.NewBalancerBuilder(
-		string(balancerType),
+		name,
 		newPickerBuilder(builder),
 		base.Config{HealthCheck: true},
 	)
@@ -0,0 +1,109 @@
+package balancer
+
+import (
+	"testing"
+
+	"github.com/go-pantheon/fabrica-kit/router/loadreport"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/balancer"
+)
+
+func TestRegisterServiceBalancer(t *testing.T) {
+	t.Parallel()
+
+	mem := memory.New()
+	t.Cleanup(func() { _ = mem.Close() })
+
+	player := routetable.NewMasterRouteTable(mem, "player")
+	room := routetable.NewMasterRouteTable(mem, "room")
+
+	name, err := RegisterServiceBalancer(TypeMaster, "Test-Player", player)
+	require.NoError(t, err)
+	assert.Equal(t, "master-test-player", name)
+	assert.NotNil(t, balancer.Get(name))
+
+	// another service with another route table coexists
+	name, err = RegisterServiceBalancer(TypeMaster, "test-room", room)
+	require.NoError(t, err)
+	assert.NotNil(t, balancer.Get(name))
+
+	_, err = RegisterServiceBalancer(TypeMaster, "test-player", player)
+	require.NoError(t, err)
+
+	_, err = RegisterServiceBalancer(TypeMaster, "test-player", room)
+	require.Error(t, err)
+
+	// the same service can be balanced by another type
+	name, err = RegisterServiceBalancer(TypeHash, "test-player", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hash-test-player", name)
+
+	_, err = RegisterServiceBalancer(TypeMaster, "test-guild", routetable.NewReadOnlyRouteTable(mem, "guild"))
+	require.Error(t, err)
+
+	_, err = RegisterServiceBalancer(TypeReader, "test-guild", nil)
+	require.Error(t, err)
+
+	_, err = RegisterServiceBalancer("unknown", "test-guild", player)
+	require.Error(t, err)
+}
+
+// valueRouteTable is a route table of a type that cannot be compared.
+type valueRouteTable struct {
+	routetable.ReadOnlyRouteTable
+
+	tags []string
+}
+
+func TestRegisterServiceBalancerAgain(t *testing.T) {
+	t.Parallel()
+
+	mem := memory.New()
+	t.Cleanup(func() { _ = mem.Close() })
+
+	rt := routetable.NewReadOnlyRouteTable(mem, "team")
+
+	_, err := RegisterServiceBalancer(TypeReader, "test-team", rt, WithStrategy(StrategyP2C))
+	require.NoError(t, err)
+
+	_, err = RegisterServiceBalancer(TypeReader, "test-team", rt, WithStrategy(StrategyP2C))
+	require.NoError(t, err)
+
+	_, err = RegisterServiceBalancer(TypeReader, "test-team", rt)
+	require.Error(t, err)
+
+	fallback := ColorFallback{"feature-x": "base"}
+
+	_, err = RegisterServiceBalancer(TypeReader, "test-fallback", rt, WithColorFallback(fallback))
+	require.NoError(t, err)
+
+	_, err = RegisterServiceBalancer(TypeReader, "test-fallback", rt, WithColorFallback(ColorFallback{"feature-x": "base"}))
+	require.NoError(t, err)
+
+	_, err = RegisterServiceBalancer(TypeReader, "test-fallback", rt, WithColorFallback(ColorFallback{"feature-x": "dev"}))
+	require.Error(t, err)
+
+	_, err = RegisterServiceBalancer(TypeReader, "test-fallback", rt)
+	require.Error(t, err)
+
+	// functions cannot be compared, even to themselves
+	score := func(loadreport.Report) float64 { return 0 }
+
+	_, err = RegisterServiceBalancer(TypeReader, "test-score", rt, WithLoadScore(score))
+	require.NoError(t, err)
+
+	_, err = RegisterServiceBalancer(TypeReader, "test-score", rt, WithLoadScore(score))
+	require.Error(t, err)
+
+	// a route table that cannot be compared is never the same
+	v := valueRouteTable{ReadOnlyRouteTable: rt}
+
+	_, err = RegisterServiceBalancer(TypeReader, "test-tag", v)
+	require.NoError(t, err)
+
+	_, err = RegisterServiceBalancer(TypeReader, "test-tag", v)
+	require.Error(t, err)
+}
@@ -0,0 +1,120 @@
+package balancer
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-pantheon/fabrica-kit/router/loadreport"
+)
+
+const (
+	// reportDecay is the time constant in which the effect of a load report fades, so that the weight of a node
+	// that stopped reporting, or is no longer picked because of its load, recovers.
+	reportDecay = 10 * time.Second
+	// minLoadFactor keeps a fully loaded node selectable, so that its reports keep coming.
+	minLoadFactor = 0.05
+	// reportExpiry is how long the last report of a node is kept, after which its effect has faded.
+	reportExpiry = 10 * reportDecay
+)
+
+// LoadScore maps the load report of a node to its utilization in [0, 1].
+// The effective weight of the node is its weight multiplied by 1 - utilization.
+type LoadScore func(r loadreport.Report) float64
+
+// DefaultLoadScore is the LoadScore of the balancers, the CPU utilization.
+func DefaultLoadScore(r loadreport.Report) float64 {
+	return r.CPU
+}
+
+// WithLoadScore sets how the balancer maps the load reports of the nodes to their utilization.
+// The nodes report their load with the loadreport.Server middleware, which measures nothing itself:
+// the load is what the Reporter of the nodes returns, such as a loadreport.Load they keep up to date.
+func WithLoadScore(score LoadScore) Option {
+	return func(o *options) {
+		o.loadScore = score
+	}
+}
+
+// reports tracks the load factors of the nodes from their load reports.
+type reports struct {
+	mu     sync.Mutex
+	score  LoadScore
+	nodes  map[string]nodeReport
+	pruned time.Time
+}
+
+type nodeReport struct {
+	factor float64
+	at     time.Time
+}
+
+func newReports(score LoadScore) *reports {
+	if score == nil {
+		score = DefaultLoadScore
+	}
+
+	return &reports{score: score, nodes: make(map[string]nodeReport)}
+}
+
+// ingest records the load report in the reply metadata of a request sent to addr, if any.
+func (r *reports) ingest(addr string, md selector.ReplyMD, now time.Time) {
+	if md == nil {
+		return
+	}
+
+	v := md.Get(loadreport.TrailerKey)
+	if v == "" {
+		return
+	}
+
+	report, err := loadreport.Parse(v)
+	if err != nil {
+		log.Warnf("load report is malformed. addr=%s err=%+v", addr, err)
+		return
+	}
+
+	factor := min(max(1-r.score(report), minLoadFactor), 1)
+
+	r.mu.Lock()
+	r.nodes[addr] = nodeReport{factor: factor, at: now}
+	r.mu.Unlock()
+}
+
+// factor returns the factor of the weight of addr, which decays towards 1 as its last report ages.
+func (r *reports) factor(addr string, now time.Time) float64 {
+	r.mu.Lock()
+	nr, ok := r.nodes[addr]
+	r.mu.Unlock()
+
+	if !ok {
+		return 1
+	}
+
+	return 1 - (1-nr.factor)*math.Exp(-float64(now.Sub(nr.at))/float64(reportDecay))
+}
+
+// prune forgets the nodes whose last report is older than reportExpiry, at most once per reportDecay.
+func (r *reports) prune(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.pruned) < reportDecay {
+		return
+	}
+
+	r.pruned = now
+
+	for addr, nr := range r.nodes {
+		if now.Sub(nr.at) > reportExpiry {
+			delete(r.nodes, addr)
+		}
+	}
+}
+
+// weight returns the effective weight of node, its weight adjusted by its load reports.
+func (p *weightBalancer) weight(node selector.WeightedNode, now time.Time) float64 {
+	return node.Weight() * p.reports.factor(node.Address(), now)
+}
@@ -0,0 +1,86 @@
+package balancer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-pantheon/fabrica-kit/router/loadreport"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/memory"
+	"github.com/stretchr/testify/assert"
+	grpcmd "google.golang.org/grpc/metadata"
+)
+
+func TestReportsFactorDecay(t *testing.T) {
+	t.Parallel()
+
+	r := newReports(nil)
+	now := time.Now()
+
+	r.ingest("10.0.0.1:9000", Trailer(grpcmd.Pairs(loadreport.TrailerKey, "cpu=0.800")), now)
+	assert.InDelta(t, 0.2, r.factor("10.0.0.1:9000", now), 1e-9)
+	assert.InDelta(t, 1-0.8/2.718281828, r.factor("10.0.0.1:9000", now.Add(reportDecay)), 1e-6)
+	assert.Equal(t, float64(1), r.factor("10.0.0.2:9000", now))
+
+	// a saturated node stays selectable
+	r.ingest("10.0.0.1:9000", Trailer(grpcmd.Pairs(loadreport.TrailerKey, "cpu=1.000")), now)
+	assert.InDelta(t, minLoadFactor, r.factor("10.0.0.1:9000", now), 1e-9)
+
+	// malformed reports and replies without a report are ignored
+	r.ingest("10.0.0.1:9000", Trailer(grpcmd.Pairs(loadreport.TrailerKey, "cpu")), now)
+	r.ingest("10.0.0.1:9000", Trailer(nil), now)
+	assert.InDelta(t, minLoadFactor, r.factor("10.0.0.1:9000", now), 1e-9)
+
+	// a report is forgotten once expired
+	r.prune(now.Add(reportExpiry))
+	assert.InDelta(t, minLoadFactor, r.factor("10.0.0.1:9000", now), 1e-9)
+
+	r.prune(now.Add(reportExpiry + reportDecay + time.Second))
+	assert.Equal(t, float64(1), r.factor("10.0.0.1:9000", now))
+}
+
+func TestBalancerLoadReports(t *testing.T) {
+	t.Parallel()
+
+	b, _ := newTestMasterBalancer(t, WithLoadScore(func(r loadreport.Report) float64 {
+		return float64(r.Online) / 1000
+	}))
+	nodes := newTestWeightedNodes(2)
+
+	b.done(nodes[0])(context.Background(), selector.DoneInfo{
+		ReplyMD: Trailer(grpcmd.Pairs(loadreport.TrailerKey, loadreport.Report{Online: 900}.String())),
+	})
+
+	counts := make(map[string]int)
+	for oid := range int64(110) {
+		selected, done, err := b.Pick(outgoing("blue", oid), nodes)
+		if assert.NoError(t, err) {
+			counts[selected.Address()]++
+			done(context.Background(), selector.DoneInfo{})
+		}
+	}
+
+	// the effective weights are about 10 and 100
+	assert.InDelta(t, 10, counts[nodes[0].Address()], 2)
+}
+
+func TestBalancerBuilderReports(t *testing.T) {
+	t.Parallel()
+
+	mem := memory.New()
+	t.Cleanup(func() { _ = mem.Close() })
+
+	o := newOptions(WithBalancerType(TypeMaster), WithRouteTable(routetable.NewMasterRouteTable(mem, "test")))
+	builder := &balancerBuilder{options: o, state: newBalancerState(o)}
+	nodes := newTestWeightedNodes(2)
+
+	builder.Build().(*weightBalancer).done(nodes[0])(context.Background(), selector.DoneInfo{
+		ReplyMD: Trailer(grpcmd.Pairs(loadreport.TrailerKey, loadreport.Report{CPU: 0.9}.String())),
+	})
+
+	// the report outlives the balancer, which is rebuilt on a change of the nodes
+	b := builder.Build().(*weightBalancer)
+	assert.InDelta(t, 0.1*nodes[0].Weight(), b.weight(nodes[0], time.Now()), 1e-3)
+}
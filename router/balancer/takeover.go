@@ -0,0 +1,161 @@
+package balancer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// defaultTakeoverGrace is how long the owner of a route must be missing from the nodes before its routes are taken over.
+const defaultTakeoverGrace = 10 * time.Second
+
+// ErrRouteOwnerUnavailable is returned by the master balancer while the node a route points to is missing
+// from the nodes and the takeover grace period has not elapsed.
+var ErrRouteOwnerUnavailable = errors.New("route owner is unavailable")
+
+// TakeoverEvent describes a route moved from a node that disappeared to the selected node.
+type TakeoverEvent struct {
+	Color string
+	OID   int64
+	// From is the address of the node that disappeared.
+	From string
+	// To is the address of the selected node.
+	To string
+	// Epoch is the fencing epoch of the new assignment.
+	Epoch uint64
+	// Missing is how long From had been missing from the nodes.
+	Missing time.Duration
+}
+
+// TakeoverHook is called after every takeover.
+type TakeoverHook func(ctx context.Context, e TakeoverEvent)
+
+// WithTakeoverGrace sets how long the owner of a route must be missing from the nodes before the master balancer
+// takes its routes over, which rides out restarts and discovery flaps. A zero grace takes over immediately.
+func WithTakeoverGrace(grace time.Duration) Option {
+	return func(o *options) {
+		o.takeoverGrace = max(grace, 0)
+	}
+}
+
+// WithTakeoverHook sets a hook called after every takeover, in addition to the takeover log and metric.
+func WithTakeoverHook(hook TakeoverHook) Option {
+	return func(o *options) {
+		o.takeoverHook = hook
+	}
+}
+
+var takeoverCounter = newTakeoverCounter()
+
+func newTakeoverCounter() metric.Int64Counter {
+	c, err := otel.Meter("balancer").Int64Counter(
+		"balancer.route.takeovers",
+		metric.WithDescription("Number of routes taken over from nodes that disappeared"),
+		metric.WithUnit("routes"),
+	)
+	if err != nil {
+		return noop.Int64Counter{}
+	}
+
+	return c
+}
+
+// missingAddrs tracks since when the addresses routed to have been missing from the nodes.
+type missingAddrs struct {
+	mu    sync.Mutex
+	addrs map[string]*missingAddr
+}
+
+type missingAddr struct {
+	since time.Time
+	last  time.Time
+}
+
+func newMissingAddrs() *missingAddrs {
+	return &missingAddrs{addrs: make(map[string]*missingAddr)}
+}
+
+// observe records that addr is missing at now and returns how long it has been missing.
+// Addresses not observed for expiry are forgotten, as they have come back or have no routes left.
+func (m *missingAddrs) observe(addr string, now time.Time, expiry time.Duration) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for a, ma := range m.addrs {
+		if now.Sub(ma.last) > expiry {
+			delete(m.addrs, a)
+		}
+	}
+
+	ma, ok := m.addrs[addr]
+	if !ok {
+		ma = &missingAddr{since: now}
+		m.addrs[addr] = ma
+	}
+
+	ma.last = now
+
+	return now.Sub(ma.since)
+}
+
+// takeover moves the route of oid from stale, an address missing from nodes, to selected
+// once stale has been missing for the grace period. It only succeeds if the route still
+// points to stale, otherwise the node of the current route is returned.
+func (p *weightBalancer) takeover(ctx context.Context, mrt routetable.MasterRouteTable, color string, oid int64,
+	stale string, selected selector.WeightedNode, nodes []selector.WeightedNode) (selector.WeightedNode, selector.DoneFunc, error) {
+	missing := p.missing.observe(stale, time.Now(), p.takeoverGrace+time.Minute)
+	if missing < p.takeoverGrace {
+		return nil, nil, errors.WithMessagef(ErrRouteOwnerUnavailable, "color=%s oid=%d addr=%s missing=%s", color, oid, stale, missing)
+	}
+
+	epoch, err := mrt.CompareAndSwap(ctx, color, oid, stale, selected.Address())
+	if err != nil {
+		if !errors.Is(err, xerrors.ErrRouteTableValueNotSame) && !errors.Is(err, xerrors.ErrRouteTableNotFound) {
+			return nil, nil, err
+		}
+
+		// taken over by another balancer, or deleted meanwhile
+		addr, gerr := mrt.Get(ctx, color, oid)
+		if gerr != nil {
+			return nil, nil, errors.WithMessagef(err, "take over route failed. color=%s oid=%d addr=%s", color, oid, stale)
+		}
+
+		if node := findNode(nodes, addr); node != nil {
+			return node, p.done(node), nil
+		}
+
+		return nil, nil, errors.Errorf("the existed address in routeTable is not found. addr=%s", addr)
+	}
+
+	e := TakeoverEvent{Color: color, OID: oid, From: stale, To: selected.Address(), Epoch: epoch, Missing: missing}
+
+	log.Warnf("route taken over from a missing node. oid=%d color=%s old-addr=%s new-addr=%s epoch=%d missing=%s",
+		oid, color, stale, e.To, epoch, missing)
+	takeoverCounter.Add(ctx, 1, metric.WithAttributes(attribute.String("color", color)))
+
+	if p.takeoverHook != nil {
+		p.takeoverHook(ctx, e)
+	}
+
+	return selected, p.done(selected), nil
+}
+
+func findNode(nodes []selector.WeightedNode, addr string) selector.WeightedNode {
+	for _, node := range nodes {
+		if node.Address() == addr {
+			return node
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package balancer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-kratos/kratos/v2/selector/node/direct"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMasterBalancer(t *testing.T, opts ...Option) (*weightBalancer, routetable.MasterRouteTable) {
+	t.Helper()
+
+	mem := memory.New()
+	t.Cleanup(func() { _ = mem.Close() })
+
+	rt := routetable.NewMasterRouteTable(mem, "test")
+
+	o := options{balancerType: TypeMaster, routeTable: rt, takeoverGrace: defaultTakeoverGrace}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return newWeightBalancer(o, newBalancerState(o)).(*weightBalancer), rt
+}
+
+func TestBalancerTakeover(t *testing.T) {
+	t.Parallel()
+
+	var events []TakeoverEvent
+
+	b, rt := newTestMasterBalancer(t, WithTakeoverGrace(0), WithTakeoverHook(func(_ context.Context, e TakeoverEvent) {
+		events = append(events, e)
+	}))
+
+	ctx := context.Background()
+	require.NoError(t, rt.Set(ctx, "blue", 1, "10.0.0.1:9000"))
+
+	builder := &direct.Builder{}
+	nodes := []selector.WeightedNode{builder.Build(newTestNode("10.0.0.2:9000", "blue"))}
+
+	selected, _, err := b.Pick(outgoing("blue", 1), nodes)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2:9000", selected.Address())
+
+	addr, epoch, err := rt.GetWithEpoch(ctx, "blue", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2:9000", addr)
+
+	require.Len(t, events, 1)
+	assert.Equal(t, TakeoverEvent{Color: "blue", OID: 1, From: "10.0.0.1:9000", To: "10.0.0.2:9000", Epoch: epoch}, events[0])
+}
+
+func TestBalancerTakeoverGrace(t *testing.T) {
+	t.Parallel()
+
+	b, rt := newTestMasterBalancer(t, WithTakeoverGrace(time.Hour))
+
+	ctx := context.Background()
+	require.NoError(t, rt.Set(ctx, "blue", 1, "10.0.0.1:9000"))
+
+	builder := &direct.Builder{}
+	nodes := []selector.WeightedNode{builder.Build(newTestNode("10.0.0.2:9000", "blue"))}
+
+	_, _, err := b.Pick(outgoing("blue", 1), nodes)
+	require.ErrorIs(t, err, ErrRouteOwnerUnavailable)
+
+	addr, err := rt.Get(ctx, "blue", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:9000", addr)
+}
+
+func TestBalancerBuilderTakeoverGrace(t *testing.T) {
+	t.Parallel()
+
+	mem := memory.New()
+	t.Cleanup(func() { _ = mem.Close() })
+
+	rt := routetable.NewMasterRouteTable(mem, "test")
+	o := newOptions(WithBalancerType(TypeMaster), WithRouteTable(rt), WithTakeoverGrace(50*time.Millisecond))
+	builder := &balancerBuilder{options: o, state: newBalancerState(o)}
+
+	ctx := context.Background()
+	require.NoError(t, rt.Set(ctx, "blue", 1, "10.0.0.1:9000"))
+
+	nodes := []selector.WeightedNode{(&direct.Builder{}).Build(newTestNode("10.0.0.2:9000", "blue"))}
+
+	_, _, err := builder.Build().Pick(outgoing("blue", 1), nodes)
+	require.ErrorIs(t, err, ErrRouteOwnerUnavailable)
+
+	// the grace clock keeps running across the balancers rebuilt on every change of the nodes
+	time.Sleep(60 * time.Millisecond)
+
+	selected, _, err := builder.Build().Pick(outgoing("blue", 1), nodes)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2:9000", selected.Address())
+}
+
+func TestMissingAddrs(t *testing.T) {
+	t.Parallel()
+
+	m := newMissingAddrs()
+	now := time.Unix(1700000000, 0)
+
+	assert.Zero(t, m.observe("a", now, time.Minute))
+	assert.Equal(t, 30*time.Second, m.observe("a", now.Add(30*time.Second), time.Minute))
+
+	// forgotten once not observed for the expiry
+	assert.Zero(t, m.observe("b", now.Add(2*time.Minute), time.Minute))
+	assert.Zero(t, m.observe("a", now.Add(2*time.Minute), time.Minute))
+}
@@ -0,0 +1,95 @@
+package balancer
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-pantheon/fabrica-kit/profile"
+)
+
+// zoneAffinity prefers the nodes of a zone for new assignments.
+type zoneAffinity struct {
+	zone string
+	// maxImbalance is how much the utilization of the zone may exceed the utilization of the other zones.
+	maxImbalance float64
+}
+
+// WithZoneAffinity makes the balancer assign new oids to the nodes of zone, usually profile.Zone(),
+// spilling over to the nodes of all zones when zone has no healthy nodes, or when the mean utilization
+// of its nodes exceeds the mean utilization of the others by more than maxImbalance, such as 0.2.
+// The utilization of the nodes comes from their load reports, see WithLoadScore.
+// The routed requests are always sent to the node of their route, whatever its zone.
+func WithZoneAffinity(zone uint32, maxImbalance float64) Option {
+	return func(o *options) {
+		o.zoneAffinity = &zoneAffinity{
+			zone:         strconv.FormatUint(uint64(zone), 10),
+			maxImbalance: max(maxImbalance, 0),
+		}
+	}
+}
+
+// NewZoneFilter creates a node filter that keeps the nodes of zone, or all nodes if zone has none.
+// It applies to every request, so it suits the services without routes; the balancers of routed
+// services should use WithZoneAffinity, which only applies to new assignments.
+func NewZoneFilter(zone uint32) selector.NodeFilter {
+	z := strconv.FormatUint(uint64(zone), 10)
+
+	return func(_ context.Context, nodes []selector.Node) []selector.Node {
+		if local := inZone(z, nodes); len(local) > 0 {
+			return local
+		}
+
+		return nodes
+	}
+}
+
+func inZone[N selector.Node](zone string, nodes []N) []N {
+	local := make([]N, 0, len(nodes))
+
+	for _, n := range nodes {
+		if n.Metadata()[profile.ZoneKey] == zone {
+			local = append(local, n)
+		}
+	}
+
+	return local
+}
+
+// zoneNodes returns the nodes new oids are assigned to, the nodes of the zone of the balancer
+// unless it has none or is overloaded compared to the other zones.
+func (p *weightBalancer) zoneNodes(nodes []selector.WeightedNode) []selector.WeightedNode {
+	za := p.zoneAffinity
+	if za == nil {
+		return nodes
+	}
+
+	local := inZone(za.zone, nodes)
+	if len(local) == 0 || len(local) == len(nodes) {
+		return nodes
+	}
+
+	now := time.Now()
+
+	var localUtil, remoteUtil float64
+
+	for _, n := range nodes {
+		u := 1 - p.reports.factor(n.Address(), now)
+
+		if n.Metadata()[profile.ZoneKey] == za.zone {
+			localUtil += u
+		} else {
+			remoteUtil += u
+		}
+	}
+
+	localUtil /= float64(len(local))
+	remoteUtil /= float64(len(nodes) - len(local))
+
+	if localUtil-remoteUtil > za.maxImbalance {
+		return nodes
+	}
+
+	return local
+}
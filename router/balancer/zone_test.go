@@ -0,0 +1,75 @@
+package balancer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-kratos/kratos/v2/selector/node/direct"
+	"github.com/go-pantheon/fabrica-kit/profile"
+	"github.com/go-pantheon/fabrica-kit/router/loadreport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	grpcmd "google.golang.org/grpc/metadata"
+)
+
+func newTestZoneNode(addr, zone string) selector.Node {
+	return selector.NewNode("grpc", addr, &registry.ServiceInstance{
+		Metadata: map[string]string{profile.ColorKey: "blue", profile.ZoneKey: zone},
+	})
+}
+
+func TestZoneFilter(t *testing.T) {
+	t.Parallel()
+
+	nodes := []selector.Node{
+		newTestZoneNode("10.0.0.1:9000", "1"),
+		newTestZoneNode("10.0.1.1:9000", "2"),
+	}
+
+	got := NewZoneFilter(2)(context.Background(), nodes)
+	require.Len(t, got, 1)
+	assert.Equal(t, "10.0.1.1:9000", got[0].Address())
+
+	// spills over to all zones when the zone has no nodes
+	assert.Len(t, NewZoneFilter(3)(context.Background(), nodes), 2)
+}
+
+func TestBalancerZoneAffinity(t *testing.T) {
+	t.Parallel()
+
+	b, rt := newTestMasterBalancer(t, WithZoneAffinity(1, 0.2))
+
+	builder := &direct.Builder{}
+	nodes := []selector.WeightedNode{
+		builder.Build(newTestZoneNode("10.0.0.1:9000", "1")),
+		builder.Build(newTestZoneNode("10.0.1.1:9000", "2")),
+	}
+
+	for oid := range int64(10) {
+		selected, _, err := b.Pick(outgoing("blue", oid), nodes)
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1:9000", selected.Address())
+	}
+
+	// a route to another zone is kept
+	require.NoError(t, rt.Set(context.Background(), "blue", 100, "10.0.1.1:9000"))
+	selected, _, err := b.Pick(outgoing("blue", 100), nodes)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.1:9000", selected.Address())
+
+	// spills over once the zone is overloaded
+	b.done(nodes[0])(context.Background(), selector.DoneInfo{
+		ReplyMD: Trailer(grpcmd.Pairs(loadreport.TrailerKey, loadreport.Report{CPU: 0.9}.String())),
+	})
+
+	counts := make(map[string]int)
+	for oid := range int64(20) {
+		selected, _, err := b.Pick(outgoing("blue", 200+oid), nodes)
+		require.NoError(t, err)
+		counts[selected.Address()]++
+	}
+
+	assert.Positive(t, counts["10.0.1.1:9000"])
+}
@@ -26,30 +26,23 @@ type Conn struct {
 }
 
 // NewConn creates a new gRPC client connection with the specified service name, balancer type,
-// logger, route table, and discovery mechanism.
-// It configures the connection with appropriate middleware and balancer settings.
-func NewConn(serviceName string, balancerType balancer.Type, logger log.Logger, rt routetable.ReadOnlyRouteTable, r registry.Discovery) (*Conn, error) {
-	switch balancerType {
-	case balancer.TypeMaster:
-		mrt, ok := rt.(routetable.MasterRouteTable)
-		if !ok {
-			return nil, errors.Errorf("route table is not a master route table")
-		}
-
-		balancer.RegisterMasterBalancer(mrt)
-	case balancer.TypeReader:
-		balancer.RegisterReadOnlyBalancer(rt)
-	default:
-		return nil, errors.Errorf("invalid balancer type: %s", balancerType)
+// logger, route table, and discovery mechanism. The route table is not used by balancer.TypeHash and may be nil.
+// It configures the connection with appropriate middleware and a balancer of its own for the service,
+// built with opts, so that the connections to services with different route tables can coexist.
+func NewConn(serviceName string, balancerType balancer.Type, logger log.Logger, rt routetable.ReadOnlyRouteTable, r registry.Discovery,
+	opts ...balancer.Option) (*Conn, error) {
+	name, err := balancer.RegisterServiceBalancer(balancerType, serviceName, rt, opts...)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "register balancer failed. app=%s", serviceName)
 	}
 
 	conn, err := grpc.DialInsecure(
 		context.Background(),
 		grpc.WithEndpoint(fmt.Sprintf("discovery:///%s", serviceName)),
 		grpc.WithDiscovery(r),
-		grpc.WithNodeFilter(balancer.NewFilter()),
+		grpc.WithNodeFilter(balancer.NewFilter(opts...)),
 		grpc.WithOptions(
-			grpcgo.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{"%s":{}}]}`, string(balancerType))),
+			grpcgo.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{"%s":{}}]}`, name)),
 		),
 		grpc.WithMiddleware(
 			recovery.Recovery(),
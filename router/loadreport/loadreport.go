@@ -0,0 +1,118 @@
+// Package loadreport reports the load of a server to its clients in a gRPC trailer,
+// which the balancers use to adjust the effective weights of the nodes.
+// It measures nothing itself: the server supplies its CPU utilization, online players
+// and queued or in-flight requests, usually by keeping a Load up to date.
+package loadreport
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// TrailerKey is the gRPC trailer carrying the load report of the server.
+const TrailerKey = "x-md-load-report"
+
+// Report is the load of a server.
+type Report struct {
+	// CPU is the CPU utilization in [0, 1].
+	CPU float64
+	// Online is the number of online players.
+	Online int64
+	// Queue is the number of queued requests or jobs.
+	Queue int64
+}
+
+// String encodes r as the value of TrailerKey, such as "cpu=0.530,online=1200,queue=3".
+func (r Report) String() string {
+	return "cpu=" + strconv.FormatFloat(r.CPU, 'f', 3, 64) +
+		",online=" + strconv.FormatInt(r.Online, 10) +
+		",queue=" + strconv.FormatInt(r.Queue, 10)
+}
+
+// Parse decodes the value of TrailerKey. Unknown fields are ignored.
+func Parse(s string) (Report, error) {
+	var r Report
+
+	for field := range strings.SplitSeq(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return Report{}, errors.Errorf("load report field is malformed. field=%s", field)
+		}
+
+		var err error
+
+		switch k {
+		case "cpu":
+			r.CPU, err = strconv.ParseFloat(v, 64)
+		case "online":
+			r.Online, err = strconv.ParseInt(v, 10, 64)
+		case "queue":
+			r.Queue, err = strconv.ParseInt(v, 10, 64)
+		}
+
+		if err != nil {
+			return Report{}, errors.Wrapf(err, "load report field is malformed. field=%s", field)
+		}
+	}
+
+	return r, nil
+}
+
+// Reporter returns the current load of the server. It is called for every reply and should be cheap.
+type Reporter func() Report
+
+// Server returns a middleware that reports the load of the server in the trailer of every gRPC reply.
+// The load is the one returned by r, as Server does not measure it.
+func Server(r Reporter) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			reply, err := handler(ctx, req)
+
+			// the trailer can only be set on gRPC calls, the error is ignored for other transports
+			_ = grpc.SetTrailer(ctx, metadata.Pairs(TrailerKey, r().String()))
+
+			return reply, err
+		}
+	}
+}
+
+// Load holds the load of a server, updated by the server and reported by Server with its Report method.
+// Nothing is measured by Load: the server must set its CPU utilization, such as from a process sampler,
+// and its online players and queue as they change, otherwise it reports no load.
+type Load struct {
+	cpu    atomic.Uint64
+	online atomic.Int64
+	queue  atomic.Int64
+}
+
+// SetCPU sets the CPU utilization, clamped to [0, 1].
+func (l *Load) SetCPU(cpu float64) {
+	l.cpu.Store(math.Float64bits(min(max(cpu, 0), 1)))
+}
+
+// SetOnline sets the number of online players.
+func (l *Load) SetOnline(n int64) {
+	l.online.Store(n)
+}
+
+// AddQueue adds delta to the number of queued requests or jobs.
+func (l *Load) AddQueue(delta int64) {
+	l.queue.Add(delta)
+}
+
+// Report returns the current load. It is a Reporter.
+func (l *Load) Report() Report {
+	return Report{
+		CPU:    math.Float64frombits(l.cpu.Load()),
+		Online: l.online.Load(),
+		Queue:  l.queue.Load(),
+	}
+}
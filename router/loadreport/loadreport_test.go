@@ -0,0 +1,58 @@
+package loadreport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	r := Report{CPU: 0.53, Online: 1200, Queue: 3}
+	assert.Equal(t, "cpu=0.530,online=1200,queue=3", r.String())
+
+	got, err := Parse(r.String())
+	require.NoError(t, err)
+	assert.Equal(t, r, got)
+
+	got, err = Parse("online=5, mem=0.9")
+	require.NoError(t, err)
+	assert.Equal(t, Report{Online: 5}, got)
+
+	for _, s := range []string{"cpu", "cpu=x", "online=1.5"} {
+		_, err := Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	var l Load
+
+	l.SetCPU(1.5)
+	l.SetOnline(10)
+	l.AddQueue(2)
+	l.AddQueue(-1)
+
+	assert.Equal(t, Report{CPU: 1, Online: 10, Queue: 1}, l.Report())
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	called := 0
+	h := Server(func() Report {
+		called++
+		return Report{}
+	})(func(context.Context, any) (any, error) { return "reply", nil })
+
+	// outside of a gRPC call the trailer is skipped
+	reply, err := h(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "reply", reply)
+	assert.Equal(t, 1, called)
+}
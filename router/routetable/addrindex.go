@@ -0,0 +1,122 @@
+package routetable
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-pantheon/fabrica-util/errors"
+)
+
+// ErrAddrIndexNotConfigured is returned by ListByAddr and CountByAddr when the route table has no AddrIndex.
+var ErrAddrIndexNotConfigured = errors.New("route table address index not configured")
+
+const defaultListByAddrCount = 100
+
+// AddrIndex is a reverse index from an address to the oids routed to it.
+// It is maintained by the data store within the writes of the routes, so an oid routed to an address
+// is always in its index; see memory.WithAddrIndex and redis.WithAddrIndex. The index can also hold
+// oids whose routes have expired until they are pruned.
+type AddrIndex interface {
+	// Scan iterates the oids recorded for addr with the cursor semantics of Redis SSCAN:
+	// it starts and ends at cursor 0, count is a hint, and oids changed during the iteration
+	// may be missed or returned more than once.
+	Scan(ctx context.Context, name, color, addr string, cursor uint64, count int64) (oids []int64, next uint64, err error)
+	// Count returns the number of oids recorded for addr whose route is live and routed to addr.
+	Count(ctx context.Context, name, color, addr string) (int64, error)
+	// Prune removes the oids of name and color from the index of addr that are no longer routed to addr.
+	// Every oid is checked and removed atomically, so an oid routed to addr again in the meantime is kept.
+	Prune(ctx context.Context, name, color, addr string, oids ...int64) error
+}
+
+// AddrIndexKey builds the data store key of the index of addr in the form ra1:<name>:<color>:{<addr>}.
+// Separators are escaped like in the keys of V1KeyCodec, and the address is the Redis Cluster hash tag.
+func AddrIndexKey(name, color, addr string) string {
+	var b strings.Builder
+
+	b.Grow(len(name) + len(color) + len(addr) + 8)
+	b.WriteString("ra1:")
+	escapeKeyPart(&b, name)
+	b.WriteByte(':')
+	escapeKeyPart(&b, color)
+	b.WriteString(":{")
+	escapeKeyPart(&b, addr)
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// ListByAddr returns a page of the oids of color routed to addr, starting at cursor 0
+// and ending when the returned cursor is 0. A page may be empty before the end.
+//
+// The index can hold oids whose routes have expired. Every page is checked against
+// the route table and such oids are pruned from the index instead of being returned.
+func (r *masterRouteTable) ListByAddr(ctx context.Context, color, addr string, cursor uint64, count int64) ([]int64, uint64, error) {
+	oids, _, next, err := r.listByAddr(ctx, color, addr, cursor, count)
+	return oids, next, err
+}
+
+// listByAddr is ListByAddr that also returns the stored value of every oid.
+func (r *masterRouteTable) listByAddr(ctx context.Context, color, addr string, cursor uint64, count int64) ([]int64, []string, uint64, error) {
+	if r.addrIndex == nil {
+		return nil, nil, 0, ErrAddrIndexNotConfigured
+	}
+
+	if count <= 0 {
+		count = defaultListByAddrCount
+	}
+
+	oids, next, err := r.addrIndex.Scan(ctx, r.name, color, addr, cursor, count)
+	if err != nil {
+		return nil, nil, 0, errors.WithMessagef(err, "scan address index failed. color=%s addr=%s", color, addr)
+	}
+
+	if len(oids) == 0 {
+		return nil, nil, next, nil
+	}
+
+	keys, _ := buildKeys(r, color, oids, "")
+
+	vals, err := r.data.BatchGet(ctx, keys)
+	if err != nil {
+		return nil, nil, 0, errors.WithMessagef(err, "list route table by address failed. color=%s addr=%s", color, addr)
+	}
+
+	var (
+		owned     = make([]int64, 0, len(oids))
+		ownedVals = make([]string, 0, len(oids))
+		stale     []int64
+	)
+
+	for i, oid := range oids {
+		if e, err := decodeEntry(keys[i], vals[i]); err == nil && e.Addr == addr {
+			owned = append(owned, oid)
+			ownedVals = append(ownedVals, vals[i])
+		} else {
+			stale = append(stale, oid)
+		}
+	}
+
+	if len(stale) > 0 {
+		if err := r.addrIndex.Prune(ctx, r.name, color, addr, stale...); err != nil {
+			log.Warnf("prune route table address index failed. color=%s addr=%s err=%+v", color, addr, err)
+		}
+	}
+
+	return owned, ownedVals, next, nil
+}
+
+// CountByAddr returns the number of oids of color recorded for addr in the index.
+// It can include expired oids that ListByAddr has not pruned yet.
+func (r *masterRouteTable) CountByAddr(ctx context.Context, color, addr string) (int64, error) {
+	if r.addrIndex == nil {
+		return 0, ErrAddrIndexNotConfigured
+	}
+
+	n, err := r.addrIndex.Count(ctx, r.name, color, addr)
+	if err != nil {
+		return 0, errors.WithMessagef(err, "count address index failed. color=%s addr=%s", color, addr)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,99 @@
+package routetable_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/internal/testclock"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestIndexedMasterRouteTable creates a master route table whose data store maintains an address index.
+func newTestIndexedMasterRouteTable(t *testing.T) (routetable.MasterRouteTable, *testclock.Clock) {
+	t.Helper()
+
+	clock := testclock.New(time.Unix(1700000000, 0))
+	data := newTestData(t, clock, memory.WithAddrIndex(routetable.LegacyKeyCodec))
+
+	return routetable.NewMasterRouteTable(data, testName, routetable.WithClock(clock.Now), routetable.WithAddrIndex(data.AddrIndex())), clock
+}
+
+func listAllByAddr(t *testing.T, rt routetable.MasterRouteTable, addr string) []int64 {
+	t.Helper()
+
+	var (
+		all    []int64
+		cursor uint64
+	)
+
+	for {
+		oids, next, err := rt.ListByAddr(context.Background(), testColor, addr, cursor, 2)
+		require.NoError(t, err)
+
+		all = append(all, oids...)
+
+		if next == 0 {
+			return all
+		}
+
+		cursor = next
+	}
+}
+
+func TestListByAddr(t *testing.T) {
+	t.Parallel()
+
+	const a, b = "10.0.0.1:9000", "10.0.0.2:9000"
+
+	ctx := context.Background()
+	rt, clock := newTestIndexedMasterRouteTable(t)
+
+	_, err := rt.BatchSetNxOrGet(ctx, testColor, []int64{1, 2, 3, 4, 5}, a)
+	require.NoError(t, err)
+	require.NoError(t, rt.Set(ctx, testColor, 6, b))
+
+	_, _, err = rt.GetSet(ctx, testColor, 2, b)
+	require.NoError(t, err)
+
+	_, epoch, err := rt.GetWithEpoch(ctx, testColor, 3)
+	require.NoError(t, err)
+	require.NoError(t, rt.DelIfSame(ctx, testColor, 3, a, epoch))
+	require.NoError(t, rt.Del(ctx, testColor, 4))
+
+	n, err := rt.CountByAddr(ctx, testColor, a)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	assert.ElementsMatch(t, []int64{1, 5}, listAllByAddr(t, rt, a))
+	assert.ElementsMatch(t, []int64{2, 6}, listAllByAddr(t, rt, b))
+
+	// oid 5 expires without a write, which is left in the index until it is pruned but no longer counted
+	require.NoError(t, rt.DelDelay(ctx, testColor, 5, time.Second))
+	clock.Advance(2 * time.Second)
+
+	n, err = rt.CountByAddr(ctx, testColor, a)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	assert.ElementsMatch(t, []int64{1}, listAllByAddr(t, rt, a))
+
+	n, err = rt.CountByAddr(ctx, testColor, a)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestListByAddrNotConfigured(t *testing.T) {
+	t.Parallel()
+
+	rt, _ := newTestMasterRouteTable(t)
+
+	_, _, err := rt.ListByAddr(context.Background(), testColor, "10.0.0.1:9000", 0, 10)
+	require.ErrorIs(t, err, routetable.ErrAddrIndexNotConfigured)
+
+	_, err = rt.CountByAddr(context.Background(), testColor, "10.0.0.1:9000")
+	require.ErrorIs(t, err, routetable.ErrAddrIndexNotConfigured)
+}
@@ -0,0 +1,285 @@
+// Package admin provides Kratos HTTP endpoints to inspect and override route tables,
+// so that stuck routes can be fixed without touching the data store directly.
+package admin
+
+import (
+	"context"
+	"maps"
+	"strconv"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+)
+
+// Prefix is the path prefix of the endpoints. It starts with /admin, so dev.IsAdminPath reports true for them.
+const Prefix = "/admin/routetable"
+
+// The endpoints, relative to Prefix:
+//
+//	GET    /{name}/{color}/{oid}                           look up a route and its remaining ttl
+//	GET    /{name}/{color}?addr={addr}&cursor=&count=      list the oids routed to an address
+//	PUT    /{name}/{color}/{oid}  {"addr": "", "from": ""} move a route to addr, only if it is routed to from if set
+//	DELETE /{name}/{color}/{oid}                           evict a route, unless it changes meanwhile
+
+// Route is a routing entry returned by the endpoints.
+type Route struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+	OID   int64  `json:"oid"`
+	routetable.RouteEntry
+	// TTLMs is the remaining time to live in milliseconds, which is omitted for entries that do not expire.
+	TTLMs int64 `json:"ttl_ms,omitempty"`
+	// TableTTLMs is the time to live the route table renews its entries with.
+	TableTTLMs int64 `json:"table_ttl_ms"`
+}
+
+// ListReply is the reply of the list endpoint. Next is the cursor of the next page, or 0 at the end.
+type ListReply struct {
+	OIDs []int64 `json:"oids"`
+	Next uint64  `json:"next"`
+}
+
+// MoveRequest is the body of the move endpoint.
+type MoveRequest struct {
+	// Addr is the address the route is moved to.
+	Addr string `json:"addr"`
+	// From is the address the route must be routed to, otherwise the route is moved unconditionally.
+	From string `json:"from,omitempty"`
+}
+
+// MoveReply is the reply of the move endpoint. Old is empty if the route did not exist.
+// The Old of a conditional move only holds the address it was moved from, which the swap confirmed.
+type MoveReply struct {
+	Old *Route `json:"old,omitempty"`
+	Cur Route  `json:"cur"`
+}
+
+// Handler serves the endpoints of a set of route tables by name.
+type Handler struct {
+	tables map[string]routetable.MasterRouteTable
+}
+
+// NewHandler creates a handler of tables, which are keyed by the name of the route table.
+func NewHandler(tables map[string]routetable.MasterRouteTable) *Handler {
+	return &Handler{tables: maps.Clone(tables)}
+}
+
+// Register mounts the endpoints on srv under Prefix. The middleware of srv is applied to every endpoint.
+func (h *Handler) Register(srv *http.Server) {
+	r := srv.Route(Prefix)
+
+	r.GET("/{name}/{color}/{oid}", h.get)
+	r.GET("/{name}/{color}", h.list)
+	r.PUT("/{name}/{color}/{oid}", h.move)
+	r.DELETE("/{name}/{color}/{oid}", h.evict)
+}
+
+// route holds the path variables of an endpoint.
+type route struct {
+	name  string
+	color string
+	oid   int64
+	rt    routetable.MasterRouteTable
+}
+
+func (h *Handler) route(ctx http.Context, withOID bool) (*route, error) {
+	vars := ctx.Vars()
+
+	r := &route{name: vars.Get("name"), color: vars.Get("color")}
+
+	rt, ok := h.tables[r.name]
+	if !ok {
+		return nil, xerrors.APINotFound("route table %s not found", r.name)
+	}
+
+	r.rt = rt
+
+	if !withOID {
+		return r, nil
+	}
+
+	oid, err := strconv.ParseInt(vars.Get("oid"), 10, 64)
+	if err != nil {
+		return nil, xerrors.APIParamInvalid("invalid oid %q", vars.Get("oid"))
+	}
+
+	r.oid = oid
+
+	return r, nil
+}
+
+// serve runs fn through the middleware of the server as operation op and writes its reply.
+func serve(ctx http.Context, op string, req any, fn func(ctx context.Context) (any, error)) error {
+	http.SetOperation(ctx, Prefix+"/"+op)
+
+	reply, err := ctx.Middleware(func(c context.Context, _ any) (any, error) {
+		return fn(c)
+	})(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Result(200, reply)
+}
+
+func (h *Handler) get(ctx http.Context) error {
+	r, err := h.route(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	return serve(ctx, "get", r, func(c context.Context) (any, error) {
+		e, err := r.rt.GetEntryWithTTL(c, r.color, r.oid)
+		if err != nil {
+			return nil, apiError(err, r)
+		}
+
+		ret := r.reply(e.RouteEntry)
+		ret.TTLMs = e.TTL.Milliseconds()
+
+		return ret, nil
+	})
+}
+
+func (h *Handler) list(ctx http.Context) error {
+	r, err := h.route(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	q := ctx.Query()
+
+	addr := q.Get("addr")
+	if addr == "" {
+		return xerrors.APIParamInvalid("addr is required")
+	}
+
+	var (
+		cursor uint64
+		count  int64
+	)
+
+	if s := q.Get("cursor"); s != "" {
+		if cursor, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return xerrors.APIPageParamInvalid("invalid cursor %q", s)
+		}
+	}
+
+	if s := q.Get("count"); s != "" {
+		if count, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return xerrors.APIPageParamInvalid("invalid count %q", s)
+		}
+	}
+
+	return serve(ctx, "list", r, func(c context.Context) (any, error) {
+		oids, next, err := r.rt.ListByAddr(c, r.color, addr, cursor, count)
+		if err != nil {
+			return nil, apiError(err, r)
+		}
+
+		if oids == nil {
+			oids = []int64{}
+		}
+
+		return &ListReply{OIDs: oids, Next: next}, nil
+	})
+}
+
+func (h *Handler) move(ctx http.Context) error {
+	r, err := h.route(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	var req MoveRequest
+	if err := ctx.Bind(&req); err != nil {
+		return xerrors.APIParamInvalid("invalid move request: %v", err)
+	}
+
+	if req.Addr == "" {
+		return xerrors.APIParamInvalid("addr is required")
+	}
+
+	return serve(ctx, "move", &req, func(c context.Context) (any, error) {
+		if req.From != "" {
+			return r.compareAndSwap(c, req)
+		}
+
+		old, cur, err := r.rt.GetSetEntry(c, r.color, r.oid, routetable.RouteEntry{Addr: req.Addr})
+		if err != nil {
+			return nil, apiError(err, r)
+		}
+
+		log.Warnf("route moved by admin. name=%s color=%s oid=%d from=%s to=%s epoch=%d", r.name, r.color, r.oid, old.Addr, cur.Addr, cur.Epoch)
+
+		ret := &MoveReply{Cur: *r.reply(cur)}
+		if old.Addr != "" {
+			ret.Old = r.reply(old)
+		}
+
+		return ret, nil
+	})
+}
+
+func (r *route) compareAndSwap(ctx context.Context, req MoveRequest) (*MoveReply, error) {
+	epoch, err := r.rt.CompareAndSwap(ctx, r.color, r.oid, req.From, req.Addr)
+	if err != nil {
+		return nil, apiError(err, r)
+	}
+
+	log.Warnf("route moved by admin. name=%s color=%s oid=%d from=%s to=%s epoch=%d", r.name, r.color, r.oid, req.From, req.Addr, epoch)
+
+	return &MoveReply{Old: r.reply(routetable.RouteEntry{Addr: req.From}), Cur: *r.reply(routetable.RouteEntry{Addr: req.Addr, Epoch: epoch})}, nil
+}
+
+func (h *Handler) evict(ctx http.Context) error {
+	r, err := h.route(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	return serve(ctx, "evict", r, func(c context.Context) (any, error) {
+		old, err := r.rt.GetEntry(c, r.color, r.oid)
+		if err != nil {
+			return nil, apiError(err, r)
+		}
+
+		if err := r.rt.DelIfSame(c, r.color, r.oid, old.Addr, old.Epoch); err != nil {
+			return nil, apiError(err, r)
+		}
+
+		log.Warnf("route evicted by admin. name=%s color=%s oid=%d addr=%s epoch=%d", r.name, r.color, r.oid, old.Addr, old.Epoch)
+
+		return r.reply(old), nil
+	})
+}
+
+func (r *route) reply(e routetable.RouteEntry) *Route {
+	return &Route{
+		Name:       r.name,
+		Color:      r.color,
+		OID:        r.oid,
+		RouteEntry: e,
+		TableTTLMs: r.rt.TTL().Milliseconds(),
+	}
+}
+
+// apiError converts an error of the route table into an API error.
+func apiError(err error, r *route) error {
+	switch {
+	case errors.Is(err, xerrors.ErrRouteTableNotFound):
+		return xerrors.APINotFound("route not found. name=%s color=%s oid=%d", r.name, r.color, r.oid)
+	case errors.Is(err, xerrors.ErrRouteTableValueNotSame):
+		return xerrors.APIStateUpdateFailed("route has changed. name=%s color=%s oid=%d", r.name, r.color, r.oid)
+	case errors.Is(err, routetable.ErrAddrIndexNotConfigured):
+		return xerrors.APIStatusIllegal("route table %s has no address index", r.name)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return xerrors.APISessionTimeout("route table request timed out. name=%s", r.name)
+	default:
+		log.Errorf("route table admin request failed. name=%s color=%s oid=%d err=%+v", r.name, r.color, r.oid, err)
+		return xerrors.APIDBFailed("route table request failed. name=%s", r.name)
+	}
+}
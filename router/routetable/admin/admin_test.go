@@ -0,0 +1,175 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) (*http.Server, routetable.MasterRouteTable) {
+	t.Helper()
+
+	mem := memory.New(memory.WithAddrIndex(routetable.LegacyKeyCodec))
+	t.Cleanup(func() { _ = mem.Close() })
+
+	rt := routetable.NewMasterRouteTable(mem, "player", routetable.WithAddrIndex(mem.AddrIndex()))
+
+	srv := http.NewServer()
+	NewHandler(map[string]routetable.MasterRouteTable{"player": rt}).Register(srv)
+
+	return srv, rt
+}
+
+func do(t *testing.T, srv *http.Server, method, path, body string, reply any) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	if reply != nil && w.Code == nethttp.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), reply))
+	}
+
+	return w.Code
+}
+
+func TestHandlerGet(t *testing.T) {
+	t.Parallel()
+
+	srv, rt := newTestServer(t)
+
+	_, _, epoch, err := rt.SetNxOrGet(context.Background(), "blue", 1, "10.0.0.1:9000")
+	require.NoError(t, err)
+
+	var route Route
+	require.Equal(t, nethttp.StatusOK, do(t, srv, nethttp.MethodGet, "/admin/routetable/player/blue/1", "", &route))
+	assert.Equal(t, "player", route.Name)
+	assert.Equal(t, int64(1), route.OID)
+	assert.Equal(t, "10.0.0.1:9000", route.Addr)
+	assert.Equal(t, epoch, route.Epoch)
+	assert.Positive(t, route.TTLMs)
+	assert.Equal(t, rt.TTL().Milliseconds(), route.TableTTLMs)
+
+	assert.Equal(t, nethttp.StatusNotFound, do(t, srv, nethttp.MethodGet, "/admin/routetable/player/blue/2", "", nil))
+	assert.Equal(t, nethttp.StatusNotFound, do(t, srv, nethttp.MethodGet, "/admin/routetable/guild/blue/1", "", nil))
+	assert.Equal(t, nethttp.StatusBadRequest, do(t, srv, nethttp.MethodGet, "/admin/routetable/player/blue/x", "", nil))
+}
+
+func TestHandlerList(t *testing.T) {
+	t.Parallel()
+
+	srv, rt := newTestServer(t)
+
+	_, err := rt.BatchSet(context.Background(), "blue", []int64{1, 2}, "10.0.0.1:9000")
+	require.NoError(t, err)
+
+	var reply ListReply
+	require.Equal(t, nethttp.StatusOK, do(t, srv, nethttp.MethodGet, "/admin/routetable/player/blue?addr=10.0.0.1:9000", "", &reply))
+	assert.ElementsMatch(t, []int64{1, 2}, reply.OIDs)
+
+	assert.Equal(t, nethttp.StatusBadRequest, do(t, srv, nethttp.MethodGet, "/admin/routetable/player/blue", "", nil))
+}
+
+func TestHandlerMove(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	srv, rt := newTestServer(t)
+
+	require.NoError(t, rt.Set(ctx, "blue", 1, "10.0.0.1:9000"))
+
+	var reply MoveReply
+	require.Equal(t, nethttp.StatusOK, do(t, srv, nethttp.MethodPut, "/admin/routetable/player/blue/1", `{"addr":"10.0.0.2:9000"}`, &reply))
+	require.NotNil(t, reply.Old)
+	assert.Equal(t, "10.0.0.1:9000", reply.Old.Addr)
+	assert.Equal(t, "10.0.0.2:9000", reply.Cur.Addr)
+
+	addr, epoch, err := rt.GetWithEpoch(ctx, "blue", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2:9000", addr)
+	assert.Equal(t, reply.Cur.Epoch, epoch)
+
+	// a conditional move fails if the route has changed
+	assert.Equal(t, nethttp.StatusConflict,
+		do(t, srv, nethttp.MethodPut, "/admin/routetable/player/blue/1", `{"addr":"10.0.0.3:9000","from":"10.0.0.1:9000"}`, nil))
+	require.Equal(t, nethttp.StatusOK,
+		do(t, srv, nethttp.MethodPut, "/admin/routetable/player/blue/1", `{"addr":"10.0.0.3:9000","from":"10.0.0.2:9000"}`, &reply))
+	require.NotNil(t, reply.Old)
+	assert.Equal(t, "10.0.0.2:9000", reply.Old.Addr)
+	assert.Equal(t, "10.0.0.3:9000", reply.Cur.Addr)
+
+	assert.Equal(t, nethttp.StatusBadRequest, do(t, srv, nethttp.MethodPut, "/admin/routetable/player/blue/1", `{}`, nil))
+}
+
+func TestHandlerEvict(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	srv, rt := newTestServer(t)
+
+	require.NoError(t, rt.Set(ctx, "blue", 1, "10.0.0.1:9000"))
+
+	var route Route
+	require.Equal(t, nethttp.StatusOK, do(t, srv, nethttp.MethodDelete, "/admin/routetable/player/blue/1", "", &route))
+	assert.Equal(t, "10.0.0.1:9000", route.Addr)
+
+	_, err := rt.Get(ctx, "blue", 1)
+	require.Error(t, err)
+
+	assert.Equal(t, nethttp.StatusNotFound, do(t, srv, nethttp.MethodDelete, "/admin/routetable/player/blue/1", "", nil))
+}
+
+// movingRouteTable moves a route to another address right after it is read, like a concurrent takeover.
+type movingRouteTable struct {
+	routetable.MasterRouteTable
+}
+
+func (rt *movingRouteTable) GetEntry(ctx context.Context, color string, oid int64) (routetable.RouteEntry, error) {
+	e, err := rt.MasterRouteTable.GetEntry(ctx, color, oid)
+	if err != nil {
+		return e, err
+	}
+
+	if err := rt.Set(ctx, color, oid, "10.0.0.2:9000"); err != nil {
+		return e, err
+	}
+
+	return e, nil
+}
+
+func TestHandlerEvictChanged(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	mem := memory.New()
+	t.Cleanup(func() { _ = mem.Close() })
+
+	rt := routetable.NewMasterRouteTable(mem, "player")
+
+	srv := http.NewServer()
+	NewHandler(map[string]routetable.MasterRouteTable{"player": &movingRouteTable{MasterRouteTable: rt}}).Register(srv)
+
+	require.NoError(t, rt.Set(ctx, "blue", 1, "10.0.0.1:9000"))
+
+	// the route moved after it was read is not evicted
+	assert.Equal(t, nethttp.StatusConflict, do(t, srv, nethttp.MethodDelete, "/admin/routetable/player/blue/1", "", nil))
+
+	addr, err := rt.Get(ctx, "blue", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2:9000", addr)
+}
@@ -0,0 +1,270 @@
+// Package cache provides a local read-through cache for route tables.
+// Entries are bounded in number and lifetime, not-found results are cached too,
+// and writers invalidate entries through a routetable.Invalidator.
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"github.com/go-pantheon/fabrica-util/xsync"
+)
+
+const (
+	defaultSize         = 10000
+	defaultTTL          = time.Second * 5
+	defaultNegativeTTL  = time.Second
+	resubscribeInterval = time.Second
+)
+
+// Option is a function type that configures a cache instance.
+type Option func(*options)
+
+type options struct {
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	invalidator routetable.Invalidator
+	now         func() time.Time
+}
+
+// WithSize returns an Option that sets the maximum number of cached entries.
+// size must be greater than 0, otherwise the default size will be used.
+func WithSize(size int) Option {
+	return func(o *options) {
+		if size <= 0 {
+			size = defaultSize
+		}
+
+		o.size = size
+	}
+}
+
+// WithTTL returns an Option that sets how long a found route is cached.
+// It bounds the staleness of changes that are not published, such as expirations.
+// dur must be greater than 0, otherwise the default TTL will be used.
+func WithTTL(dur time.Duration) Option {
+	return func(o *options) {
+		if dur <= 0 {
+			dur = defaultTTL
+		}
+
+		o.ttl = dur
+	}
+}
+
+// WithNegativeTTL returns an Option that sets how long a not-found route is cached.
+// A non-positive duration disables negative caching.
+func WithNegativeTTL(dur time.Duration) Option {
+	return func(o *options) {
+		o.negativeTTL = dur
+	}
+}
+
+// WithInvalidator returns an Option that drops the entries whose keys are published by writers.
+// The writers must use the same invalidator with routetable.WithInvalidator.
+func WithInvalidator(inv routetable.Invalidator) Option {
+	return func(o *options) {
+		o.invalidator = inv
+	}
+}
+
+// WithClock returns an Option that replaces the clock used to evaluate expiration.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		if now != nil {
+			o.now = now
+		}
+	}
+}
+
+var _ routetable.ReadOnlyRouteTable = (*RouteTable)(nil)
+
+// RouteTable is a caching decorator of a routetable.ReadOnlyRouteTable.
+type RouteTable struct {
+	routetable.ReadOnlyRouteTable
+
+	store       *store
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	cancel context.CancelFunc
+}
+
+// New creates a caching decorator of rt. If an invalidator is configured,
+// a background subscription is started and Close must be called to stop it.
+func New(rt routetable.ReadOnlyRouteTable, opts ...Option) *RouteTable {
+	o := &options{
+		size:        defaultSize,
+		ttl:         defaultTTL,
+		negativeTTL: defaultNegativeTTL,
+		now:         time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	c := &RouteTable{
+		ReadOnlyRouteTable: rt,
+		store:              newStore(o.size),
+		ttl:                o.ttl,
+		negativeTTL:        o.negativeTTL,
+		now:                o.now,
+		cancel:             func() {},
+	}
+
+	if o.invalidator != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		c.cancel = cancel
+
+		xsync.Go("routetable.cache.subscribe", func() error {
+			c.subscribe(ctx, o.invalidator)
+			return nil
+		})
+	}
+
+	return c
+}
+
+// subscribe keeps a subscription to inv until ctx is done.
+// Invalidations may be lost while it is down, so the cache is purged before resubscribing.
+func (c *RouteTable) subscribe(ctx context.Context, inv routetable.Invalidator) {
+	for {
+		err := inv.Subscribe(ctx, c.Invalidate)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Warnf("route table cache subscription stopped, resubscribing. err=%+v", err)
+		c.Purge()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeInterval):
+		}
+	}
+}
+
+// Close stops the invalidation subscription.
+func (c *RouteTable) Close() error {
+	c.cancel()
+	return nil
+}
+
+// Invalidate drops the cached entry of key, or every entry if key is routetable.InvalidateAll.
+func (c *RouteTable) Invalidate(key string) {
+	if key == routetable.InvalidateAll {
+		c.Purge()
+		return
+	}
+
+	c.store.remove(key)
+}
+
+// Purge drops every cached entry.
+func (c *RouteTable) Purge() {
+	c.store.purge()
+}
+
+// Len returns the number of cached entries, including expired ones not yet evicted.
+func (c *RouteTable) Len() int {
+	return c.store.len()
+}
+
+// Get retrieves a routing entry from the cache, loading it from the route table on a miss.
+func (c *RouteTable) Get(ctx context.Context, color string, oid int64) (string, error) {
+	key := c.BuildKey(color, oid)
+
+	if it, ok := c.store.get(key, c.now()); ok {
+		if !it.found {
+			return "", xerrors.ErrRouteTableNotFoundFunc(key)
+		}
+
+		return it.addr, nil
+	}
+
+	gen := c.store.begin()
+	defer c.store.end(gen)
+
+	addr, err := c.ReadOnlyRouteTable.Get(ctx, color, oid)
+	if err != nil {
+		if errors.Is(err, xerrors.ErrRouteTableNotFound) {
+			c.addNegative(key, gen)
+		}
+
+		return "", err
+	}
+
+	c.store.add(key, addr, true, c.now().Add(c.ttl), gen)
+
+	return addr, nil
+}
+
+// BatchGet retrieves routing entries from the cache, loading all misses from the route table at once.
+func (c *RouteTable) BatchGet(ctx context.Context, color string, oids []int64) ([]string, error) {
+	var (
+		now      = c.now()
+		addrs    = make([]string, len(oids))
+		keys     = make([]string, len(oids))
+		missOIDs []int64
+		missIdx  []int
+	)
+
+	for i, oid := range oids {
+		keys[i] = c.BuildKey(color, oid)
+
+		if it, ok := c.store.get(keys[i], now); ok {
+			addrs[i] = it.addr
+			continue
+		}
+
+		missOIDs = append(missOIDs, oid)
+		missIdx = append(missIdx, i)
+	}
+
+	if len(missOIDs) == 0 {
+		return addrs, nil
+	}
+
+	gen := c.store.begin()
+	defer c.store.end(gen)
+
+	loaded, err := c.ReadOnlyRouteTable.BatchGet(ctx, color, missOIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(loaded) != len(missOIDs) {
+		return nil, errors.Errorf("batch get returned %d routes for %d oids", len(loaded), len(missOIDs))
+	}
+
+	expireAt := c.now().Add(c.ttl)
+
+	for j, addr := range loaded {
+		i := missIdx[j]
+		addrs[i] = addr
+
+		if addr == "" {
+			c.addNegative(keys[i], gen)
+		} else {
+			c.store.add(keys[i], addr, true, expireAt, gen)
+		}
+	}
+
+	return addrs, nil
+}
+
+func (c *RouteTable) addNegative(key string, gen uint64) {
+	if c.negativeTTL <= 0 {
+		return
+	}
+
+	c.store.add(key, "", false, c.now().Add(c.negativeTTL), gen)
+}
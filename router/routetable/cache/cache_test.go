@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/internal/testclock"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/memory"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testName  = "player"
+	testColor = "blue"
+)
+
+// countingData counts the reads that reach the data store.
+type countingData struct {
+	*memory.RouteTable
+
+	gets atomic.Int64
+}
+
+func (d *countingData) Get(ctx context.Context, key string) (string, error) {
+	d.gets.Add(1)
+	return d.RouteTable.Get(ctx, key)
+}
+
+func (d *countingData) BatchGet(ctx context.Context, keys []string) ([]string, error) {
+	d.gets.Add(int64(len(keys)))
+	return d.RouteTable.BatchGet(ctx, keys)
+}
+
+func newTestData(t *testing.T) *countingData {
+	t.Helper()
+
+	data := &countingData{RouteTable: memory.New()}
+	t.Cleanup(func() {
+		_ = data.Close()
+	})
+
+	return data
+}
+
+func TestGetCachesFoundAndNotFound(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	data := newTestData(t)
+	writer := routetable.NewMasterRouteTable(data, testName)
+	clock := testclock.New(time.Now())
+
+	c := New(routetable.NewReadOnlyRouteTable(data, testName),
+		WithTTL(time.Second), WithNegativeTTL(time.Millisecond*100), WithClock(clock.Now))
+
+	require.NoError(t, writer.Set(ctx, testColor, 1, "10.0.0.1:9000"))
+	// Set reads the previous owner to assign the epoch
+	data.gets.Store(0)
+
+	for range 3 {
+		addr, err := c.Get(ctx, testColor, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1:9000", addr)
+
+		_, err = c.Get(ctx, testColor, 2)
+		require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+	}
+
+	assert.Equal(t, int64(2), data.gets.Load())
+
+	clock.Advance(time.Millisecond * 100)
+
+	_, err := c.Get(ctx, testColor, 2)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+	assert.Equal(t, int64(3), data.gets.Load())
+
+	clock.Advance(time.Second)
+
+	_, err = c.Get(ctx, testColor, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), data.gets.Load())
+}
+
+func TestBatchGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	data := newTestData(t)
+	writer := routetable.NewMasterRouteTable(data, testName)
+	c := New(routetable.NewReadOnlyRouteTable(data, testName))
+
+	require.NoError(t, writer.Set(ctx, testColor, 1, "a"))
+	require.NoError(t, writer.Set(ctx, testColor, 3, "c"))
+	data.gets.Store(0)
+
+	addr, err := c.Get(ctx, testColor, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "c", addr)
+
+	addrs, err := c.BatchGet(ctx, testColor, []int64{1, 2, 3})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "", "c"}, addrs)
+	assert.Equal(t, int64(3), data.gets.Load())
+
+	addrs, err = c.BatchGet(ctx, testColor, []int64{3, 2, 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "", "a"}, addrs)
+	assert.Equal(t, int64(3), data.gets.Load())
+}
+
+func TestInvalidation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	data := newTestData(t)
+	inv := memory.NewInvalidator()
+	writer := routetable.NewMasterRouteTable(data, testName, routetable.WithInvalidator(inv))
+
+	c := New(routetable.NewReadOnlyRouteTable(data, testName), WithTTL(time.Hour), WithInvalidator(inv))
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+
+	_, err := c.Get(ctx, testColor, 1)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	// the subscription is established once a published key reaches the cache
+	warmup := routetable.Key(testName, testColor, 99)
+	require.NoError(t, data.Set(ctx, warmup, "x", 0))
+
+	addr, err := c.Get(ctx, testColor, 99)
+	require.NoError(t, err)
+	require.Equal(t, "x", addr)
+
+	require.NoError(t, data.Set(ctx, warmup, "y", 0))
+
+	require.Eventually(t, func() bool {
+		_ = inv.Publish(ctx, warmup)
+
+		addr, err := c.Get(ctx, testColor, 99)
+		return err == nil && addr == "y"
+	}, time.Second, time.Millisecond*10)
+
+	ok, _, _, err := writer.SetNxOrGet(ctx, testColor, 1, "a")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	addr, err = c.Get(ctx, testColor, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "a", addr)
+
+	_, epoch, err := writer.GetSet(ctx, testColor, 1, "b")
+	require.NoError(t, err)
+
+	addr, err = c.Get(ctx, testColor, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "b", addr)
+
+	require.NoError(t, writer.DelIfSame(ctx, testColor, 1, "b", epoch))
+
+	_, err = c.Get(ctx, testColor, 1)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+}
+
+func TestMasterReadsOwnWrites(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	data := newTestData(t)
+	m := NewMaster(routetable.NewMasterRouteTable(data, testName), WithTTL(time.Hour), WithNegativeTTL(time.Hour))
+
+	_, err := m.Get(ctx, testColor, 1)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	ok, _, _, err := m.SetNxOrGet(ctx, testColor, 1, "a")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	addr, err := m.Get(ctx, testColor, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "a", addr)
+
+	require.NoError(t, m.Del(ctx, testColor, 1))
+
+	_, err = m.Get(ctx, testColor, 1)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+}
+
+func TestSizeBound(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	data := newTestData(t)
+	c := New(routetable.NewReadOnlyRouteTable(data, testName), WithSize(2))
+
+	for oid := range int64(5) {
+		_, err := c.Get(ctx, testColor, oid)
+		require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+	}
+
+	assert.Equal(t, 2, c.Len())
+
+	// the most recently used entries are kept
+	_, err := c.Get(ctx, testColor, 4)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+	assert.Equal(t, int64(5), data.gets.Load())
+}
+
+func TestStoreDropsRacedFills(t *testing.T) {
+	t.Parallel()
+
+	var (
+		s        = newStore(10)
+		now      = time.Unix(1700000000, 0)
+		expireAt = now.Add(time.Hour)
+	)
+
+	gen := s.begin()
+
+	// the invalidation of another key does not drop the load, while the invalidation of its key does
+	s.remove("b")
+	s.add("a", "x", true, expireAt, gen)
+	s.remove("c")
+	s.add("c", "y", true, expireAt, gen)
+
+	// a load that starts after the invalidation is stored
+	next := s.begin()
+	s.add("c", "z", true, expireAt, next)
+	s.end(next)
+	s.end(gen)
+
+	it, ok := s.get("a", now)
+	require.True(t, ok)
+	assert.Equal(t, "x", it.addr)
+
+	it, ok = s.get("c", now)
+	require.True(t, ok)
+	assert.Equal(t, "z", it.addr)
+	assert.Empty(t, s.tombstones)
+
+	gen = s.begin()
+	s.purge()
+	s.add("a", "x", true, expireAt, gen)
+	s.end(gen)
+
+	assert.Equal(t, 0, s.len())
+}
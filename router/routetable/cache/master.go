@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+)
+
+var _ routetable.MasterRouteTable = (*MasterRouteTable)(nil)
+
+// MasterRouteTable is a caching decorator of a routetable.MasterRouteTable.
+// Reads are served by the cache and every write drops the local entry when it returns,
+// so the process always reads its own writes without waiting for the invalidator.
+type MasterRouteTable struct {
+	routetable.MasterRouteTable
+
+	cache *RouteTable
+}
+
+// NewMaster creates a caching decorator of rt.
+// If an invalidator is configured, Close must be called to stop its subscription.
+func NewMaster(rt routetable.MasterRouteTable, opts ...Option) *MasterRouteTable {
+	return &MasterRouteTable{
+		MasterRouteTable: rt,
+		cache:            New(rt, opts...),
+	}
+}
+
+// Close stops the invalidation subscription.
+func (m *MasterRouteTable) Close() error {
+	return m.cache.Close()
+}
+
+// Invalidate drops the cached entry of key.
+func (m *MasterRouteTable) Invalidate(key string) {
+	m.cache.Invalidate(key)
+}
+
+// Purge drops every cached entry.
+func (m *MasterRouteTable) Purge() {
+	m.cache.Purge()
+}
+
+// Get retrieves a routing entry from the cache, loading it from the route table on a miss.
+func (m *MasterRouteTable) Get(ctx context.Context, color string, oid int64) (string, error) {
+	return m.cache.Get(ctx, color, oid)
+}
+
+// BatchGet retrieves routing entries from the cache, loading all misses from the route table at once.
+func (m *MasterRouteTable) BatchGet(ctx context.Context, color string, oids []int64) ([]string, error) {
+	return m.cache.BatchGet(ctx, color, oids)
+}
+
+// Set stores a routing entry and drops its cached entry.
+func (m *MasterRouteTable) Set(ctx context.Context, color string, oid int64, addr string) error {
+	defer m.invalidate(color, oid)
+
+	return m.MasterRouteTable.Set(ctx, color, oid, addr)
+}
+
+// GetSet swaps a routing entry and drops its cached entry.
+func (m *MasterRouteTable) GetSet(ctx context.Context, color string, oid int64, addr string) (string, uint64, error) {
+	defer m.invalidate(color, oid)
+
+	return m.MasterRouteTable.GetSet(ctx, color, oid, addr)
+}
+
+// SetNxOrGet sets a routing entry if it does not exist and drops its cached entry.
+func (m *MasterRouteTable) SetNxOrGet(ctx context.Context, color string, oid int64, addr string) (bool, string, uint64, error) {
+	defer m.invalidate(color, oid)
+
+	return m.MasterRouteTable.SetNxOrGet(ctx, color, oid, addr)
+}
+
+// GetSetEntry swaps a routing entry and drops its cached entry.
+func (m *MasterRouteTable) GetSetEntry(ctx context.Context, color string, oid int64, e routetable.RouteEntry) (routetable.RouteEntry, routetable.RouteEntry, error) {
+	defer m.invalidate(color, oid)
+
+	return m.MasterRouteTable.GetSetEntry(ctx, color, oid, e)
+}
+
+// SetNxOrGetEntry sets a routing entry if it does not exist and drops its cached entry.
+func (m *MasterRouteTable) SetNxOrGetEntry(ctx context.Context, color string, oid int64, e routetable.RouteEntry) (bool, routetable.RouteEntry, error) {
+	defer m.invalidate(color, oid)
+
+	return m.MasterRouteTable.SetNxOrGetEntry(ctx, color, oid, e)
+}
+
+// CompareAndSwap moves a routing entry if it is still routed to old and drops its cached entry.
+func (m *MasterRouteTable) CompareAndSwap(ctx context.Context, color string, oid int64, old, addr string) (uint64, error) {
+	defer m.invalidate(color, oid)
+
+	return m.MasterRouteTable.CompareAndSwap(ctx, color, oid, old, addr)
+}
+
+// BatchSet stores routing entries and drops their cached entries.
+func (m *MasterRouteTable) BatchSet(ctx context.Context, color string, oids []int64, addr string) ([]error, error) {
+	defer m.invalidateAll(color, oids)
+
+	return m.MasterRouteTable.BatchSet(ctx, color, oids, addr)
+}
+
+// BatchSetNxOrGet sets routing entries that do not exist and drops their cached entries.
+func (m *MasterRouteTable) BatchSetNxOrGet(ctx context.Context, color string, oids []int64, addr string) ([]routetable.SetNxOrGetResult, error) {
+	defer m.invalidateAll(color, oids)
+
+	return m.MasterRouteTable.BatchSetNxOrGet(ctx, color, oids, addr)
+}
+
+// Del deletes a routing entry and drops its cached entry.
+func (m *MasterRouteTable) Del(ctx context.Context, color string, oid int64) error {
+	defer m.invalidate(color, oid)
+
+	return m.MasterRouteTable.Del(ctx, color, oid)
+}
+
+// DelDelay marks a routing entry for delayed deletion and drops its cached entry.
+func (m *MasterRouteTable) DelDelay(ctx context.Context, color string, oid int64, delay time.Duration) error {
+	defer m.invalidate(color, oid)
+
+	return m.MasterRouteTable.DelDelay(ctx, color, oid, delay)
+}
+
+// DelIfSame deletes a routing entry if it matches value and drops its cached entry.
+func (m *MasterRouteTable) DelIfSame(ctx context.Context, color string, oid int64, value string, epoch uint64) error {
+	defer m.invalidate(color, oid)
+
+	return m.MasterRouteTable.DelIfSame(ctx, color, oid, value, epoch)
+}
+
+// BatchDelIfSame deletes routing entries that match value and drops their cached entries.
+func (m *MasterRouteTable) BatchDelIfSame(ctx context.Context, color string, oids []int64, value string, epochs []uint64) ([]error, error) {
+	defer m.invalidateAll(color, oids)
+
+	return m.MasterRouteTable.BatchDelIfSame(ctx, color, oids, value, epochs)
+}
+
+// DelDelayIfSame marks a routing entry for delayed deletion if it matches value and drops its cached entry.
+func (m *MasterRouteTable) DelDelayIfSame(ctx context.Context, color string, oid int64, value string, epoch uint64, delay time.Duration) error {
+	defer m.invalidate(color, oid)
+
+	return m.MasterRouteTable.DelDelayIfSame(ctx, color, oid, value, epoch, delay)
+}
+
+// Drain moves the routing entries of fromAddr and drops every cached entry when it returns.
+func (m *MasterRouteTable) Drain(ctx context.Context, color, fromAddr string, picker routetable.DrainPicker, opts ...routetable.DrainOption) (routetable.DrainProgress, error) {
+	defer m.Purge()
+
+	return m.MasterRouteTable.Drain(ctx, color, fromAddr, picker, opts...)
+}
+
+// Restore stores entries and drops their cached entries.
+func (m *MasterRouteTable) Restore(ctx context.Context, entries []routetable.Entry) error {
+	defer func() {
+		for _, e := range entries {
+			m.invalidate(e.Color, e.OID)
+		}
+	}()
+
+	return m.MasterRouteTable.Restore(ctx, entries)
+}
+
+func (m *MasterRouteTable) invalidate(color string, oid int64) {
+	m.cache.Invalidate(m.BuildKey(color, oid))
+}
+
+func (m *MasterRouteTable) invalidateAll(color string, oids []int64) {
+	for _, oid := range oids {
+		m.invalidate(color, oid)
+	}
+}
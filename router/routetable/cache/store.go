@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type item struct {
+	key      string
+	addr     string
+	found    bool
+	expireAt time.Time
+}
+
+// store is a size-bounded LRU of route table entries.
+// Every removal increments a generation, and a load records the generation it starts at.
+// While loads are in flight, a removed key keeps a tombstone with the generation of its removal,
+// so that a load which raced with the invalidation of its key is not stored, while the loads
+// of other keys are.
+type store struct {
+	mu    sync.Mutex
+	size  int
+	gen   uint64
+	ll    *list.List
+	items map[string]*list.Element
+	// tombstones holds the generation of the last removal of the keys removed while loads were in flight.
+	tombstones map[string]uint64
+	// purged is the generation of the last purge.
+	purged uint64
+	// loads counts the loads in flight by the generation they started at.
+	loads map[uint64]int
+}
+
+func newStore(size int) *store {
+	return &store{
+		size:       size,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element, size),
+		tombstones: make(map[string]uint64),
+		loads:      make(map[uint64]int),
+	}
+}
+
+func (s *store) get(key string, now time.Time) (item, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.items[key]
+	if !ok {
+		return item{}, false
+	}
+
+	it := e.Value.(*item)
+	if !now.Before(it.expireAt) {
+		s.ll.Remove(e)
+		delete(s.items, key)
+
+		return item{}, false
+	}
+
+	s.ll.MoveToFront(e)
+
+	return *it, true
+}
+
+// begin starts a load and returns its generation, which must be passed to add and end.
+func (s *store) begin() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loads[s.gen]++
+
+	return s.gen
+}
+
+// end finishes a load started at generation gen. The tombstones are dropped once no load
+// can be older than them.
+func (s *store) end(gen uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.loads[gen]--; s.loads[gen] <= 0 {
+		delete(s.loads, gen)
+	}
+
+	if len(s.loads) == 0 {
+		clear(s.tombstones)
+		return
+	}
+
+	if len(s.tombstones) <= s.size {
+		return
+	}
+
+	oldest := s.gen
+	for g := range s.loads {
+		oldest = min(oldest, g)
+	}
+
+	for key, g := range s.tombstones {
+		if g <= oldest {
+			delete(s.tombstones, key)
+		}
+	}
+}
+
+// add stores an entry loaded by a load started at generation gen.
+// It is dropped if the key has been removed or the store purged since.
+func (s *store) add(key, addr string, found bool, expireAt time.Time, gen uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.purged > gen || s.tombstones[key] > gen {
+		return
+	}
+
+	if e, ok := s.items[key]; ok {
+		it := e.Value.(*item)
+		it.addr, it.found, it.expireAt = addr, found, expireAt
+		s.ll.MoveToFront(e)
+
+		return
+	}
+
+	s.items[key] = s.ll.PushFront(&item{key: key, addr: addr, found: found, expireAt: expireAt})
+
+	for s.ll.Len() > s.size {
+		e := s.ll.Back()
+		s.ll.Remove(e)
+		delete(s.items, e.Value.(*item).key)
+	}
+}
+
+func (s *store) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gen++
+
+	if len(s.loads) > 0 {
+		s.tombstones[key] = s.gen
+	}
+
+	if e, ok := s.items[key]; ok {
+		s.ll.Remove(e)
+		delete(s.items, key)
+	}
+}
+
+func (s *store) purge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gen++
+	s.purged = s.gen
+	s.ll.Init()
+	s.items = make(map[string]*list.Element, s.size)
+	clear(s.tombstones)
+}
+
+func (s *store) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ll.Len()
+}
@@ -0,0 +1,220 @@
+package routetable
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-pantheon/fabrica-util/errors"
+)
+
+// ErrInvalidKey is returned when a key cannot be decoded by a KeyCodec.
+var ErrInvalidKey = errors.New("invalid route table key")
+
+// KeyCodec encodes the coordinates of a routing entry into a data store key and decodes them back.
+type KeyCodec interface {
+	Encode(name, color string, oid int64) string
+	Decode(key string) (name, color string, oid int64, err error)
+	// Pattern returns a glob pattern matching the keys of every oid of name and color.
+	Pattern(name, color string) string
+}
+
+var (
+	// V1KeyCodec builds versioned keys in the form r1:<name>:<color>:{<oid>}.
+	// Separators in name and color are escaped, and the oid is the only Redis Cluster hash tag.
+	// It is the only codec that decodes every name and color, whatever separators they contain.
+	// It is opt-in with WithKeyCodec, as the routes stored with legacy keys are not visible through it.
+	V1KeyCodec KeyCodec = v1KeyCodec{}
+	// LegacyKeyCodec builds and parses keys with Key and SplitKey. It is the default codec of the route tables.
+	// Separators are not escaped, so Decode returns ErrInvalidKey if the name contains "_{"
+	// or the color contains a brace, as the key can then be split in several ways.
+	LegacyKeyCodec KeyCodec = legacyKeyCodec{}
+	// LegacyClusterKeyCodec builds and parses keys with ClusterKey and SplitKey.
+	// The name and the color are only separated by an underscore, so Decode returns ErrInvalidKey
+	// if either contains one, such as the color feat_a, as the key can then be split in several ways.
+	LegacyClusterKeyCodec KeyCodec = legacyClusterKeyCodec{}
+)
+
+const (
+	legacyKeyPrefix = "r_"
+	v1KeyPrefix     = "r1:"
+)
+
+// DecodeKey decodes a key of any known format by its version prefix.
+// It allows keys written by a previous codec to be read while a route table migrates to a new one.
+func DecodeKey(key string) (name, color string, oid int64, err error) {
+	switch {
+	case strings.HasPrefix(key, v1KeyPrefix):
+		return V1KeyCodec.Decode(key)
+	case strings.HasPrefix(key, legacyKeyPrefix):
+		if name, color, oid, err = LegacyKeyCodec.Decode(key); err == nil {
+			return name, color, oid, nil
+		}
+
+		return LegacyClusterKeyCodec.Decode(key)
+	default:
+		return "", "", 0, errors.WithMessagef(ErrInvalidKey, "unknown key version. key=%s", key)
+	}
+}
+
+type legacyKeyCodec struct{}
+
+func (legacyKeyCodec) Encode(name, color string, oid int64) string {
+	return Key(name, color, oid)
+}
+
+func (c legacyKeyCodec) Decode(key string) (name, color string, oid int64, err error) {
+	return decodeLegacyKey(c, key, func(name, color string) bool {
+		return strings.Contains(name, "_{") || strings.ContainsAny(color, "{}")
+	})
+}
+
+func (legacyKeyCodec) Pattern(name, color string) string {
+	return EscapePattern(legacyKeyPrefix+name+"_{"+color+"}_{") + "*}"
+}
+
+type legacyClusterKeyCodec struct{}
+
+func (legacyClusterKeyCodec) Encode(name, color string, oid int64) string {
+	return ClusterKey(name, color, oid)
+}
+
+func (c legacyClusterKeyCodec) Decode(key string) (name, color string, oid int64, err error) {
+	return decodeLegacyKey(c, key, func(name, color string) bool {
+		return strings.Contains(name, "_") || strings.Contains(color, "_")
+	})
+}
+
+// decodeLegacyKey splits key with SplitKey. It returns ErrInvalidKey if codec does not encode
+// the parts back into key, which is then in another format, or if ambiguous reports that the parts
+// contain separators, which would let another split encode into the same key.
+func decodeLegacyKey(codec KeyCodec, key string, ambiguous func(name, color string) bool) (name, color string, oid int64, err error) {
+	if name, color, oid, err = SplitKey(key); err != nil {
+		return "", "", 0, err
+	}
+
+	if codec.Encode(name, color, oid) != key {
+		return "", "", 0, errors.WithMessagef(ErrInvalidKey, "key of another format. key=%s", key)
+	}
+
+	if ambiguous(name, color) {
+		return "", "", 0, errors.WithMessagef(ErrInvalidKey, "ambiguous separators. key=%s", key)
+	}
+
+	return name, color, oid, nil
+}
+
+func (legacyClusterKeyCodec) Pattern(name, color string) string {
+	return EscapePattern(legacyKeyPrefix+name+"_"+color+"_{") + "*}"
+}
+
+type v1KeyCodec struct{}
+
+func (v1KeyCodec) Encode(name, color string, oid int64) string {
+	var b strings.Builder
+
+	b.Grow(len(v1KeyPrefix) + len(name) + len(color) + 24)
+	b.WriteString(v1KeyPrefix)
+	escapeKeyPart(&b, name)
+	b.WriteByte(':')
+	escapeKeyPart(&b, color)
+	b.WriteString(":{")
+	b.WriteString(strconv.FormatInt(oid, 10))
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+func (v1KeyCodec) Pattern(name, color string) string {
+	var b strings.Builder
+
+	b.WriteString(v1KeyPrefix)
+	escapeKeyPart(&b, name)
+	b.WriteByte(':')
+	escapeKeyPart(&b, color)
+	b.WriteString(":{")
+
+	return EscapePattern(b.String()) + "*}"
+}
+
+func (v1KeyCodec) Decode(key string) (name, color string, oid int64, err error) {
+	rest, ok := strings.CutPrefix(key, v1KeyPrefix)
+	if !ok {
+		return "", "", 0, errors.WithMessagef(ErrInvalidKey, "key=%s", key)
+	}
+
+	parts := strings.Split(rest, ":")
+	if len(parts) != 3 {
+		return "", "", 0, errors.WithMessagef(ErrInvalidKey, "key=%s", key)
+	}
+
+	oidStr, ok := strings.CutPrefix(parts[2], "{")
+	if !ok {
+		return "", "", 0, errors.WithMessagef(ErrInvalidKey, "key=%s", key)
+	}
+
+	if oidStr, ok = strings.CutSuffix(oidStr, "}"); !ok {
+		return "", "", 0, errors.WithMessagef(ErrInvalidKey, "key=%s", key)
+	}
+
+	if oid, err = strconv.ParseInt(oidStr, 10, 64); err != nil {
+		return "", "", 0, errors.WithMessagef(ErrInvalidKey, "key=%s err=%s", key, err)
+	}
+
+	if name, err = unescapeKeyPart(parts[0]); err != nil {
+		return "", "", 0, errors.WithMessagef(err, "key=%s", key)
+	}
+
+	if color, err = unescapeKeyPart(parts[1]); err != nil {
+		return "", "", 0, errors.WithMessagef(err, "key=%s", key)
+	}
+
+	return name, color, oid, nil
+}
+
+const hexDigits = "0123456789ABCDEF"
+
+// escapeKeyPart percent-encodes the bytes that have a meaning in a v1 key.
+func escapeKeyPart(b *strings.Builder, s string) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '%', ':', '{', '}':
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&0xF])
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func unescapeKeyPart(s string) (string, error) {
+	if !strings.Contains(s, "%") {
+		return s, nil
+	}
+
+	var b strings.Builder
+
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		if i+2 >= len(s) {
+			return "", errors.WithMessagef(ErrInvalidKey, "truncated escape in %q", s)
+		}
+
+		c, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", errors.WithMessagef(ErrInvalidKey, "invalid escape in %q", s)
+		}
+
+		b.WriteByte(byte(c))
+
+		i += 2
+	}
+
+	return b.String(), nil
+}
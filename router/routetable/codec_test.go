@@ -0,0 +1,122 @@
+package routetable
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestV1KeyCodec(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		color string
+		oid   int64
+		key   string
+	}{
+		{name: "player", color: "blue", oid: 42, key: "r1:player:blue:{42}"},
+		{name: "player_v2", color: "feature_x", oid: -1, key: "r1:player_v2:feature_x:{-1}"},
+		{name: "a:b", color: "{c}", oid: 1, key: "r1:a%3Ab:%7Bc%7D:{1}"},
+		{name: "100%", color: "", oid: 0, key: "r1:100%25::{0}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Parallel()
+
+			key := V1KeyCodec.Encode(tt.name, tt.color, tt.oid)
+			assert.Equal(t, tt.key, key)
+
+			name, color, oid, err := V1KeyCodec.Decode(key)
+			require.NoError(t, err)
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.color, color)
+			assert.Equal(t, tt.oid, oid)
+		})
+	}
+
+	for _, key := range []string{"", "r1:a:b", "r1:a:b:1", "r1:a:b:{x}", "r1:a%:b:{1}", "r1:a%zz:b:{1}", "r_a_{b}_{1}"} {
+		_, _, _, err := V1KeyCodec.Decode(key)
+		require.ErrorIs(t, err, ErrInvalidKey, key)
+	}
+}
+
+func TestDecodeKey(t *testing.T) {
+	t.Parallel()
+
+	for _, codec := range []KeyCodec{V1KeyCodec, LegacyKeyCodec, LegacyClusterKeyCodec} {
+		key := codec.Encode("player", "blue", 42)
+
+		name, color, oid, err := DecodeKey(key)
+		require.NoError(t, err, key)
+		assert.Equal(t, "player", name)
+		assert.Equal(t, "blue", color)
+		assert.Equal(t, int64(42), oid)
+	}
+
+	_, _, _, err := DecodeKey("x:player:blue:{42}")
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestLegacyKeyCodecs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		codec KeyCodec
+		name  string
+		color string
+		// ambiguous reports whether the key can be split in several ways
+		ambiguous bool
+	}{
+		{codec: LegacyKeyCodec, name: "player_v2", color: "feat_a"},
+		{codec: LegacyKeyCodec, name: "player_{v2}", color: "blue", ambiguous: true},
+		{codec: LegacyKeyCodec, name: "player", color: "b}_{lue", ambiguous: true},
+		{codec: LegacyClusterKeyCodec, name: "player", color: "blue"},
+		{codec: LegacyClusterKeyCodec, name: "player", color: "feat_a", ambiguous: true},
+		{codec: LegacyClusterKeyCodec, name: "player_v2", color: "blue", ambiguous: true},
+	}
+
+	for _, tt := range tests {
+		key := tt.codec.Encode(tt.name, tt.color, 42)
+
+		name, color, oid, err := tt.codec.Decode(key)
+		if tt.ambiguous {
+			require.ErrorIs(t, err, ErrInvalidKey, key)
+			continue
+		}
+
+		require.NoError(t, err, key)
+		assert.Equal(t, tt.name, name)
+		assert.Equal(t, tt.color, color)
+		assert.Equal(t, int64(42), oid)
+	}
+
+	// the keys of the other legacy format
+	_, _, _, err := LegacyKeyCodec.Decode(ClusterKey("player", "blue", 42))
+	require.ErrorIs(t, err, ErrInvalidKey)
+
+	_, _, _, err = LegacyClusterKeyCodec.Decode(Key("player", "blue", 42))
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestWithKeyCodec(t *testing.T) {
+	t.Parallel()
+
+	// existing deployments keep their legacy keys unless they opt in to versioned keys
+	rt := NewReadOnlyRouteTable(nil, "player")
+	assert.Equal(t, "r_player_{blue}_{42}", rt.BuildKey("blue", 42))
+
+	rt = NewReadOnlyRouteTable(nil, "player", WithKeyCodec(V1KeyCodec))
+	assert.Equal(t, "r1:player:blue:{42}", rt.BuildKey("blue", 42))
+
+	rt = NewReadOnlyRouteTable(nil, "player", WithKeyCodec(nil))
+	assert.Equal(t, "r_player_{blue}_{42}", rt.BuildKey("blue", 42))
+}
+
+func TestAddrIndexKey(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "ra1:player:blue:{10.0.0.1%3A9000}", AddrIndexKey("player", "blue", "10.0.0.1:9000"))
+}
@@ -0,0 +1,181 @@
+package routetable
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+)
+
+const (
+	defaultDrainBatchSize = 100
+	defaultDrainInterval  = time.Millisecond * 100
+)
+
+// DrainPicker returns the address that the routing entry of (color, oid) is moved to.
+// Returning an empty address or fromAddr leaves the route in place and counts it as failed,
+// and returning an error stops the drain.
+type DrainPicker func(ctx context.Context, color string, oid int64) (addr string, err error)
+
+// DrainProgress is the progress of a drain.
+type DrainProgress struct {
+	// Moved is the number of routes moved to another address.
+	Moved int
+	// Skipped is the number of routes that were changed concurrently and no longer belong to the drained address.
+	Skipped int
+	// Failed is the number of routes that could not be moved and are left on the drained address.
+	Failed int
+}
+
+// DrainOption is a function type that configures a drain.
+type DrainOption func(*drainOptions)
+
+type drainOptions struct {
+	batchSize  int
+	interval   time.Duration
+	onProgress func(DrainProgress)
+}
+
+// WithDrainBatchSize returns a DrainOption that sets the number of routes moved per batch.
+// size must be greater than 0, otherwise the default size will be used.
+func WithDrainBatchSize(size int) DrainOption {
+	return func(o *drainOptions) {
+		if size <= 0 {
+			size = defaultDrainBatchSize
+		}
+
+		o.batchSize = size
+	}
+}
+
+// WithDrainInterval returns a DrainOption that sets the minimum interval between two batches,
+// which limits the rate of the drain. A non-positive interval disables the limit.
+func WithDrainInterval(dur time.Duration) DrainOption {
+	return func(o *drainOptions) {
+		o.interval = dur
+	}
+}
+
+// WithDrainProgress returns a DrainOption that sets a callback called with the accumulated progress after every batch.
+func WithDrainProgress(fn func(DrainProgress)) DrainOption {
+	return func(o *drainOptions) {
+		o.onProgress = fn
+	}
+}
+
+// Drain moves every route of color owned by fromAddr to the address returned by picker.
+//
+// Routes are listed with ListByAddr, so an AddrIndex is required, and moved in batches of assignments
+// conditioned on fromAddr, so a route that changes owner concurrently is skipped instead of overwritten.
+// Moved routes leave the index of fromAddr, which makes the drain resumable: if it is interrupted
+// or some routes fail, running it again continues with the routes that are still owned by fromAddr.
+// The drain stops with the error of ctx before the next batch once ctx is done.
+func (r *masterRouteTable) Drain(ctx context.Context, color, fromAddr string, picker DrainPicker, opts ...DrainOption) (DrainProgress, error) {
+	o := &drainOptions{
+		batchSize: defaultDrainBatchSize,
+		interval:  defaultDrainInterval,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var (
+		progress DrainProgress
+		limit    <-chan time.Time
+	)
+
+	if o.interval > 0 {
+		ticker := time.NewTicker(o.interval)
+		defer ticker.Stop()
+
+		limit = ticker.C
+	}
+
+	var cursor uint64
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+
+		oids, next, err := r.ListByAddr(ctx, color, fromAddr, cursor, int64(o.batchSize))
+		if err != nil {
+			return progress, errors.WithMessagef(err, "drain route table failed. color=%s addr=%s", color, fromAddr)
+		}
+
+		if len(oids) > 0 {
+			if err := r.drainBatch(ctx, color, fromAddr, oids, picker, &progress); err != nil {
+				return progress, err
+			}
+
+			if o.onProgress != nil {
+				o.onProgress(progress)
+			}
+		}
+
+		if next == 0 {
+			return progress, nil
+		}
+
+		cursor = next
+
+		if limit == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return progress, ctx.Err()
+		case <-limit:
+		}
+	}
+}
+
+// drainBatch moves oids from fromAddr with new epochs if they are still routed to fromAddr.
+func (r *masterRouteTable) drainBatch(ctx context.Context, color, fromAddr string, oids []int64, picker DrainPicker, progress *DrainProgress) error {
+	keys := make([]string, 0, len(oids))
+	olds := make([]string, 0, len(oids))
+	news := make([]string, 0, len(oids))
+
+	for _, oid := range oids {
+		addr, err := picker(ctx, color, oid)
+		if err != nil {
+			return errors.WithMessagef(err, "pick drain address failed. color=%s oid=%d", color, oid)
+		}
+
+		if addr == "" || addr == fromAddr {
+			progress.Failed++
+			continue
+		}
+
+		keys = append(keys, r.BuildKey(color, oid))
+		olds = append(olds, fromAddr)
+		news = append(news, r.assignment(RouteEntry{Addr: addr}))
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	results, err := r.data.BatchAssign(ctx, AssignIfAddr, keys, olds, news, r.TTL())
+	if err != nil {
+		return errors.WithMessagef(err, "drain route table failed. color=%s addr=%s", color, fromAddr)
+	}
+
+	for i, ret := range results {
+		switch err := ret.Err; {
+		case err == nil:
+			progress.Moved++
+
+			r.invalidate(ctx, keys[i])
+		case errors.Is(err, xerrors.ErrRouteTableNotFound), errors.Is(err, xerrors.ErrRouteTableValueNotSame):
+			progress.Skipped++
+		default:
+			progress.Failed++
+		}
+	}
+
+	return nil
+}
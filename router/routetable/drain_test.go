@@ -0,0 +1,133 @@
+package routetable_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+
+	const from, to1, to2 = "10.0.0.1:9000", "10.0.0.2:9000", "10.0.0.3:9000"
+
+	ctx := context.Background()
+	rt, _ := newTestIndexedMasterRouteTable(t)
+
+	oids := []int64{1, 2, 3, 4, 5, 6, 7}
+	_, err := rt.BatchSet(ctx, testColor, oids, from)
+	require.NoError(t, err)
+
+	// oid 7 is taken over before the drain reaches it
+	_, err = rt.CompareAndSwap(ctx, testColor, 7, from, to1)
+	require.NoError(t, err)
+
+	_, err = rt.CompareAndSwap(ctx, testColor, 7, from, to2)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableValueNotSame)
+
+	picker := func(ctx context.Context, color string, oid int64) (string, error) {
+		switch {
+		case oid == 6:
+			return "", nil
+		case oid%2 == 0:
+			return to2, nil
+		default:
+			return to1, nil
+		}
+	}
+
+	var updates []routetable.DrainProgress
+
+	progress, err := rt.Drain(ctx, testColor, from, picker,
+		routetable.WithDrainBatchSize(2),
+		routetable.WithDrainInterval(0),
+		routetable.WithDrainProgress(func(p routetable.DrainProgress) {
+			updates = append(updates, p)
+		}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, routetable.DrainProgress{Moved: 5, Failed: 1}, progress)
+	assert.Equal(t, progress, updates[len(updates)-1])
+
+	addrs, err := rt.BatchGet(ctx, testColor, oids)
+	require.NoError(t, err)
+	assert.Equal(t, []string{to1, to2, to1, to2, to1, from, to1}, addrs)
+
+	assert.ElementsMatch(t, []int64{6}, listAllByAddr(t, rt, from))
+	assert.ElementsMatch(t, []int64{1, 3, 5, 7}, listAllByAddr(t, rt, to1))
+
+	// resuming only visits the route left behind
+	progress, err = rt.Drain(ctx, testColor, from, func(context.Context, string, int64) (string, error) {
+		return to2, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, routetable.DrainProgress{Moved: 1}, progress)
+}
+
+func TestDrainSkipsMovedRoutes(t *testing.T) {
+	t.Parallel()
+
+	const from, to1, to2 = "10.0.0.1:9000", "10.0.0.2:9000", "10.0.0.3:9000"
+
+	ctx := context.Background()
+	rt, _ := newTestIndexedMasterRouteTable(t)
+
+	_, err := rt.BatchSet(ctx, testColor, []int64{1, 2}, from)
+	require.NoError(t, err)
+
+	// oid 2 is taken over after it is listed and before it is moved
+	picker := func(ctx context.Context, color string, oid int64) (string, error) {
+		if oid == 2 {
+			require.NoError(t, rt.Set(ctx, color, oid, to2))
+		}
+
+		return to1, nil
+	}
+
+	progress, err := rt.Drain(ctx, testColor, from, picker, routetable.WithDrainInterval(0))
+	require.NoError(t, err)
+	assert.Equal(t, routetable.DrainProgress{Moved: 1, Skipped: 1}, progress)
+
+	assert.Empty(t, listAllByAddr(t, rt, from))
+	assert.ElementsMatch(t, []int64{1}, listAllByAddr(t, rt, to1))
+	assert.ElementsMatch(t, []int64{2}, listAllByAddr(t, rt, to2))
+}
+
+func TestDrainCanceled(t *testing.T) {
+	t.Parallel()
+
+	const from, to = "10.0.0.1:9000", "10.0.0.2:9000"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rt, _ := newTestIndexedMasterRouteTable(t)
+
+	_, err := rt.BatchSet(ctx, testColor, []int64{1, 2, 3, 4, 5}, from)
+	require.NoError(t, err)
+
+	// without an interval the drain still stops at the batch after the cancellation
+	progress, err := rt.Drain(ctx, testColor, from, func(context.Context, string, int64) (string, error) {
+		return to, nil
+	},
+		routetable.WithDrainBatchSize(2),
+		routetable.WithDrainInterval(0),
+		routetable.WithDrainProgress(func(routetable.DrainProgress) { cancel() }),
+	)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, routetable.DrainProgress{Moved: 2}, progress)
+	assert.Len(t, listAllByAddr(t, rt, from), 3)
+}
+
+func TestDrainNotConfigured(t *testing.T) {
+	t.Parallel()
+
+	rt, _ := newTestMasterRouteTable(t)
+
+	_, err := rt.Drain(context.Background(), testColor, "10.0.0.1:9000", nil)
+	require.ErrorIs(t, err, routetable.ErrAddrIndexNotConfigured)
+}
@@ -0,0 +1,384 @@
+package routetable
+
+import (
+	"context"
+	"encoding/binary"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+)
+
+// ErrInvalidRouteEntry is returned when a stored value cannot be decoded into a RouteEntry.
+var ErrInvalidRouteEntry = errors.New("invalid route table entry")
+
+// The first byte of an encoded RouteEntry is its format. It is a control character, which never
+// starts an address, so values written before RouteEntry was introduced are told apart and decoded
+// as legacy values.
+const (
+	// entryFormatV2 stores the Epoch as 8 big-endian bytes right after the format byte,
+	// so that the data stores can allocate it without decoding the rest of the value.
+	entryFormatV2 = 0x02
+	// entryFormatMax is the greatest format byte, the last control character.
+	entryFormatMax = 0x1f
+)
+
+// entryEpochEnd is the end of the epoch of an entry encoded in entryFormatV2.
+const entryEpochEnd = 9
+
+// RouteEntry is the value of a routing entry.
+type RouteEntry struct {
+	// Addr is the address of the node the entry is routed to.
+	Addr string `json:"addr"`
+	// Node is the name of the node, if known by the writer.
+	Node string `json:"node,omitempty"`
+	// Version is the service version of the node, if known by the writer.
+	Version string `json:"version,omitempty"`
+	// AssignedAt is the time the route was assigned to the node.
+	AssignedAt time.Time `json:"assigned_at,omitzero"`
+	// Epoch is the fencing epoch of the assignment, see GetSet.
+	Epoch uint64 `json:"epoch,omitempty"`
+	// Metadata holds free-form attributes of the route.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// MarshalBinary encodes e in the compact format stored by the route tables: the format byte,
+// the Epoch in 8 big-endian bytes, then the length-prefixed Addr, Node and Version, AssignedAt
+// in Unix microseconds, and the number of Metadata pairs followed by the length-prefixed pairs sorted by key.
+func (e RouteEntry) MarshalBinary() ([]byte, error) {
+	n := entryEpochEnd + 4*binary.MaxVarintLen64 + len(e.Addr) + len(e.Node) + len(e.Version)
+	for k, v := range e.Metadata {
+		n += 2*binary.MaxVarintLen64 + len(k) + len(v)
+	}
+
+	b := make([]byte, 0, n)
+	b = append(b, entryFormatV2)
+	b = binary.BigEndian.AppendUint64(b, e.Epoch)
+	b = appendString(b, e.Addr)
+	b = appendString(b, e.Node)
+	b = appendString(b, e.Version)
+
+	var at int64
+	if !e.AssignedAt.IsZero() {
+		at = e.AssignedAt.UnixMicro()
+	}
+
+	b = binary.AppendVarint(b, at)
+	b = binary.AppendUvarint(b, uint64(len(e.Metadata)))
+
+	for _, k := range slices.Sorted(maps.Keys(e.Metadata)) {
+		b = appendString(b, k)
+		b = appendString(b, e.Metadata[k])
+	}
+
+	return b, nil
+}
+
+// UnmarshalBinary decodes a value encoded by MarshalBinary. A value written before RouteEntry
+// was introduced is a bare address, which is decoded into Addr.
+func (e *RouteEntry) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] > entryFormatMax {
+		*e = RouteEntry{Addr: string(data)}
+		return nil
+	}
+
+	if data[0] != entryFormatV2 {
+		return errors.WithMessagef(ErrInvalidRouteEntry, "format=%d", data[0])
+	}
+
+	if len(data) < entryEpochEnd {
+		return errors.WithMessagef(ErrInvalidRouteEntry, "epoch of %d bytes", len(data)-1)
+	}
+
+	ret := RouteEntry{Epoch: binary.BigEndian.Uint64(data[1:entryEpochEnd])}
+	d := entryDecoder{buf: data[entryEpochEnd:]}
+
+	ret.Addr = d.string()
+	ret.Node = d.string()
+	ret.Version = d.string()
+
+	if at := d.varint(); at != 0 {
+		ret.AssignedAt = time.UnixMicro(at)
+	}
+
+	if n := d.uvarint(); n > 0 && d.err == nil {
+		// every pair takes at least two bytes
+		if n > uint64(len(d.buf)/2) {
+			return errors.WithMessagef(ErrInvalidRouteEntry, "metadata=%d", n)
+		}
+
+		ret.Metadata = make(map[string]string, n)
+
+		for range n {
+			k := d.string()
+			ret.Metadata[k] = d.string()
+		}
+	}
+
+	if d.err != nil {
+		return d.err
+	}
+
+	if len(d.buf) > 0 {
+		return errors.WithMessagef(ErrInvalidRouteEntry, "trailing=%d", len(d.buf))
+	}
+
+	*e = ret
+
+	return nil
+}
+
+// ParseRouteEntry decodes a stored value into a RouteEntry, see UnmarshalBinary.
+func ParseRouteEntry(val string) (RouteEntry, error) {
+	var e RouteEntry
+
+	if err := e.UnmarshalBinary([]byte(val)); err != nil {
+		return RouteEntry{}, err
+	}
+
+	return e, nil
+}
+
+// ReplaceEpoch returns val, a value encoded by MarshalBinary, with its epoch replaced by epoch.
+// The data stores use it to store the epoch they allocate for an assignment, see Data.Assign.
+func ReplaceEpoch(val string, epoch uint64) (string, error) {
+	if len(val) < entryEpochEnd || val[0] != entryFormatV2 {
+		return "", errors.WithMessage(ErrInvalidRouteEntry, "the epoch of the value cannot be replaced")
+	}
+
+	b := make([]byte, 0, len(val))
+	b = append(b, entryFormatV2)
+	b = binary.BigEndian.AppendUint64(b, epoch)
+	b = append(b, val[entryEpochEnd:]...)
+
+	return string(b), nil
+}
+
+// encodeEntry encodes the stored value of a routing entry.
+func encodeEntry(e RouteEntry) string {
+	b, _ := e.MarshalBinary()
+	return string(b)
+}
+
+// decodeEntry decodes a stored value, which is empty for a missing key.
+func decodeEntry(key, val string) (RouteEntry, error) {
+	e, err := ParseRouteEntry(val)
+	if err != nil {
+		return RouteEntry{}, errors.WithMessagef(err, "key=%s", key)
+	}
+
+	return e, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// entryDecoder reads the fields of an encoded RouteEntry and keeps the first error.
+type entryDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *entryDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errors.WithMessage(ErrInvalidRouteEntry, "bad uvarint")
+		return 0
+	}
+
+	d.buf = d.buf[n:]
+
+	return v
+}
+
+func (d *entryDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errors.WithMessage(ErrInvalidRouteEntry, "bad varint")
+		return 0
+	}
+
+	d.buf = d.buf[n:]
+
+	return v
+}
+
+func (d *entryDecoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+
+	if n > uint64(len(d.buf)) {
+		d.err = errors.WithMessagef(ErrInvalidRouteEntry, "string length %d exceeds %d bytes", n, len(d.buf))
+		return ""
+	}
+
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+
+	return s
+}
+
+// GetEntry retrieves a routing entry with all its attributes.
+func (r *readOnlyRouteTable) GetEntry(ctx context.Context, color string, uid int64) (RouteEntry, error) {
+	key := r.BuildKey(color, uid)
+
+	val, err := r.data.Get(ctx, key)
+	if err != nil {
+		return RouteEntry{}, errors.WithMessage(err, "get route table failed")
+	}
+
+	e, err := decodeEntry(key, val)
+	if err != nil {
+		return RouteEntry{}, errors.WithMessage(err, "get route table failed")
+	}
+
+	return e, nil
+}
+
+// GetEntryWithTTL retrieves a routing entry with its remaining time to live,
+// which is zero if the entry does not expire.
+func (r *readOnlyRouteTable) GetEntryWithTTL(ctx context.Context, color string, uid int64) (Entry, error) {
+	key := r.BuildKey(color, uid)
+
+	vals, ttls, err := r.data.BatchGetWithTTL(ctx, []string{key})
+	if err != nil {
+		return Entry{}, errors.WithMessage(err, "get route table failed")
+	}
+
+	if vals[0] == "" {
+		return Entry{}, errors.WithMessage(xerrors.ErrRouteTableNotFoundFunc(key), "get route table failed")
+	}
+
+	e, err := decodeEntry(key, vals[0])
+	if err != nil {
+		return Entry{}, errors.WithMessage(err, "get route table failed")
+	}
+
+	return Entry{Color: color, OID: uid, RouteEntry: e, TTL: ttls[0]}, nil
+}
+
+// BatchGetEntries retrieves the routing entries of oids in order. Missing entries have an empty Addr.
+func (r *readOnlyRouteTable) BatchGetEntries(ctx context.Context, color string, oids []int64) ([]RouteEntry, error) {
+	keys, _ := buildKeys(r, color, oids, "")
+
+	vals, err := r.data.BatchGet(ctx, keys)
+	if err != nil {
+		return nil, errors.WithMessage(err, "batch get route table failed")
+	}
+
+	entries := make([]RouteEntry, len(vals))
+
+	for i, val := range vals {
+		if entries[i], err = decodeEntry(keys[i], val); err != nil {
+			return nil, errors.WithMessage(err, "batch get route table failed")
+		}
+	}
+
+	return entries, nil
+}
+
+// ownedValue returns the stored value of key if it is routed to addr with epoch.
+// The conditional writes of an owner compare against the whole stored value,
+// which holds attributes the owner does not know, so it is read first.
+func ownedValue(ctx context.Context, data Data, key, addr string, epoch uint64) (string, error) {
+	val, err := data.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	if err := checkOwner(key, val, addr, epoch); err != nil {
+		return "", err
+	}
+
+	return val, nil
+}
+
+// ownedValues is the batch version of ownedValue for the oids of color with the epoch of the same index.
+// errs holds the result of each oid, and err is only returned if the values could not be read.
+func ownedValues(ctx context.Context, rt ReadOnlyRouteTable, data Data, color string, oids []int64, addr string, epochs []uint64) (keys, vals []string, errs []error, err error) {
+	if len(oids) != len(epochs) {
+		return nil, nil, nil, errors.Errorf("got %d oids and %d epochs", len(oids), len(epochs))
+	}
+
+	keys, _ = buildKeys(rt, color, oids, "")
+
+	vals, err = data.BatchGet(ctx, keys)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	errs = make([]error, len(keys))
+
+	for i, val := range vals {
+		errs[i] = checkOwner(keys[i], val, addr, epochs[i])
+	}
+
+	return keys, vals, errs, nil
+}
+
+// checkOwner checks that val, the stored value of key, is routed to addr with epoch.
+func checkOwner(key, val, addr string, epoch uint64) error {
+	if val == "" {
+		return xerrors.ErrRouteTableNotFoundFunc(key)
+	}
+
+	e, err := decodeEntry(key, val)
+	if err != nil {
+		return err
+	}
+
+	if e.Addr != addr || e.Epoch != epoch {
+		return xerrors.ErrRouteTableValueNotSameFunc(key, addr)
+	}
+
+	return nil
+}
+
+// batchIfOwned runs fn on the keys whose errs are nil with their stored values,
+// and merges its results into errs.
+func batchIfOwned(keys, vals []string, errs []error, fn func(keys, vals []string) ([]error, error)) ([]error, error) {
+	owned := make([]int, 0, len(keys))
+
+	for i, err := range errs {
+		if err == nil {
+			owned = append(owned, i)
+		}
+	}
+
+	if len(owned) == 0 {
+		return errs, nil
+	}
+
+	subKeys := make([]string, len(owned))
+	subVals := make([]string, len(owned))
+
+	for j, i := range owned {
+		subKeys[j] = keys[i]
+		subVals[j] = vals[i]
+	}
+
+	subErrs, err := fn(subKeys, subVals)
+	if err != nil {
+		return nil, err
+	}
+
+	for j, i := range owned {
+		errs[i] = subErrs[j]
+	}
+
+	return errs, nil
+}
@@ -0,0 +1,111 @@
+package routetable_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/internal/testclock"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteEntryBinary(t *testing.T) {
+	t.Parallel()
+
+	e := routetable.RouteEntry{
+		Addr:       "10.0.0.1:9000",
+		Node:       "player-1",
+		Version:    "v1.0.0",
+		AssignedAt: time.UnixMicro(1700000000123456),
+		Epoch:      42,
+		Metadata:   map[string]string{"zone": "a", "fallback": "red"},
+	}
+
+	b, err := e.MarshalBinary()
+	require.NoError(t, err)
+
+	got, err := routetable.ParseRouteEntry(string(b))
+	require.NoError(t, err)
+	assert.Equal(t, e, got)
+
+	b2, err := got.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, b, b2)
+
+	_, err = routetable.ParseRouteEntry(string(b[:len(b)-1]))
+	require.ErrorIs(t, err, routetable.ErrInvalidRouteEntry)
+
+	_, err = routetable.ParseRouteEntry(string(append(b, 0)))
+	require.ErrorIs(t, err, routetable.ErrInvalidRouteEntry)
+
+	// a format that is not written
+	_, err = routetable.ParseRouteEntry(string([]byte{1, 0, 0, 0, 0, 0, 0}))
+	require.ErrorIs(t, err, routetable.ErrInvalidRouteEntry)
+}
+
+func TestRouteEntryLegacy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		val  string
+		want routetable.RouteEntry
+	}{
+		{val: "10.0.0.1:9000", want: routetable.RouteEntry{Addr: "10.0.0.1:9000"}},
+		{val: "", want: routetable.RouteEntry{}},
+	}
+
+	for _, tt := range tests {
+		got, err := routetable.ParseRouteEntry(tt.val)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, tt.val)
+	}
+}
+
+func TestMasterRouteTableEntries(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := testclock.New(time.Unix(1700000000, 0))
+
+	data := memory.New(memory.WithClock(clock.Now), memory.WithSweepInterval(time.Hour))
+	t.Cleanup(func() {
+		_ = data.Close()
+	})
+
+	rt := routetable.NewMasterRouteTable(data, testName, routetable.WithClock(clock.Now))
+
+	// a value written before RouteEntry was introduced
+	require.NoError(t, data.Set(ctx, rt.BuildKey(testColor, 1), "10.0.0.1:9000", 0))
+
+	e, err := rt.GetEntry(ctx, testColor, 1)
+	require.NoError(t, err)
+	assert.Equal(t, routetable.RouteEntry{Addr: "10.0.0.1:9000"}, e)
+
+	require.NoError(t, rt.RenewSelf(ctx, testColor, 1, "10.0.0.1:9000", 0))
+
+	route := routetable.RouteEntry{Addr: "10.0.0.2:9000", Node: "player-2", Metadata: map[string]string{"zone": "b"}}
+
+	old, cur, err := rt.GetSetEntry(ctx, testColor, 1, route)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:9000", old.Addr)
+	assert.Equal(t, clock.Now(), cur.AssignedAt)
+	assert.Equal(t, uint64(clock.Now().UnixMicro())+1, cur.Epoch)
+	assert.Equal(t, route.Metadata, cur.Metadata)
+
+	ok, got, err := rt.SetNxOrGetEntry(ctx, testColor, 1, routetable.RouteEntry{Addr: "10.0.0.3:9000"})
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.True(t, cur.AssignedAt.Equal(got.AssignedAt))
+
+	entries, err := rt.BatchGetEntries(ctx, testColor, []int64{1, 2})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "player-2", entries[0].Node)
+	assert.Empty(t, entries[1].Addr)
+
+	// the conditional writes of the owner match the whole stored entry
+	require.NoError(t, rt.DelIfSame(ctx, testColor, 1, route.Addr, cur.Epoch))
+}
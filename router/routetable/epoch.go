@@ -0,0 +1,62 @@
+package routetable
+
+// Every routing entry carries an epoch, a fencing token that increases every time the route is assigned.
+// The owner of a route receives its epoch from SetNxOrGet or GetSet, must present it to renew or
+// conditionally delete the route, and can pass it to downstream storage, which rejects the writes
+// of an owner whose epoch is lower than the last one it has seen.
+//
+// The epoch is allocated by the data store in the atomic operation that writes the entry, see Data.Assign.
+// A new epoch is greater than the epoch of the entry it replaces and than every epoch the store has
+// allocated for the key before, even if the key has expired or been deleted since, whatever the clocks
+// of the nodes are. The stores seed their counters with their own clock in microseconds, so that epochs
+// also exceed the epochs assigned from the clock of the nodes by previous versions.
+//
+// A value written before epochs were introduced is decoded with epoch 0.
+
+// AssignMode is the condition of an assignment, see Data.Assign.
+type AssignMode int
+
+const (
+	// AssignAlways assigns the key whatever its current value is.
+	AssignAlways AssignMode = iota
+	// AssignIfAbsent assigns the key only if it does not exist.
+	// Otherwise the result is not assigned and holds the current value, which is not an error.
+	AssignIfAbsent
+	// AssignIfAddr assigns the key only if it is routed to the expected address, whatever its epoch.
+	// Otherwise the error is ErrRouteTableNotFound or ErrRouteTableValueNotSame.
+	AssignIfAddr
+)
+
+// AssignResult is the result of an assignment.
+type AssignResult struct {
+	// Assigned reports whether the key has been assigned.
+	Assigned bool
+	// Prev is the value the key had before the assignment, empty if it did not exist.
+	Prev string
+	// Value is the current value of the key, which is the assigned value with its epoch if Assigned is true.
+	Value string
+	// Err is the error of this key in a batch. Assigned, Prev and Value are undefined if it is not nil.
+	Err error
+}
+
+// assignment returns the value that assigns e now. Its epoch is allocated by the data store.
+func (r *masterRouteTable) assignment(e RouteEntry) string {
+	e.AssignedAt = r.now()
+	e.Epoch = 0
+
+	return encodeEntry(e)
+}
+
+// decodeAssigned decodes the previous entry of an assignment, whose Addr is empty if the key did not exist,
+// and the current entry.
+func decodeAssigned(key string, ret AssignResult) (old, cur RouteEntry, err error) {
+	if old, err = decodeEntry(key, ret.Prev); err != nil {
+		return RouteEntry{}, RouteEntry{}, err
+	}
+
+	if cur, err = decodeEntry(key, ret.Value); err != nil {
+		return RouteEntry{}, RouteEntry{}, err
+	}
+
+	return old, cur, nil
+}
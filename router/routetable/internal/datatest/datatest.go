@@ -0,0 +1,180 @@
+// Package datatest provides conformance tests shared by the routetable.Data implementations.
+package datatest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ttlTolerance is how far the remaining time to live may drift from the ttl of a write
+// on a data store with a real clock.
+const ttlTolerance = time.Second
+
+// write writes val to key with ttl through one of the operations of routetable.Data.
+// The key holds old with a ttl of one hour before the write, unless old is empty.
+type write struct {
+	name string
+	old  string
+	fn   func(ctx context.Context, data routetable.Data, key, old, val string, ttl time.Duration) error
+}
+
+// TestTTL checks the time to live semantics of the routetable.Data contract on data:
+// a write with a positive ttl expires the key after ttl, and with a zero or negative ttl persists it,
+// whatever the expiration of the key before. GetEx keeps the expiration of the key with a negative ttl,
+// and Expire deletes the key with a non-positive one.
+// data must be empty, and it is left with keys prefixed by ttl:.
+func TestTTL(t *testing.T, data routetable.Data) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	entry := func(addr string) string {
+		b, err := routetable.RouteEntry{Addr: addr}.MarshalBinary()
+		require.NoError(t, err)
+
+		return string(b)
+	}
+
+	writes := []write{
+		{name: "set", old: "a", fn: func(ctx context.Context, data routetable.Data, key, _, val string, ttl time.Duration) error {
+			return data.Set(ctx, key, val, ttl)
+		}},
+		{name: "setnx", fn: func(ctx context.Context, data routetable.Data, key, _, val string, ttl time.Duration) error {
+			_, _, err := data.SetNxOrGet(ctx, key, val, ttl)
+			return err
+		}},
+		{name: "getset", old: "a", fn: func(ctx context.Context, data routetable.Data, key, _, val string, ttl time.Duration) error {
+			_, err := data.GetSet(ctx, key, val, ttl)
+			return err
+		}},
+		{name: "cas", old: "a", fn: func(ctx context.Context, data routetable.Data, key, old, val string, ttl time.Duration) error {
+			return data.CompareAndSwap(ctx, key, old, val, ttl)
+		}},
+		{name: "assign", old: entry("a"), fn: func(ctx context.Context, data routetable.Data, key, _, _ string, ttl time.Duration) error {
+			_, err := data.Assign(ctx, routetable.AssignIfAddr, key, "a", entry("b"), ttl)
+			return err
+		}},
+		{name: "batchset", old: "a", fn: func(ctx context.Context, data routetable.Data, key, _, val string, ttl time.Duration) error {
+			return batchErr(data.BatchSet(ctx, []string{key}, []string{val}, ttl))
+		}},
+		{name: "batchsetttl", old: "a", fn: func(ctx context.Context, data routetable.Data, key, _, val string, ttl time.Duration) error {
+			return batchErr(data.BatchSetWithTTL(ctx, []string{key}, []string{val}, []time.Duration{ttl}))
+		}},
+		{name: "batchsetnx", fn: func(ctx context.Context, data routetable.Data, key, _, val string, ttl time.Duration) error {
+			results, err := data.BatchSetNxOrGet(ctx, []string{key}, []string{val}, ttl)
+			if err != nil {
+				return err
+			}
+
+			return results[0].Err
+		}},
+		{name: "batchcas", old: "a", fn: func(ctx context.Context, data routetable.Data, key, old, val string, ttl time.Duration) error {
+			return batchErr(data.BatchCompareAndSwap(ctx, []string{key}, []string{old}, []string{val}, ttl))
+		}},
+		{name: "batchassign", fn: func(ctx context.Context, data routetable.Data, key, _, _ string, ttl time.Duration) error {
+			results, err := data.BatchAssign(ctx, routetable.AssignIfAbsent, []string{key}, []string{""}, []string{entry("b")}, ttl)
+			if err != nil {
+				return err
+			}
+
+			return results[0].Err
+		}},
+	}
+
+	ttls := []struct {
+		name string
+		ttl  time.Duration
+		// want is the remaining time to live after the write, zero if the key persists
+		want time.Duration
+	}{
+		{name: "positive", ttl: 2 * time.Minute, want: 2 * time.Minute},
+		{name: "zero", ttl: 0},
+		{name: "negative", ttl: -time.Second},
+		// the KeepTTL of go-redis
+		{name: "minimal", ttl: -1},
+	}
+
+	for _, w := range writes {
+		for _, tt := range ttls {
+			key := "ttl:" + w.name + ":" + tt.name
+
+			if w.old != "" {
+				require.NoError(t, data.Set(ctx, key, w.old, time.Hour), key)
+			}
+
+			require.NoError(t, w.fn(ctx, data, key, w.old, "b", tt.ttl), key)
+			requireTTL(t, data, key, tt.want)
+		}
+	}
+
+	// GetEx resets the expiration, persists the key with a zero ttl and keeps its expiration with a negative one
+	require.NoError(t, data.Set(ctx, "ttl:getex", "a", time.Hour))
+
+	_, err := data.GetEx(ctx, "ttl:getex", -time.Second)
+	require.NoError(t, err)
+	requireTTL(t, data, "ttl:getex", time.Hour)
+
+	_, err = data.GetEx(ctx, "ttl:getex", 2*time.Minute)
+	require.NoError(t, err)
+	requireTTL(t, data, "ttl:getex", 2*time.Minute)
+
+	_, err = data.GetEx(ctx, "ttl:getex", 0)
+	require.NoError(t, err)
+	requireTTL(t, data, "ttl:getex", 0)
+
+	// Expire and ExpireIfSame delete the key with a non-positive ttl
+	for _, ttl := range []time.Duration{0, -time.Second} {
+		require.NoError(t, data.Set(ctx, "ttl:expire", "a", time.Hour))
+		require.NoError(t, data.Expire(ctx, "ttl:expire", ttl))
+		requireMissing(t, data, "ttl:expire")
+
+		require.NoError(t, data.Set(ctx, "ttl:expireifsame", "a", 0))
+		require.NoError(t, data.ExpireIfSame(ctx, "ttl:expireifsame", "a", ttl))
+		requireMissing(t, data, "ttl:expireifsame")
+
+		require.NoError(t, data.Set(ctx, "ttl:batchexpireifsame", "a", 0))
+		require.NoError(t, batchErr(data.BatchExpireIfSame(ctx, []string{"ttl:batchexpireifsame"}, []string{"a"}, ttl)))
+		requireMissing(t, data, "ttl:batchexpireifsame")
+	}
+
+	require.NoError(t, data.Set(ctx, "ttl:expire", "a", 0))
+	require.NoError(t, data.Expire(ctx, "ttl:expire", 2*time.Minute))
+	requireTTL(t, data, "ttl:expire", 2*time.Minute)
+}
+
+func batchErr(errs []error, err error) error {
+	if err != nil {
+		return err
+	}
+
+	return errs[0]
+}
+
+// requireTTL requires key to exist with the remaining time to live want, zero if it does not expire.
+func requireTTL(t *testing.T, data routetable.Data, key string, want time.Duration) {
+	t.Helper()
+
+	vals, ttls, err := data.BatchGetWithTTL(context.Background(), []string{key})
+	require.NoError(t, err, key)
+	require.NotEmpty(t, vals[0], key)
+
+	if want == 0 {
+		assert.Zero(t, ttls[0], key)
+		return
+	}
+
+	assert.InDelta(t, float64(want), float64(ttls[0]), float64(ttlTolerance), key)
+}
+
+func requireMissing(t *testing.T, data routetable.Data, key string) {
+	t.Helper()
+
+	vals, err := data.BatchGet(context.Background(), []string{key})
+	require.NoError(t, err, key)
+	assert.Empty(t, vals[0], key)
+}
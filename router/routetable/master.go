@@ -2,7 +2,10 @@ package routetable
 
 import (
 	"context"
+	"time"
 
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-pantheon/fabrica-kit/router"
 	"github.com/go-pantheon/fabrica-util/errors"
 )
 
@@ -13,33 +16,63 @@ var _ RouteTable = (*masterRouteTable)(nil)
 type masterRouteTable struct {
 	ReNewalRouteTable
 
-	data Data
+	data        Data
+	name        string
+	invalidator Invalidator
+	addrIndex   AddrIndex
+	now         func() time.Time
 }
 
 // NewMasterRouteTable creates a new BaseRouteTable with the given data store,
 // name, key generation function, and optional configuration options.
 func NewMasterRouteTable(rtd Data, name string, opts ...Option) *masterRouteTable {
+	o := newOptions(opts...)
+
 	rt := &masterRouteTable{
-		ReNewalRouteTable: NewRenewalRouteTable(rtd, name, opts...),
+		ReNewalRouteTable: newRenewalRouteTable(rtd, name, o),
 		data:              rtd,
+		name:              name,
+		invalidator:       o.invalidator,
+		addrIndex:         o.addrIndex,
+		now:               o.now,
 	}
 
 	return rt
 }
 
-// GetSet atomically gets the old value and sets a new value for a routing entry.
-func (r *masterRouteTable) GetSet(ctx context.Context, color string, uid int64, addr string) (old string, err error) {
-	old, err = r.data.GetSet(ctx, r.BuildKey(color, uid), addr, r.TTL())
+// GetSet assigns a routing entry to addr with a new epoch and returns the previous address and the new epoch.
+// The previous address is empty if the entry did not exist.
+func (r *masterRouteTable) GetSet(ctx context.Context, color string, uid int64, addr string) (old string, epoch uint64, err error) {
+	prev, cur, err := r.GetSetEntry(ctx, color, uid, RouteEntry{Addr: addr})
+	if err != nil {
+		return "", 0, err
+	}
+
+	return prev.Addr, cur.Epoch, nil
+}
+
+// GetSetEntry assigns a routing entry to e with a new epoch and assignment time,
+// and returns the previous entry, whose Addr is empty if it did not exist, and the stored entry.
+func (r *masterRouteTable) GetSetEntry(ctx context.Context, color string, uid int64, e RouteEntry) (old, cur RouteEntry, err error) {
+	key := r.BuildKey(color, uid)
+
+	ret, err := r.data.Assign(ctx, AssignAlways, key, "", r.assignment(e), r.TTL())
 	if err != nil {
-		return "", errors.WithMessage(err, "getset route table failed")
+		return RouteEntry{}, RouteEntry{}, errors.WithMessage(err, "getset route table failed")
 	}
 
-	return old, nil
+	if old, cur, err = decodeAssigned(key, ret); err != nil {
+		return RouteEntry{}, RouteEntry{}, errors.WithMessage(err, "getset route table failed")
+	}
+
+	r.invalidate(ctx, key)
+
+	return old, cur, nil
 }
 
-// Set stores a routing entry in the route table with the default TTL.
+// Set assigns a routing entry to addr with a new epoch and the default TTL.
 func (r *masterRouteTable) Set(ctx context.Context, color string, uid int64, addr string) error {
-	if err := r.data.Set(ctx, r.BuildKey(color, uid), addr, r.TTL()); err != nil {
+	if _, _, err := r.GetSetEntry(ctx, color, uid, RouteEntry{Addr: addr}); err != nil {
 		return errors.WithMessage(err, "set route table failed")
 	}
 
@@ -47,58 +80,243 @@ func (r *masterRouteTable) Set(ctx context.Context, color string, uid int64, add
 }
 
 // SetNxOrGet sets a routing entry only if it doesn't already exist.
-// Returns true if the entry was set, along with the result and any error.
-func (r *masterRouteTable) SetNxOrGet(ctx context.Context, color string, uid int64, addr string) (ok bool, result string, err error) {
-	ok, result, err = r.data.SetNxOrGet(ctx, r.BuildKey(color, uid), addr, r.TTL())
+// Returns true if the entry was set, along with the address and epoch of the current owner.
+func (r *masterRouteTable) SetNxOrGet(ctx context.Context, color string, uid int64, addr string) (ok bool, result string, epoch uint64, err error) {
+	ok, cur, err := r.SetNxOrGetEntry(ctx, color, uid, RouteEntry{Addr: addr})
+	if err != nil {
+		return false, "", 0, err
+	}
+
+	return ok, cur.Addr, cur.Epoch, nil
+}
+
+// SetNxOrGetEntry sets a routing entry to e with a new epoch and assignment time only if it doesn't already exist.
+// Returns true if the entry was set, along with the current entry.
+func (r *masterRouteTable) SetNxOrGetEntry(ctx context.Context, color string, uid int64, e RouteEntry) (ok bool, cur RouteEntry, err error) {
+	key := r.BuildKey(color, uid)
+
+	ret, err := r.data.Assign(ctx, AssignIfAbsent, key, "", r.assignment(e), r.TTL())
+	if err != nil {
+		return false, RouteEntry{}, errors.WithMessage(err, "setnx route table failed")
+	}
+
+	if ret.Assigned {
+		r.invalidate(ctx, key)
+	}
+
+	cur, err = decodeEntry(key, ret.Value)
+	if err != nil {
+		return false, RouteEntry{}, errors.WithMessage(err, "setnx route table failed")
+	}
+
+	return ret.Assigned, cur, nil
+}
+
+// CompareAndSwap moves a routing entry from old to addr with a new epoch only if it is still routed to old,
+// whatever the epoch of old is. It returns the new epoch.
+func (r *masterRouteTable) CompareAndSwap(ctx context.Context, color string, uid int64, old, addr string) (epoch uint64, err error) {
+	key := r.BuildKey(color, uid)
+
+	ret, err := r.data.Assign(ctx, AssignIfAddr, key, old, r.assignment(RouteEntry{Addr: addr}), r.TTL())
 	if err != nil {
-		return false, "", errors.WithMessage(err, "setnx route table failed")
+		return 0, errors.WithMessage(err, "cas route table failed")
+	}
+
+	cur, err := decodeEntry(key, ret.Value)
+	if err != nil {
+		return 0, errors.WithMessage(err, "cas route table failed")
+	}
+
+	r.invalidate(ctx, key)
+
+	return cur.Epoch, nil
+}
+
+// BatchSet assigns the routing entries of oids to addr with new epochs and the default TTL in one batch.
+// errs holds the result of each oid, and err is only returned if the batch could not run.
+func (r *masterRouteTable) BatchSet(ctx context.Context, color string, oids []int64, addr string) ([]error, error) {
+	keys, vals := buildKeys(r, color, oids, r.assignment(RouteEntry{Addr: addr}))
+
+	results, err := r.data.BatchAssign(ctx, AssignAlways, keys, make([]string, len(keys)), vals, r.TTL())
+	if err != nil {
+		return nil, errors.WithMessagef(err, "batch set route table failed. color=%s", color)
+	}
+
+	errs := make([]error, len(results))
+
+	for i, ret := range results {
+		if errs[i] = ret.Err; ret.Err != nil {
+			continue
+		}
+
+		r.invalidate(ctx, keys[i])
+	}
+
+	return errs, nil
+}
+
+// BatchSetNxOrGet sets the routing entries of oids that do not exist yet in one batch.
+// results holds the result of each oid, and err is only returned if the batch could not run.
+func (r *masterRouteTable) BatchSetNxOrGet(ctx context.Context, color string, oids []int64, addr string) ([]SetNxOrGetResult, error) {
+	keys, vals := buildKeys(r, color, oids, r.assignment(RouteEntry{Addr: addr}))
+
+	assigned, err := r.data.BatchAssign(ctx, AssignIfAbsent, keys, make([]string, len(keys)), vals, r.TTL())
+	if err != nil {
+		return nil, errors.WithMessagef(err, "batch setnx route table failed. color=%s", color)
+	}
+
+	results := make([]SetNxOrGetResult, len(assigned))
+
+	for i, ret := range assigned {
+		if ret.Err != nil {
+			results[i] = SetNxOrGetResult{Err: ret.Err}
+			continue
+		}
+
+		cur, err := decodeEntry(keys[i], ret.Value)
+		if err != nil {
+			results[i] = SetNxOrGetResult{Err: err}
+			continue
+		}
+
+		results[i] = SetNxOrGetResult{Set: ret.Assigned, Addr: cur.Addr, Epoch: cur.Epoch}
+
+		if ret.Assigned {
+			r.invalidate(ctx, keys[i])
+		}
 	}
 
-	return ok, result, nil
+	return results, nil
 }
 
 // GetEx loads a routing entry and extends its expiration time.
 func (r *masterRouteTable) GetEx(ctx context.Context, color string, uid int64) (addr string, err error) {
-	addr, err = r.data.GetEx(ctx, r.BuildKey(color, uid), r.TTL())
+	key := r.BuildKey(color, uid)
+
+	val, err := r.data.GetEx(ctx, key, r.TTL())
 	if err != nil {
 		return "", errors.WithMessage(err, "getex route table failed")
 	}
 
-	return addr, nil
+	e, err := decodeEntry(key, val)
+	if err != nil {
+		return "", errors.WithMessage(err, "getex route table failed")
+	}
+
+	return e.Addr, nil
+}
+
+// Del deletes a routing entry from the route table.
+func (r *masterRouteTable) Del(ctx context.Context, color string, uid int64) error {
+	key := r.BuildKey(color, uid)
+
+	if err := r.data.Del(ctx, key); err != nil {
+		return errors.WithMessage(err, "del route table failed")
+	}
+
+	r.invalidate(ctx, key)
+
+	return nil
+}
+
+// DelDelay marks a routing entry for deletion after the specified delay.
+// delay must be greater than 0, otherwise router.DelDelayDuration will be used.
+func (r *masterRouteTable) DelDelay(ctx context.Context, color string, uid int64, delay time.Duration) error {
+	key := r.BuildKey(color, uid)
+
+	if err := r.data.Expire(ctx, key, delDelay(delay)); err != nil {
+		return errors.WithMessage(err, "del delay route table failed")
+	}
+
+	r.invalidate(ctx, key)
+
+	return nil
+}
+
+// DelIfSame deletes a routing entry only if it is still owned by value with epoch.
+func (r *masterRouteTable) DelIfSame(ctx context.Context, color string, uid int64, value string, epoch uint64) error {
+	key := r.BuildKey(color, uid)
+
+	val, err := ownedValue(ctx, r.data, key, value, epoch)
+	if err != nil {
+		return errors.WithMessage(err, "del if same route table failed")
+	}
+
+	if err := r.data.DelIfSame(ctx, key, val); err != nil {
+		return errors.WithMessage(err, "del if same route table failed")
+	}
+
+	r.invalidate(ctx, key)
+
+	return nil
 }
 
-// // Del deletes a routing entry from the route table.
-// func (r *BaseRouteTable) Del(ctx context.Context, color string, uid int64) error {
-// 	if err := r.Del(ctx, r.buildKey(r.name, color, uid)); err != nil {
-// 		return errors.Wrapf(err, "del route table failed. color=%s uid=%d", color, uid)
-// 	}
+// BatchDelIfSame deletes the routing entries of oids that are still owned by value with the epoch
+// of the same index in one batch.
+// errs holds the result of each oid, and err is only returned if the batch could not run.
+func (r *masterRouteTable) BatchDelIfSame(ctx context.Context, color string, oids []int64, value string, epochs []uint64) ([]error, error) {
+	keys, vals, errs, err := ownedValues(ctx, r, r.data, color, oids, value, epochs)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "batch del if same route table failed. color=%s", color)
+	}
+
+	errs, err = batchIfOwned(keys, vals, errs, func(keys, vals []string) ([]error, error) {
+		return r.data.BatchDelIfSame(ctx, keys, vals)
+	})
+	if err != nil {
+		return nil, errors.WithMessagef(err, "batch del if same route table failed. color=%s", color)
+	}
+
+	r.invalidateSucceeded(ctx, keys, errs)
+
+	return errs, nil
+}
+
+// DelDelayIfSame marks a routing entry for deletion after the specified delay
+// only if it is still owned by value with epoch.
+// delay must be greater than 0, otherwise router.DelDelayDuration will be used.
+func (r *masterRouteTable) DelDelayIfSame(ctx context.Context, color string, uid int64, value string, epoch uint64, delay time.Duration) error {
+	key := r.BuildKey(color, uid)
+
+	val, err := ownedValue(ctx, r.data, key, value, epoch)
+	if err != nil {
+		return errors.WithMessage(err, "del delay if same route table failed")
+	}
 
-// 	return nil
-// }
+	if err := r.data.ExpireIfSame(ctx, key, val, delDelay(delay)); err != nil {
+		return errors.WithMessage(err, "del delay if same route table failed")
+	}
 
-// // DelDelay marks a routing entry for delayed deletion after the specified expiration time.
-// func (r *BaseRouteTable) DelDelay(ctx context.Context, color string, uid int64, exp time.Duration) error {
-// 	if err := r.Expire(ctx, r.buildKey(r.name, color, uid), exp); err != nil {
-// 		return errors.Wrapf(err, "expire route table failed. color=%s uid=%d exp=%02fs", color, uid, exp.Seconds())
-// 	}
+	r.invalidate(ctx, key)
 
-// 	return nil
-// }
+	return nil
+}
 
-// // DelIfSame deletes a routing entry only if its current value matches the specified value.
-// func (r *BaseRouteTable) DelIfSame(ctx context.Context, color string, uid int64, value string) error {
-// 	if err := r.DelIfSame(ctx, r.buildKey(r.name, color, uid), value); err != nil {
-// 		return errors.Wrapf(err, "DelIfSame failed. color=%s uid=%d value=%s", color, uid, value)
-// 	}
+// invalidate notifies the subscribers of the invalidator that the routing entry of key has changed.
+// The write has already succeeded, so a failed notification is only logged.
+func (r *masterRouteTable) invalidate(ctx context.Context, key string) {
+	if r.invalidator == nil {
+		return
+	}
 
-// 	return nil
-// }
+	if err := r.invalidator.Publish(ctx, key); err != nil {
+		log.Warnf("publish route table invalidation failed. key=%s err=%+v", key, err)
+	}
+}
+
+// invalidateSucceeded invalidates the keys of a batch write whose error is nil.
+func (r *masterRouteTable) invalidateSucceeded(ctx context.Context, keys []string, errs []error) {
+	for i, err := range errs {
+		if err == nil {
+			r.invalidate(ctx, keys[i])
+		}
+	}
+}
 
-// // DelIfSame deletes a routing entry only if its current value matches the specified value.
-// func (r *BaseRouteTable) DelDelayIfSame(ctx context.Context, color string, uid int64, value string, exp time.Duration) error {
-// 	if err := r.ExpireIfSame(ctx, r.buildKey(r.name, color, uid), value, exp); err != nil {
-// 		return errors.Wrapf(err, "DelDelayIfSame failed. color=%s uid=%d value=%s exp=%02fs", color, uid, value, exp.Seconds())
-// 	}
+func delDelay(delay time.Duration) time.Duration {
+	if delay <= 0 {
+		return router.DelDelayDuration
+	}
 
-// 	return nil
-// }
+	return delay
+}
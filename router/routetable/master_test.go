@@ -0,0 +1,328 @@
+package routetable_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/internal/testclock"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/memory"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testName  = "player"
+	testColor = "blue"
+)
+
+func newTestMasterRouteTable(t *testing.T, opts ...routetable.Option) (routetable.MasterRouteTable, *testclock.Clock) {
+	t.Helper()
+
+	clock := testclock.New(time.Unix(1700000000, 0))
+	data := newTestData(t, clock)
+
+	opts = append([]routetable.Option{routetable.WithClock(clock.Now)}, opts...)
+
+	return routetable.NewMasterRouteTable(data, testName, opts...), clock
+}
+
+func newTestData(t *testing.T, clock *testclock.Clock, opts ...memory.Option) *memory.RouteTable {
+	t.Helper()
+
+	opts = append([]memory.Option{memory.WithClock(clock.Now), memory.WithSweepInterval(time.Hour)}, opts...)
+
+	data := memory.New(opts...)
+	t.Cleanup(func() {
+		_ = data.Close()
+	})
+
+	return data
+}
+
+func TestMasterRouteTableSetNxOrGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, clock := newTestMasterRouteTable(t, routetable.WithTTL(time.Minute))
+
+	ok, addr, epoch, err := rt.SetNxOrGet(ctx, testColor, 1, "10.0.0.1:9000")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.1:9000", addr)
+	assert.Equal(t, uint64(clock.Now().UnixMicro())+1, epoch)
+
+	ok, addr, owner, err := rt.SetNxOrGet(ctx, testColor, 1, "10.0.0.2:9000")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "10.0.0.1:9000", addr)
+	assert.Equal(t, epoch, owner)
+
+	clock.Advance(time.Minute)
+
+	_, err = rt.Get(ctx, testColor, 1)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+}
+
+func TestMasterRouteTableDel(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, _ := newTestMasterRouteTable(t)
+
+	require.NoError(t, rt.Set(ctx, testColor, 1, "10.0.0.1:9000"))
+	require.NoError(t, rt.Del(ctx, testColor, 1))
+
+	_, err := rt.Get(ctx, testColor, 1)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	require.NoError(t, rt.Del(ctx, testColor, 1))
+}
+
+func TestMasterRouteTableDelIfSame(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, _ := newTestMasterRouteTable(t)
+
+	err := rt.DelIfSame(ctx, testColor, 1, "10.0.0.1:9000", 0)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	_, epoch, err := rt.GetSet(ctx, testColor, 1, "10.0.0.2:9000")
+	require.NoError(t, err)
+
+	err = rt.DelIfSame(ctx, testColor, 1, "10.0.0.1:9000", epoch)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableValueNotSame)
+
+	// the same address with a stale epoch is another owner
+	err = rt.DelIfSame(ctx, testColor, 1, "10.0.0.2:9000", epoch-1)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableValueNotSame)
+
+	addr, err := rt.Get(ctx, testColor, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2:9000", addr)
+
+	require.NoError(t, rt.DelIfSame(ctx, testColor, 1, "10.0.0.2:9000", epoch))
+
+	_, err = rt.Get(ctx, testColor, 1)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+}
+
+func TestMasterRouteTableDelDelay(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, clock := newTestMasterRouteTable(t)
+
+	require.NoError(t, rt.Set(ctx, testColor, 1, "10.0.0.1:9000"))
+	require.NoError(t, rt.Set(ctx, testColor, 2, "10.0.0.1:9000"))
+
+	require.NoError(t, rt.DelDelay(ctx, testColor, 1, time.Second))
+	require.NoError(t, rt.DelDelay(ctx, testColor, 2, 0))
+
+	_, err := rt.Get(ctx, testColor, 1)
+	require.NoError(t, err)
+
+	clock.Advance(time.Second)
+
+	_, err = rt.Get(ctx, testColor, 1)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	_, err = rt.Get(ctx, testColor, 2)
+	require.NoError(t, err)
+
+	clock.Advance(router.DelDelayDuration)
+
+	_, err = rt.Get(ctx, testColor, 2)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+}
+
+func TestMasterRouteTableDelDelayIfSame(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, clock := newTestMasterRouteTable(t)
+
+	_, epoch, err := rt.GetSet(ctx, testColor, 1, "10.0.0.1:9000")
+	require.NoError(t, err)
+
+	err = rt.DelDelayIfSame(ctx, testColor, 1, "10.0.0.2:9000", epoch, time.Second)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableValueNotSame)
+
+	require.NoError(t, rt.DelDelayIfSame(ctx, testColor, 1, "10.0.0.1:9000", epoch, time.Second))
+
+	// the grace period lets in-flight messages land on the old owner
+	addr, err := rt.Get(ctx, testColor, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:9000", addr)
+
+	clock.Advance(time.Second)
+
+	_, err = rt.Get(ctx, testColor, 1)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	err = rt.DelDelayIfSame(ctx, testColor, 1, "10.0.0.1:9000", epoch, time.Second)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+}
+
+func TestMasterRouteTableRenewSelf(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, clock := newTestMasterRouteTable(t, routetable.WithTTL(time.Minute))
+
+	_, epoch, err := rt.GetSet(ctx, testColor, 1, "10.0.0.1:9000")
+	require.NoError(t, err)
+	clock.Advance(time.Second * 50)
+
+	require.NoError(t, rt.RenewSelf(ctx, testColor, 1, "10.0.0.1:9000", epoch))
+
+	err = rt.RenewSelf(ctx, testColor, 1, "10.0.0.2:9000", epoch)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableValueNotSame)
+
+	clock.Advance(time.Second * 50)
+
+	addr, err := rt.GetEx(ctx, testColor, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:9000", addr)
+}
+
+func TestMasterRouteTableEpoch(t *testing.T) {
+	t.Parallel()
+
+	const a, b = "10.0.0.1:9000", "10.0.0.2:9000"
+
+	ctx := context.Background()
+	rt, clock := newTestMasterRouteTable(t)
+
+	// an entry without epoch
+	require.NoError(t, rt.Restore(ctx, []routetable.Entry{{Color: testColor, OID: 1, RouteEntry: routetable.RouteEntry{Addr: a}}}))
+
+	addr, epoch, err := rt.GetWithEpoch(ctx, testColor, 1)
+	require.NoError(t, err)
+	assert.Equal(t, a, addr)
+	assert.Zero(t, epoch)
+
+	old, first, err := rt.GetSet(ctx, testColor, 1, b)
+	require.NoError(t, err)
+	assert.Equal(t, a, old)
+	assert.Equal(t, uint64(clock.Now().UnixMicro())+1, first)
+
+	// the epoch increases even if the clock does not
+	_, second, err := rt.GetSet(ctx, testColor, 1, a)
+	require.NoError(t, err)
+	assert.Equal(t, first+1, second)
+
+	clock.Advance(-time.Second)
+
+	third, err := rt.CompareAndSwap(ctx, testColor, 1, a, b)
+	require.NoError(t, err)
+	assert.Equal(t, second+1, third)
+
+	// the fenced owners can no longer renew or delete the route
+	require.ErrorIs(t, rt.RenewSelf(ctx, testColor, 1, b, first), xerrors.ErrRouteTableValueNotSame)
+	require.ErrorIs(t, rt.DelIfSame(ctx, testColor, 1, a, second), xerrors.ErrRouteTableValueNotSame)
+	require.NoError(t, rt.RenewSelf(ctx, testColor, 1, b, third))
+
+	// the epoch keeps increasing after the route is deleted, whatever the clock
+	require.NoError(t, rt.Del(ctx, testColor, 1))
+
+	_, _, fourth, err := rt.SetNxOrGet(ctx, testColor, 1, a)
+	require.NoError(t, err)
+	assert.Equal(t, third+1, fourth)
+}
+
+func TestMasterRouteTableWatch(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rt, clock := newTestMasterRouteTable(t)
+
+	one, err := rt.Watch(ctx, testColor, 1)
+	require.NoError(t, err)
+
+	all, err := rt.WatchAll(ctx, testColor)
+	require.NoError(t, err)
+
+	require.NoError(t, rt.Set(ctx, "red", 1, "10.0.0.9:9000"))
+	require.NoError(t, rt.Set(ctx, testColor, 2, "10.0.0.2:9000"))
+	require.NoError(t, rt.Set(ctx, testColor, 1, "10.0.0.1:9000"))
+	require.NoError(t, rt.Del(ctx, testColor, 1))
+
+	receive := func(ch <-chan routetable.Event) routetable.Event {
+		select {
+		case ev := <-ch:
+			return ev
+		case <-time.After(time.Second):
+			require.FailNow(t, "event not received")
+			return routetable.Event{}
+		}
+	}
+
+	assert.Equal(t, routetable.Event{Color: testColor, OID: 1, NewAddr: "10.0.0.1:9000", NewEpoch: uint64(clock.Now().UnixMicro()) + 1, Reason: routetable.EventSet}, receive(one))
+	assert.Equal(t, routetable.Event{Color: testColor, OID: 1, OldAddr: "10.0.0.1:9000", Reason: routetable.EventDeleted}, receive(one))
+
+	assert.Equal(t, int64(2), receive(all).OID)
+	assert.Equal(t, int64(1), receive(all).OID)
+	assert.Equal(t, routetable.EventDeleted, receive(all).Reason)
+}
+
+type unwatchableData struct {
+	routetable.Data
+}
+
+func TestWatchNotSupported(t *testing.T) {
+	t.Parallel()
+
+	rt := routetable.NewReadOnlyRouteTable(unwatchableData{}, testName)
+
+	_, err := rt.Watch(context.Background(), testColor, 1)
+	require.ErrorIs(t, err, routetable.ErrWatchNotSupported)
+}
+
+func TestMasterRouteTableBatchWrites(t *testing.T) {
+	t.Parallel()
+
+	const self, other = "10.0.0.1:9000", "10.0.0.2:9000"
+
+	ctx := context.Background()
+	rt, clock := newTestMasterRouteTable(t)
+
+	require.NoError(t, rt.Set(ctx, testColor, 2, other))
+
+	results, err := rt.BatchSetNxOrGet(ctx, testColor, []int64{1, 2, 3}, self)
+	require.NoError(t, err)
+
+	epoch := uint64(clock.Now().UnixMicro()) + 1
+	assert.Equal(t, []routetable.SetNxOrGetResult{
+		{Set: true, Addr: self, Epoch: epoch},
+		{Set: false, Addr: other, Epoch: epoch},
+		{Set: true, Addr: self, Epoch: epoch},
+	}, results)
+
+	errs, err := rt.BatchDelIfSame(ctx, testColor, []int64{1, 2, 4}, self, []uint64{epoch, epoch, epoch})
+	require.NoError(t, err)
+	require.Len(t, errs, 3)
+	require.NoError(t, errs[0])
+	require.ErrorIs(t, errs[1], xerrors.ErrRouteTableValueNotSame)
+	require.ErrorIs(t, errs[2], xerrors.ErrRouteTableNotFound)
+
+	errs, err = rt.BatchSet(ctx, testColor, []int64{2, 4}, self)
+	require.NoError(t, err)
+	assert.Equal(t, []error{nil, nil}, errs)
+
+	addrs, err := rt.BatchGet(ctx, testColor, []int64{1, 2, 3, 4})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", self, self, self}, addrs)
+
+	// the reassigned route has a new epoch
+	errs, err = rt.BatchRenewSelf(ctx, testColor, []int64{2, 5}, self, []uint64{epoch + 1, epoch})
+	require.NoError(t, err)
+	require.NoError(t, errs[0])
+	require.ErrorIs(t, errs[1], xerrors.ErrRouteTableNotFound)
+}
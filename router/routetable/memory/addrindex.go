@@ -0,0 +1,172 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+)
+
+var _ routetable.AddrIndex = (*AddrIndex)(nil)
+
+// WithAddrIndex returns an Option that makes the route table maintain an address index of the keys
+// encoded by codec, which must be the codec of the master route table. The index is returned by AddrIndex.
+func WithAddrIndex(codec routetable.KeyCodec) Option {
+	return func(r *RouteTable) {
+		if codec == nil {
+			codec = routetable.LegacyKeyCodec
+		}
+
+		r.index = &AddrIndex{
+			r:     r,
+			codec: codec,
+			sets:  make(map[string]map[int64]struct{}),
+		}
+	}
+}
+
+// AddrIndex implements the routetable.AddrIndex interface in process memory.
+// It is updated by the writes of its route table under the same lock, and an oid is removed
+// as soon as its entry is deleted or found expired.
+type AddrIndex struct {
+	r     *RouteTable
+	codec routetable.KeyCodec
+	// sets is guarded by the lock of r.
+	sets map[string]map[int64]struct{}
+}
+
+// AddrIndex returns the address index maintained by the route table,
+// or nil if it was not created with WithAddrIndex.
+func (r *RouteTable) AddrIndex() routetable.AddrIndex {
+	if r.index == nil {
+		return nil
+	}
+
+	return r.index
+}
+
+// move moves the oid of key from the index of the owner of old to the index of the owner of val.
+// Either value may be empty. Keys and values that are not routing entries are not indexed.
+// The caller must hold the write lock.
+func (x *AddrIndex) move(key, old, val string) {
+	name, color, oid, err := x.codec.Decode(key)
+	if err != nil {
+		return
+	}
+
+	from, to := owner(old), owner(val)
+	if from == to {
+		return
+	}
+
+	if from != "" {
+		x.remove(routetable.AddrIndexKey(name, color, from), oid)
+	}
+
+	if to != "" {
+		key := routetable.AddrIndexKey(name, color, to)
+
+		set, ok := x.sets[key]
+		if !ok {
+			set = make(map[int64]struct{})
+			x.sets[key] = set
+		}
+
+		set[oid] = struct{}{}
+	}
+}
+
+func (x *AddrIndex) remove(key string, oid int64) {
+	set, ok := x.sets[key]
+	if !ok {
+		return
+	}
+
+	delete(set, oid)
+
+	if len(set) == 0 {
+		delete(x.sets, key)
+	}
+}
+
+// owner returns the address of a stored value, or an empty string if it is empty or not a routing entry.
+func owner(val string) string {
+	if val == "" {
+		return ""
+	}
+
+	e, err := routetable.ParseRouteEntry(val)
+	if err != nil {
+		return ""
+	}
+
+	return e.Addr
+}
+
+// Prune removes the oids from the index of addr whose live entry is not routed to addr.
+func (x *AddrIndex) Prune(ctx context.Context, name, color, addr string, oids ...int64) error {
+	key := routetable.AddrIndexKey(name, color, addr)
+
+	return x.r.update(func(tx *tx) error {
+		for _, oid := range oids {
+			if e, ok := tx.load(x.codec.Encode(name, color, oid)); !ok || owner(e.value) != addr {
+				x.remove(key, oid)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Scan returns up to count oids recorded for addr in ascending order.
+// A non-zero cursor resumes after the last oid returned, so oids present during the whole
+// iteration are returned exactly once even if others are removed, as with SSCAN.
+func (x *AddrIndex) Scan(ctx context.Context, name, color, addr string, cursor uint64, count int64) ([]int64, uint64, error) {
+	key := routetable.AddrIndexKey(name, color, addr)
+
+	x.r.mu.RLock()
+
+	oids := make([]int64, 0, len(x.sets[key]))
+	for oid := range x.sets[key] {
+		if cursor == 0 || oidCursor(oid) >= cursor {
+			oids = append(oids, oid)
+		}
+	}
+
+	x.r.mu.RUnlock()
+
+	slices.Sort(oids)
+
+	if int64(len(oids)) <= max(count, 1) {
+		return oids, 0, nil
+	}
+
+	oids = oids[:max(count, 1)]
+
+	// the cursor of the largest oid overflows to 0, which correctly ends the iteration
+	return oids, oidCursor(oids[len(oids)-1]) + 1, nil
+}
+
+// oidCursor maps an oid to a cursor value preserving their order.
+func oidCursor(oid int64) uint64 {
+	return uint64(oid) ^ (1 << 63)
+}
+
+// Count returns the number of oids recorded for addr whose entry is live and routed to addr.
+// The oids of the entries that expired but have not been swept yet are skipped.
+func (x *AddrIndex) Count(ctx context.Context, name, color, addr string) (int64, error) {
+	x.r.mu.RLock()
+	defer x.r.mu.RUnlock()
+
+	now := x.r.now()
+
+	var n int64
+
+	for oid := range x.sets[routetable.AddrIndexKey(name, color, addr)] {
+		if e, ok := x.r.load(x.codec.Encode(name, color, oid), now); ok && owner(e.value) == addr {
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+)
+
+var _ routetable.Invalidator = (*Invalidator)(nil)
+
+// Invalidator implements the routetable.Invalidator interface within a single process.
+type Invalidator struct {
+	mu     sync.RWMutex
+	nextID uint64
+	subs   map[uint64]func(key string)
+}
+
+// NewInvalidator creates a new in-process invalidator.
+func NewInvalidator() *Invalidator {
+	return &Invalidator{
+		subs: make(map[uint64]func(key string)),
+	}
+}
+
+// Publish calls every subscriber with key synchronously.
+func (i *Invalidator) Publish(ctx context.Context, key string) error {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	for _, fn := range i.subs {
+		fn(key)
+	}
+
+	return nil
+}
+
+// Subscribe calls fn with routetable.InvalidateAll once subscribed, then with every published key until ctx is done.
+func (i *Invalidator) Subscribe(ctx context.Context, fn func(key string)) error {
+	i.mu.Lock()
+	id := i.nextID
+	i.nextID++
+	i.subs[id] = fn
+	i.mu.Unlock()
+
+	fn(routetable.InvalidateAll)
+
+	<-ctx.Done()
+
+	i.mu.Lock()
+	delete(i.subs, id)
+	i.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,708 @@
+// Package memory provides an in-process implementation of the route table.
+// It is intended for single-node deployments and tests that should not depend on Redis.
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"github.com/go-pantheon/fabrica-util/xsync"
+)
+
+const (
+	defaultSweepInterval = time.Second
+)
+
+var (
+	_ routetable.Data    = (*RouteTable)(nil)
+	_ routetable.Watcher = (*RouteTable)(nil)
+)
+
+// Option is a function type that configures a RouteTable instance.
+type Option func(*RouteTable)
+
+// WithClock returns an Option that replaces the clock used to evaluate expiration.
+// It is mainly used by tests to control the passing of time.
+func WithClock(now func() time.Time) Option {
+	return func(r *RouteTable) {
+		if now != nil {
+			r.now = now
+		}
+	}
+}
+
+// WithSweepInterval returns an Option that sets how often expired entries are purged.
+// dur must be greater than 0, otherwise the default interval will be used.
+func WithSweepInterval(dur time.Duration) Option {
+	return func(r *RouteTable) {
+		if dur <= 0 {
+			dur = defaultSweepInterval
+		}
+
+		r.sweepInterval = dur
+	}
+}
+
+type entry struct {
+	value    string
+	expireAt time.Time // zero means the entry never expires
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+// RouteTable implements the routetable.Data and routetable.Watcher interfaces in process memory.
+// Expired entries are invisible to readers immediately and are purged by a background sweeper,
+// which is also when their expired events are delivered.
+type RouteTable struct {
+	mu      sync.RWMutex
+	entries map[string]*entry
+	// epochs holds the last epoch allocated for every live key that has been assigned, see Assign.
+	// The epoch of a key is moved into epochFloor when its entry expires or is deleted,
+	// and the next assignment of the key starts above it, so that its epochs keep increasing.
+	epochs     map[string]uint64
+	epochFloor uint64
+	index      *AddrIndex
+	watchers   *watchers
+
+	now           func() time.Time
+	sweepInterval time.Duration
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// New creates a new in-memory route table data store and starts its expiry sweeper.
+// Close must be called to stop the sweeper.
+func New(opts ...Option) *RouteTable {
+	r := &RouteTable{
+		entries:       make(map[string]*entry),
+		epochs:        make(map[string]uint64),
+		watchers:      newWatchers(),
+		now:           time.Now,
+		sweepInterval: defaultSweepInterval,
+		closed:        make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	xsync.Go("routetable.memory.sweep", func() error {
+		r.sweepLoop()
+		return nil
+	})
+
+	return r
+}
+
+// Close stops the background sweeper. It is safe to call Close more than once.
+func (r *RouteTable) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+
+	return nil
+}
+
+func (r *RouteTable) sweepLoop() {
+	ticker := time.NewTicker(r.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.closed:
+			return
+		case <-ticker.C:
+			r.Sweep()
+		}
+	}
+}
+
+// Sweep removes every expired entry and returns the number of entries removed.
+func (r *RouteTable) Sweep() int {
+	count := 0
+
+	_ = r.update(func(tx *tx) error {
+		for k := range r.entries {
+			if _, ok := tx.load(k); !ok {
+				count++
+			}
+		}
+
+		return nil
+	})
+
+	return count
+}
+
+// Len returns the number of live entries.
+func (r *RouteTable) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := r.now()
+	count := 0
+
+	for _, e := range r.entries {
+		if !e.expired(now) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// load returns the live entry of key without removing it if it has expired.
+// The caller must hold the read lock.
+func (r *RouteTable) load(key string, now time.Time) (*entry, bool) {
+	e, ok := r.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if e.expired(now) {
+		return nil, false
+	}
+
+	return e, true
+}
+
+// update runs fn under the write lock and then delivers the events it recorded to the watchers.
+func (r *RouteTable) update(fn func(tx *tx) error) error {
+	r.mu.Lock()
+
+	tx := &tx{r: r, now: r.now()}
+	err := fn(tx)
+
+	r.mu.Unlock()
+
+	r.watchers.publish(tx.events)
+
+	return err
+}
+
+// tx is a write operation in progress. It records the events of the changes it makes.
+type tx struct {
+	r      *RouteTable
+	now    time.Time
+	events []routetable.DataEvent
+}
+
+// load returns the live entry of key, removing it if it has expired.
+func (tx *tx) load(key string) (*entry, bool) {
+	e, ok := tx.r.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if e.expired(tx.now) {
+		delete(tx.r.entries, key)
+		tx.forgetEpoch(key)
+		tx.reindex(key, e.value, "")
+		tx.emit(key, e.value, "", routetable.EventExpired)
+
+		return nil, false
+	}
+
+	return e, true
+}
+
+// store sets the value of key, see routetable.Data: a positive ttl expires the entry
+// and a non-positive ttl persists it.
+func (tx *tx) store(key, val string, ttl time.Duration) {
+	var old string
+
+	e, ok := tx.load(key)
+	if ok {
+		old = e.value
+	} else {
+		e = &entry{}
+		tx.r.entries[key] = e
+	}
+
+	e.value = val
+	tx.reindex(key, old, val)
+
+	if ttl > 0 {
+		e.expireAt = tx.now.Add(ttl)
+	} else {
+		e.expireAt = time.Time{}
+	}
+
+	if !ok || old != val {
+		tx.emit(key, old, val, routetable.EventSet)
+	}
+}
+
+// expire sets the expiration of a live entry. A non-positive expiration deletes it.
+func (tx *tx) expire(key string, e *entry, exp time.Duration) {
+	if exp <= 0 {
+		tx.del(key, e)
+		return
+	}
+
+	e.expireAt = tx.now.Add(exp)
+}
+
+// del deletes a live entry.
+func (tx *tx) del(key string, e *entry) {
+	delete(tx.r.entries, key)
+	tx.forgetEpoch(key)
+	tx.reindex(key, e.value, "")
+	tx.emit(key, e.value, "", routetable.EventDeleted)
+}
+
+// forgetEpoch drops the epoch of a removed entry, raising the floor of the epochs to it.
+func (tx *tx) forgetEpoch(key string) {
+	if epoch, ok := tx.r.epochs[key]; ok {
+		tx.r.epochFloor = max(tx.r.epochFloor, epoch)
+		delete(tx.r.epochs, key)
+	}
+}
+
+// reindex moves key in the address index, if any, from the owner of old to the owner of val.
+func (tx *tx) reindex(key, old, val string) {
+	if tx.r.index != nil {
+		tx.r.index.move(key, old, val)
+	}
+}
+
+func (tx *tx) emit(key, old, val string, reason routetable.EventReason) {
+	if tx.r.watchers.empty() {
+		return
+	}
+
+	tx.events = append(tx.events, routetable.DataEvent{Key: key, Old: old, New: val, Reason: reason})
+}
+
+// Get retrieves a value by key.
+func (r *RouteTable) Get(ctx context.Context, key string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.load(key, r.now())
+	if !ok {
+		return "", xerrors.ErrRouteTableNotFoundFunc(key)
+	}
+
+	return e.value, nil
+}
+
+// GetEx loads a value and resets its expiration time.
+// A zero expiration persists the entry and a negative one leaves it unchanged.
+func (r *RouteTable) GetEx(ctx context.Context, key string, exp time.Duration) (val string, err error) {
+	err = r.update(func(tx *tx) error {
+		e, ok := tx.load(key)
+		if !ok {
+			return xerrors.ErrRouteTableNotFoundFunc(key)
+		}
+
+		switch {
+		case exp > 0:
+			e.expireAt = tx.now.Add(exp)
+		case exp == 0:
+			e.expireAt = time.Time{}
+		}
+
+		val = e.value
+
+		return nil
+	})
+
+	return val, err
+}
+
+// BatchGet retrieves the values of keys in order. Missing keys produce an empty string.
+func (r *RouteTable) BatchGet(ctx context.Context, keys []string) (addrs []string, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := r.now()
+
+	addrs = make([]string, 0, len(keys))
+	for _, key := range keys {
+		if e, ok := r.load(key, now); ok {
+			addrs = append(addrs, e.value)
+		} else {
+			addrs = append(addrs, "")
+		}
+	}
+
+	return addrs, nil
+}
+
+// BatchGetWithTTL retrieves the values and remaining time to live of keys in order.
+// Missing keys produce an empty string, and keys that do not expire a zero TTL.
+func (r *RouteTable) BatchGetWithTTL(ctx context.Context, keys []string) (addrs []string, ttls []time.Duration, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := r.now()
+
+	addrs = make([]string, len(keys))
+	ttls = make([]time.Duration, len(keys))
+
+	for i, key := range keys {
+		e, ok := r.load(key, now)
+		if !ok {
+			continue
+		}
+
+		addrs[i] = e.value
+
+		if !e.expireAt.IsZero() {
+			ttls[i] = e.expireAt.Sub(now)
+		}
+	}
+
+	return addrs, ttls, nil
+}
+
+// Scan returns up to count live keys matching the glob pattern match in ascending order.
+// An empty match matches every key. The cursor is the offset of the next page in the sorted keys,
+// so keys added or removed during the iteration can shift the pages.
+func (r *RouteTable) Scan(ctx context.Context, match string, cursor uint64, count int64) ([]string, uint64, error) {
+	r.mu.RLock()
+
+	now := r.now()
+	keys := make([]string, 0)
+
+	for key, e := range r.entries {
+		if !e.expired(now) && (match == "" || routetable.MatchPattern(match, key)) {
+			keys = append(keys, key)
+		}
+	}
+
+	r.mu.RUnlock()
+
+	slices.Sort(keys)
+
+	start := min(cursor, uint64(len(keys)))
+	end := min(start+uint64(max(count, 1)), uint64(len(keys)))
+
+	if end == uint64(len(keys)) {
+		return keys[start:end], 0, nil
+	}
+
+	return keys[start:end], end, nil
+}
+
+// GetSet atomically sets a new value and returns the old value.
+// The old value is empty if the key did not exist.
+func (r *RouteTable) GetSet(ctx context.Context, key, val string, expire time.Duration) (old string, err error) {
+	err = r.update(func(tx *tx) error {
+		if e, ok := tx.load(key); ok {
+			old = e.value
+		}
+
+		tx.store(key, val, expire)
+
+		return nil
+	})
+
+	return old, err
+}
+
+// Set stores a key-value pair with an expiration time.
+func (r *RouteTable) Set(ctx context.Context, key, val string, expire time.Duration) error {
+	return r.update(func(tx *tx) error {
+		tx.store(key, val, expire)
+		return nil
+	})
+}
+
+// SetNxOrGet sets a key-value pair only if the key does not exist.
+// It returns the current value if the key already exists.
+func (r *RouteTable) SetNxOrGet(ctx context.Context, key, val string, expire time.Duration) (set bool, ret string, err error) {
+	err = r.update(func(tx *tx) error {
+		if e, ok := tx.load(key); ok {
+			ret = e.value
+			return nil
+		}
+
+		tx.store(key, val, expire)
+		set, ret = true, val
+
+		return nil
+	})
+
+	return set, ret, err
+}
+
+// Assign sets key to val with a new epoch if the condition of mode holds, see routetable.Data.
+// The epochs of a key are counted from the clock in microseconds the first time it is assigned,
+// or since it was removed, and never fall below the epochs of the removed keys.
+func (r *RouteTable) Assign(ctx context.Context, mode routetable.AssignMode, key, expect, val string, expire time.Duration) (ret routetable.AssignResult, err error) {
+	err = r.update(func(tx *tx) error {
+		ret, err = tx.assign(mode, key, expect, val, expire)
+		return err
+	})
+
+	return ret, err
+}
+
+// BatchAssign runs Assign on every key with the values of the same index atomically.
+func (r *RouteTable) BatchAssign(ctx context.Context, mode routetable.AssignMode, keys, expects, vals []string, expire time.Duration) ([]routetable.AssignResult, error) {
+	if len(keys) != len(expects) || len(keys) != len(vals) {
+		return nil, errors.Errorf("batch assign got %d keys, %d expected values and %d values", len(keys), len(expects), len(vals))
+	}
+
+	results := make([]routetable.AssignResult, len(keys))
+
+	_ = r.update(func(tx *tx) error {
+		for i, key := range keys {
+			ret, err := tx.assign(mode, key, expects[i], vals[i], expire)
+			ret.Err = err
+			results[i] = ret
+		}
+
+		return nil
+	})
+
+	return results, nil
+}
+
+// assign runs an assignment of key, see Assign.
+func (tx *tx) assign(mode routetable.AssignMode, key, expect, val string, expire time.Duration) (routetable.AssignResult, error) {
+	var (
+		prev  string
+		epoch uint64
+	)
+
+	e, ok := tx.load(key)
+
+	switch {
+	case ok && mode == routetable.AssignIfAbsent:
+		return routetable.AssignResult{Value: e.value}, nil
+	case ok:
+		cur, err := routetable.ParseRouteEntry(e.value)
+		if err != nil {
+			return routetable.AssignResult{}, errors.WithMessagef(err, "key=%s", key)
+		}
+
+		if mode == routetable.AssignIfAddr && cur.Addr != expect {
+			return routetable.AssignResult{Value: e.value}, xerrors.ErrRouteTableValueNotSameFunc(key, expect)
+		}
+
+		prev, epoch = e.value, cur.Epoch
+	case mode == routetable.AssignIfAddr:
+		return routetable.AssignResult{}, xerrors.ErrRouteTableNotFoundFunc(key)
+	}
+
+	last, ok := tx.r.epochs[key]
+	if !ok {
+		last = max(tx.r.epochFloor, uint64(tx.now.UnixMicro()))
+	}
+
+	epoch = max(last, epoch) + 1
+
+	val, err := routetable.ReplaceEpoch(val, epoch)
+	if err != nil {
+		return routetable.AssignResult{}, errors.WithMessagef(err, "key=%s", key)
+	}
+
+	tx.r.epochs[key] = epoch
+	tx.store(key, val, expire)
+
+	return routetable.AssignResult{Assigned: true, Prev: prev, Value: val}, nil
+}
+
+// BatchSet runs Set on every key with the value of the same index atomically.
+func (r *RouteTable) BatchSet(ctx context.Context, keys, vals []string, expire time.Duration) ([]error, error) {
+	ttls := make([]time.Duration, len(keys))
+	for i := range ttls {
+		ttls[i] = expire
+	}
+
+	return r.BatchSetWithTTL(ctx, keys, vals, ttls)
+}
+
+// BatchSetWithTTL runs Set on every key with the value and the expiration time of the same index atomically.
+func (r *RouteTable) BatchSetWithTTL(ctx context.Context, keys, vals []string, expires []time.Duration) ([]error, error) {
+	if len(keys) != len(vals) || len(keys) != len(expires) {
+		return nil, errors.Errorf("batch got %d keys, %d values and %d expiration times", len(keys), len(vals), len(expires))
+	}
+
+	_ = r.update(func(tx *tx) error {
+		for i, key := range keys {
+			tx.store(key, vals[i], expires[i])
+		}
+
+		return nil
+	})
+
+	return make([]error, len(keys)), nil
+}
+
+// BatchSetNxOrGet runs SetNxOrGet on every key with the value of the same index atomically.
+func (r *RouteTable) BatchSetNxOrGet(ctx context.Context, keys, vals []string, expire time.Duration) ([]routetable.SetNxOrGetResult, error) {
+	if len(keys) != len(vals) {
+		return nil, errors.Errorf("batch got %d keys and %d values", len(keys), len(vals))
+	}
+
+	results := make([]routetable.SetNxOrGetResult, len(keys))
+
+	_ = r.update(func(tx *tx) error {
+		for i, key := range keys {
+			if e, ok := tx.load(key); ok {
+				results[i] = routetable.SetNxOrGetResult{Addr: e.value}
+				continue
+			}
+
+			tx.store(key, vals[i], expire)
+			results[i] = routetable.SetNxOrGetResult{Set: true, Addr: vals[i]}
+		}
+
+		return nil
+	})
+
+	return results, nil
+}
+
+// CompareAndSwap sets key to val only if its current value is old.
+func (r *RouteTable) CompareAndSwap(ctx context.Context, key, old, val string, expire time.Duration) error {
+	errs, err := r.BatchCompareAndSwap(ctx, []string{key}, []string{old}, []string{val}, expire)
+	if err != nil {
+		return err
+	}
+
+	return errs[0]
+}
+
+// BatchCompareAndSwap runs CompareAndSwap on every key with the values of the same index atomically.
+func (r *RouteTable) BatchCompareAndSwap(ctx context.Context, keys, olds, vals []string, expire time.Duration) ([]error, error) {
+	if len(keys) != len(vals) {
+		return nil, errors.Errorf("batch got %d keys and %d values", len(keys), len(vals))
+	}
+
+	return r.batchIfSame(keys, olds, func(tx *tx, i int, key string, e *entry) {
+		tx.store(key, vals[i], expire)
+	})
+}
+
+// Expire sets an expiration time for a key. A non-positive expiration deletes the key.
+// Like Redis EXPIRE, it is not an error if the key does not exist.
+func (r *RouteTable) Expire(ctx context.Context, key string, expire time.Duration) error {
+	return r.update(func(tx *tx) error {
+		if e, ok := tx.load(key); ok {
+			tx.expire(key, e, expire)
+		}
+
+		return nil
+	})
+}
+
+// ExpireIfSame sets an expiration time for a key only if its current value matches the expected value.
+func (r *RouteTable) ExpireIfSame(ctx context.Context, key, expect string, expire time.Duration) error {
+	return r.update(func(tx *tx) error {
+		e, ok := tx.load(key)
+		if !ok {
+			return xerrors.ErrRouteTableNotFoundFunc(key)
+		}
+
+		if e.value != expect {
+			return xerrors.ErrRouteTableValueNotSameFunc(key, expect)
+		}
+
+		tx.expire(key, e, expire)
+
+		return nil
+	})
+}
+
+// BatchExpireIfSame runs ExpireIfSame on every key with the value of the same index atomically.
+func (r *RouteTable) BatchExpireIfSame(ctx context.Context, keys, values []string, expire time.Duration) ([]error, error) {
+	return r.batchIfSame(keys, values, func(tx *tx, _ int, key string, e *entry) {
+		tx.expire(key, e, expire)
+	})
+}
+
+// BatchDelIfSame runs DelIfSame on every key with the value of the same index atomically.
+func (r *RouteTable) BatchDelIfSame(ctx context.Context, keys, values []string) ([]error, error) {
+	return r.batchIfSame(keys, values, func(tx *tx, _ int, key string, e *entry) {
+		tx.del(key, e)
+	})
+}
+
+// batchIfSame runs fn on the entry of every key whose value matches the value of the same index.
+func (r *RouteTable) batchIfSame(keys, values []string, fn func(tx *tx, i int, key string, e *entry)) ([]error, error) {
+	if len(keys) != len(values) {
+		return nil, errors.Errorf("batch got %d keys and %d values", len(keys), len(values))
+	}
+
+	errs := make([]error, len(keys))
+
+	_ = r.update(func(tx *tx) error {
+		for i, key := range keys {
+			e, ok := tx.load(key)
+
+			switch {
+			case !ok:
+				errs[i] = xerrors.ErrRouteTableNotFoundFunc(key)
+			case e.value != values[i]:
+				errs[i] = xerrors.ErrRouteTableValueNotSameFunc(key, values[i])
+			default:
+				fn(tx, i, key, e)
+			}
+		}
+
+		return nil
+	})
+
+	return errs, nil
+}
+
+// Del deletes a key. It is not an error if the key does not exist.
+func (r *RouteTable) Del(ctx context.Context, key string) error {
+	return r.update(func(tx *tx) error {
+		if e, ok := tx.load(key); ok {
+			tx.del(key, e)
+		}
+
+		return nil
+	})
+}
+
+// DelIfSame deletes a key only if its current value matches the specified value.
+func (r *RouteTable) DelIfSame(ctx context.Context, key, expect string) error {
+	return r.update(func(tx *tx) error {
+		e, ok := tx.load(key)
+		if !ok {
+			return xerrors.ErrRouteTableNotFoundFunc(key)
+		}
+
+		if e.value != expect {
+			return xerrors.ErrRouteTableValueNotSameFunc(key, expect)
+		}
+
+		tx.del(key, e)
+
+		return nil
+	})
+}
+
+// Watch streams the changes of the keys matching the glob pattern until ctx is done or the table is closed.
+// Events are dropped with a warning if the receiver falls behind by more than the channel capacity.
+func (r *RouteTable) Watch(ctx context.Context, pattern string) (<-chan routetable.DataEvent, error) {
+	w := r.watchers.add(pattern)
+
+	xsync.Go("routetable.memory.watch", func() error {
+		select {
+		case <-ctx.Done():
+		case <-r.closed:
+		}
+
+		r.watchers.remove(w)
+
+		return nil
+	})
+
+	return w.ch, nil
+}
@@ -0,0 +1,321 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/internal/datatest"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/internal/testclock"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRouteTable(t *testing.T) (*RouteTable, *testclock.Clock) {
+	t.Helper()
+
+	clock := testclock.New(time.Unix(1700000000, 0))
+	rt := New(WithClock(clock.Now), WithSweepInterval(time.Hour))
+
+	t.Cleanup(func() {
+		_ = rt.Close()
+	})
+
+	return rt, clock
+}
+
+func TestSetGetExpire(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, clock := newTestRouteTable(t)
+
+	require.NoError(t, rt.Set(ctx, "k", "a", time.Second))
+
+	v, err := rt.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "a", v)
+
+	clock.Advance(time.Second)
+
+	_, err = rt.Get(ctx, "k")
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	require.NoError(t, rt.Set(ctx, "forever", "b", 0))
+	clock.Advance(time.Hour * 24 * 365)
+
+	v, err = rt.Get(ctx, "forever")
+	require.NoError(t, err)
+	assert.Equal(t, "b", v)
+}
+
+func TestTTL(t *testing.T) {
+	t.Parallel()
+
+	rt, _ := newTestRouteTable(t)
+	datatest.TestTTL(t, rt)
+}
+
+func TestGetEx(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, clock := newTestRouteTable(t)
+
+	_, err := rt.GetEx(ctx, "k", time.Second)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	require.NoError(t, rt.Set(ctx, "k", "a", time.Second))
+	clock.Advance(time.Millisecond * 900)
+
+	v, err := rt.GetEx(ctx, "k", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "a", v)
+
+	clock.Advance(time.Millisecond * 900)
+
+	v, err = rt.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "a", v)
+}
+
+func TestSetNxOrGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, clock := newTestRouteTable(t)
+
+	ok, v, err := rt.SetNxOrGet(ctx, "k", "a", time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "a", v)
+
+	ok, v, err = rt.SetNxOrGet(ctx, "k", "b", time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "a", v)
+
+	clock.Advance(time.Second)
+
+	ok, v, err = rt.SetNxOrGet(ctx, "k", "b", time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "b", v)
+}
+
+func TestGetSet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, clock := newTestRouteTable(t)
+
+	old, err := rt.GetSet(ctx, "k", "a", time.Second)
+	require.NoError(t, err)
+	assert.Empty(t, old)
+
+	old, err = rt.GetSet(ctx, "k", "b", time.Second*2)
+	require.NoError(t, err)
+	assert.Equal(t, "a", old)
+
+	clock.Advance(time.Second)
+
+	v, err := rt.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "b", v)
+}
+
+func TestExpireIfSame(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, clock := newTestRouteTable(t)
+
+	err := rt.ExpireIfSame(ctx, "k", "a", time.Second)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	require.NoError(t, rt.Set(ctx, "k", "a", time.Second))
+
+	err = rt.ExpireIfSame(ctx, "k", "b", time.Minute)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableValueNotSame)
+
+	require.NoError(t, rt.ExpireIfSame(ctx, "k", "a", time.Minute))
+	clock.Advance(time.Second * 30)
+
+	_, err = rt.Get(ctx, "k")
+	require.NoError(t, err)
+
+	require.NoError(t, rt.Expire(ctx, "k", time.Second))
+	clock.Advance(time.Second)
+
+	_, err = rt.Get(ctx, "k")
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	require.NoError(t, rt.Expire(ctx, "missing", time.Second))
+}
+
+func TestDel(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, _ := newTestRouteTable(t)
+
+	require.NoError(t, rt.Del(ctx, "missing"))
+
+	err := rt.DelIfSame(ctx, "k", "a")
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	require.NoError(t, rt.Set(ctx, "k", "a", time.Second))
+
+	err = rt.DelIfSame(ctx, "k", "b")
+	require.ErrorIs(t, err, xerrors.ErrRouteTableValueNotSame)
+
+	require.NoError(t, rt.DelIfSame(ctx, "k", "a"))
+
+	_, err = rt.Get(ctx, "k")
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+}
+
+func TestBatchGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, clock := newTestRouteTable(t)
+
+	require.NoError(t, rt.Set(ctx, "a", "1", time.Second))
+	require.NoError(t, rt.Set(ctx, "b", "2", time.Minute))
+	clock.Advance(time.Second)
+
+	addrs, err := rt.BatchGet(ctx, []string{"a", "b", "c"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "2", ""}, addrs)
+}
+
+func TestSweep(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, clock := newTestRouteTable(t)
+
+	require.NoError(t, rt.Set(ctx, "a", "1", time.Second))
+	require.NoError(t, rt.Set(ctx, "b", "2", time.Minute))
+	assert.Equal(t, 2, rt.Len())
+
+	clock.Advance(time.Second)
+	assert.Equal(t, 1, rt.Len())
+	assert.Equal(t, 1, rt.Sweep())
+	assert.Equal(t, 0, rt.Sweep())
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rt, clock := newTestRouteTable(t)
+
+	events, err := rt.Watch(ctx, "k*")
+	require.NoError(t, err)
+
+	require.NoError(t, rt.Set(ctx, "k1", "a", time.Second))
+	require.NoError(t, rt.Set(ctx, "k1", "a", time.Second))
+	require.NoError(t, rt.Set(ctx, "other", "a", time.Second))
+	_, err = rt.GetSet(ctx, "k1", "b", time.Second)
+	require.NoError(t, err)
+	require.NoError(t, rt.Set(ctx, "k2", "c", time.Second))
+	require.NoError(t, rt.Del(ctx, "k2"))
+
+	clock.Advance(time.Second)
+	rt.Sweep()
+
+	expected := []routetable.DataEvent{
+		{Key: "k1", New: "a", Reason: routetable.EventSet},
+		{Key: "k1", Old: "a", New: "b", Reason: routetable.EventSet},
+		{Key: "k2", New: "c", Reason: routetable.EventSet},
+		{Key: "k2", Old: "c", Reason: routetable.EventDeleted},
+		{Key: "k1", Old: "b", Reason: routetable.EventExpired},
+	}
+
+	for _, want := range expected {
+		select {
+		case got := <-events:
+			assert.Equal(t, want, got)
+		case <-time.After(time.Second):
+			require.FailNow(t, "event not received", "want=%+v", want)
+		}
+	}
+
+	cancel()
+
+	for range events {
+	}
+}
+
+func TestBatchExpireIfSame(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, clock := newTestRouteTable(t)
+
+	require.NoError(t, rt.Set(ctx, "k1", "a", time.Second))
+	require.NoError(t, rt.Set(ctx, "k2", "b", time.Second))
+
+	errs, err := rt.BatchExpireIfSame(ctx, []string{"k1", "k2", "k3"}, []string{"a", "a", "a"}, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, errs, 3)
+	require.NoError(t, errs[0])
+	require.ErrorIs(t, errs[1], xerrors.ErrRouteTableValueNotSame)
+	require.ErrorIs(t, errs[2], xerrors.ErrRouteTableNotFound)
+
+	clock.Advance(time.Second)
+
+	_, err = rt.Get(ctx, "k1")
+	require.NoError(t, err)
+
+	_, err = rt.Get(ctx, "k2")
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	_, err = rt.BatchExpireIfSame(ctx, []string{"k1"}, nil, time.Minute)
+	require.Error(t, err)
+}
+
+func TestAssignEpochs(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, clock := newTestRouteTable(t)
+
+	val, err := routetable.RouteEntry{Addr: "10.0.0.1:9000"}.MarshalBinary()
+	require.NoError(t, err)
+
+	first, err := rt.Assign(ctx, routetable.AssignAlways, "k", "", string(val), time.Second)
+	require.NoError(t, err)
+
+	second, err := rt.Assign(ctx, routetable.AssignAlways, "k", "", string(val), time.Second)
+	require.NoError(t, err)
+
+	epoch := func(ret routetable.AssignResult) uint64 {
+		e, err := routetable.ParseRouteEntry(ret.Value)
+		require.NoError(t, err)
+
+		return e.Epoch
+	}
+	assert.Equal(t, epoch(first)+1, epoch(second))
+
+	// the epochs are evicted with their entries
+	clock.Advance(time.Second)
+	assert.Equal(t, 1, rt.Sweep())
+	assert.Empty(t, rt.epochs)
+
+	// and the next epochs stay above them, whatever the clock
+	clock.Advance(-time.Hour)
+
+	third, err := rt.Assign(ctx, routetable.AssignIfAbsent, "k", "", string(val), 0)
+	require.NoError(t, err)
+	assert.Equal(t, epoch(second)+1, epoch(third))
+
+	require.NoError(t, rt.Del(ctx, "k"))
+	assert.Empty(t, rt.epochs)
+}
@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+)
+
+const watchBufferSize = 1024
+
+type watcher struct {
+	pattern string
+	ch      chan routetable.DataEvent
+}
+
+// watchers is the set of active watches of a RouteTable.
+type watchers struct {
+	mu  sync.RWMutex
+	set map[*watcher]struct{}
+}
+
+func newWatchers() *watchers {
+	return &watchers{
+		set: make(map[*watcher]struct{}),
+	}
+}
+
+func (ws *watchers) empty() bool {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	return len(ws.set) == 0
+}
+
+func (ws *watchers) add(pattern string) *watcher {
+	w := &watcher{
+		pattern: pattern,
+		ch:      make(chan routetable.DataEvent, watchBufferSize),
+	}
+
+	ws.mu.Lock()
+	ws.set[w] = struct{}{}
+	ws.mu.Unlock()
+
+	return w
+}
+
+func (ws *watchers) remove(w *watcher) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	delete(ws.set, w)
+	close(w.ch)
+}
+
+func (ws *watchers) publish(events []routetable.DataEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	for w := range ws.set {
+		for _, ev := range events {
+			if !routetable.MatchPattern(w.pattern, ev.Key) {
+				continue
+			}
+
+			select {
+			case w.ch <- ev:
+			default:
+				log.Warnf("route table watcher is full, event dropped. pattern=%s key=%s reason=%s", w.pattern, ev.Key, ev.Reason)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package routetable
+
+import "time"
+
+const (
+	defaultTTL = time.Hour * 24
+)
+
+// Option is a function type that configures a route table instance.
+type Option func(*options)
+
+type options struct {
+	ttl         time.Duration
+	codec       KeyCodec
+	invalidator Invalidator
+	addrIndex   AddrIndex
+	now         func() time.Time
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		ttl:   defaultTTL,
+		codec: LegacyKeyCodec,
+		now:   time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// WithTTL returns an Option that sets the time-to-live for route table entries.
+// dur must be greater than 0, otherwise the default TTL will be used.
+func WithTTL(dur time.Duration) Option {
+	return func(o *options) {
+		if dur <= 0 {
+			dur = defaultTTL
+		}
+
+		o.ttl = dur
+	}
+}
+
+// WithKeyCodec returns an Option that sets how route table keys are encoded.
+// Use V1KeyCodec for new route tables; existing route tables must keep LegacyKeyCodec,
+// or be migrated with Export and Import, as their routes are not found under the keys of another codec.
+// codec must not be nil, otherwise LegacyKeyCodec will be used.
+func WithKeyCodec(codec KeyCodec) Option {
+	return func(o *options) {
+		if codec == nil {
+			codec = LegacyKeyCodec
+		}
+
+		o.codec = codec
+	}
+}
+
+// WithInvalidator returns an Option that publishes the key of every routing entry
+// changed through a master route table, so that caches of other processes can drop it.
+func WithInvalidator(inv Invalidator) Option {
+	return func(o *options) {
+		o.invalidator = inv
+	}
+}
+
+// WithAddrIndex returns an Option that sets the address index maintained by the data store,
+// such as the one returned by memory.RouteTable.AddrIndex, which enables ListByAddr and CountByAddr.
+func WithAddrIndex(idx AddrIndex) Option {
+	return func(o *options) {
+		o.addrIndex = idx
+	}
+}
+
+// WithClock returns an Option that replaces the clock that stamps the AssignedAt of the routing entries.
+// It is mainly used by tests to control the passing of time.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		if now != nil {
+			o.now = now
+		}
+	}
+}
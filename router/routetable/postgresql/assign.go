@@ -0,0 +1,246 @@
+package postgresql
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"github.com/jackc/pgx/v5"
+)
+
+// Assign sets key to val with a new epoch if the condition of mode holds, see routetable.Data.
+// The epochs are allocated from a sequence of the table, see CreateTable, and are greater than the
+// epoch of the value they replace, in a transaction that locks the row of key.
+func (r *RouteTable) Assign(ctx context.Context, mode routetable.AssignMode, key, expect, val string, expire time.Duration) (routetable.AssignResult, error) {
+	for range maxSetNxOrGetAttempts {
+		results, raced, err := r.assign(ctx, mode, []string{key}, []string{expect}, []string{val}, ttlArg(expire))
+		if err != nil {
+			return routetable.AssignResult{}, err
+		}
+
+		if len(raced) == 0 {
+			ret := results[0]
+			err, ret.Err = ret.Err, nil
+
+			return ret, err
+		}
+
+		// the key has been inserted concurrently, so lock it and try again
+	}
+
+	return routetable.AssignResult{}, errors.Errorf("assign kept racing with concurrent inserts. key=%s", key)
+}
+
+// BatchAssign runs Assign on every key with the values of the same index in one transaction.
+// The keys inserted concurrently are assigned again one by one.
+func (r *RouteTable) BatchAssign(ctx context.Context, mode routetable.AssignMode, keys, expects, vals []string, expire time.Duration) ([]routetable.AssignResult, error) {
+	if len(keys) != len(expects) || len(keys) != len(vals) {
+		return nil, errors.Errorf("batch assign got %d keys, %d expected values and %d values", len(keys), len(expects), len(vals))
+	}
+
+	results, raced, err := r.assign(ctx, mode, keys, expects, vals, ttlArg(expire))
+	if err != nil {
+		return nil, errors.WithMessagef(err, "batch assign route table failed. keys=%d", len(keys))
+	}
+
+	for _, i := range raced {
+		ret, err := r.Assign(ctx, mode, keys[i], expects[i], vals[i], expire)
+		ret.Err = err
+		results[i] = ret
+	}
+
+	return results, nil
+}
+
+// assign runs the assignments of keys in one transaction and returns their results.
+// raced holds the indexes of the keys that did not exist and have been inserted concurrently,
+// whose results are not set.
+func (r *RouteTable) assign(ctx context.Context, mode routetable.AssignMode, keys, expects, vals []string, ttl int64) (results []routetable.AssignResult, raced []int, err error) {
+	for i, val := range vals {
+		if _, err := routetable.ReplaceEpoch(val, 0); err != nil {
+			return nil, nil, errors.WithMessagef(err, "key=%s", keys[i])
+		}
+	}
+
+	err = pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		results = make([]routetable.AssignResult, len(keys))
+
+		rows, err := r.lockRows(ctx, tx, keys)
+		if err != nil {
+			return err
+		}
+
+		// the indexes of the keys to assign in the order of their keys, with the epochs they replace
+		var (
+			assigning = make([]int, 0, len(keys))
+			prevs     = make(map[int]uint64, len(keys))
+		)
+
+		for i, key := range keys {
+			row, ok := rows[key]
+			if ok && !row.alive {
+				ok = false
+			}
+
+			switch {
+			case ok && mode == routetable.AssignIfAbsent:
+				results[i] = routetable.AssignResult{Value: row.value}
+				continue
+			case ok:
+				cur, err := routetable.ParseRouteEntry(row.value)
+				if err != nil {
+					results[i].Err = errors.WithMessagef(err, "key=%s", key)
+					continue
+				}
+
+				if mode == routetable.AssignIfAddr && cur.Addr != expects[i] {
+					results[i] = routetable.AssignResult{Value: row.value, Err: xerrors.ErrRouteTableValueNotSameFunc(key, expects[i])}
+					continue
+				}
+
+				results[i].Prev = row.value
+				prevs[i] = cur.Epoch
+			case mode == routetable.AssignIfAddr:
+				results[i].Err = xerrors.ErrRouteTableNotFoundFunc(key)
+				continue
+			}
+
+			assigning = append(assigning, i)
+		}
+
+		if len(assigning) == 0 {
+			return nil
+		}
+
+		slices.SortFunc(assigning, func(a, b int) int {
+			return strings.Compare(keys[a], keys[b])
+		})
+
+		epochs, err := r.nextEpochs(ctx, tx, len(assigning))
+		if err != nil {
+			return err
+		}
+
+		var floor uint64
+
+		b := &pgx.Batch{}
+
+		for j, i := range assigning {
+			epoch := epochs[j]
+			if prev := prevs[i]; prev >= epoch {
+				epoch = prev + 1
+				floor = max(floor, epoch)
+			}
+
+			val, _ := routetable.ReplaceEpoch(vals[i], epoch)
+			results[i].Assigned, results[i].Value = true, val
+
+			if _, ok := rows[keys[i]]; ok {
+				b.Queue(r.q.update, keys[i], []byte(val), ttl)
+			} else {
+				b.Queue(r.q.insertNx, keys[i], []byte(val), ttl)
+			}
+		}
+
+		br := tx.SendBatch(ctx, b)
+
+		for _, i := range assigning {
+			tag, err := br.Exec()
+			if err != nil {
+				_ = br.Close()
+				return errors.Wrapf(err, "key=%s", keys[i])
+			}
+
+			if tag.RowsAffected() == 0 {
+				raced = append(raced, i)
+			}
+		}
+
+		if err := br.Close(); err != nil {
+			return err
+		}
+
+		if floor > 0 {
+			// keep the sequence above the epochs written before it, see nextEpochs
+			if _, err := tx.Exec(ctx, r.q.floorEpoch, r.q.epochs, int64(floor)); err != nil {
+				return errors.Wrapf(err, "floor epochs failed. epoch=%d", floor)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return results, raced, nil
+}
+
+type lockedRow struct {
+	value string
+	alive bool
+}
+
+// lockRows locks the rows of keys that exist, expired or not, and returns them by key.
+func (r *RouteTable) lockRows(ctx context.Context, tx pgx.Tx, keys []string) (map[string]lockedRow, error) {
+	rows, err := tx.Query(ctx, r.q.lockBatch, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make(map[string]lockedRow, len(keys))
+
+	for rows.Next() {
+		var (
+			key   string
+			val   []byte
+			alive bool
+		)
+
+		if err := rows.Scan(&key, &val, &alive); err != nil {
+			return nil, err
+		}
+
+		ret[key] = lockedRow{value: string(val), alive: alive}
+	}
+
+	return ret, rows.Err()
+}
+
+// nextEpochs allocates n epochs from the sequence of the table. The sequence starts at the time
+// it has been created in microseconds, so that it is above the epochs that previous versions
+// derived from the clock of the nodes, and is raised above any greater epoch it replaces.
+func (r *RouteTable) nextEpochs(ctx context.Context, tx pgx.Tx, n int) ([]uint64, error) {
+	rows, err := tx.Query(ctx, r.q.nextEpochs, r.q.epochs, n)
+	if err != nil {
+		return nil, errors.Wrapf(err, "allocate epochs failed. sequence=%s", r.q.epochs)
+	}
+	defer rows.Close()
+
+	epochs := make([]uint64, 0, n)
+
+	for rows.Next() {
+		var epoch int64
+
+		if err := rows.Scan(&epoch); err != nil {
+			return nil, err
+		}
+
+		epochs = append(epochs, uint64(epoch))
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(epochs) != n {
+		return nil, errors.Errorf("allocated %d epochs instead of %d", len(epochs), n)
+	}
+
+	return epochs, nil
+}
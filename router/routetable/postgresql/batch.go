@@ -0,0 +1,219 @@
+package postgresql
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"github.com/jackc/pgx/v5"
+)
+
+// The batch operations queue the statement of every key in one pgx.Batch, which is sent in a single round trip.
+// Each statement is atomic, but the batch as a whole is not.
+
+// BatchSet runs Set on every key with the value of the same index in one batch.
+func (r *RouteTable) BatchSet(ctx context.Context, keys, vals []string, expire time.Duration) ([]error, error) {
+	ttls := make([]time.Duration, len(keys))
+	for i := range ttls {
+		ttls[i] = expire
+	}
+
+	return r.BatchSetWithTTL(ctx, keys, vals, ttls)
+}
+
+// BatchSetWithTTL runs Set on every key with the value and the expiration time of the same index in one batch.
+func (r *RouteTable) BatchSetWithTTL(ctx context.Context, keys, vals []string, expires []time.Duration) ([]error, error) {
+	if len(keys) != len(vals) || len(keys) != len(expires) {
+		return nil, errors.Errorf("batch set got %d keys, %d values and %d expiration times", len(keys), len(vals), len(expires))
+	}
+
+	errs, err := r.sendBatch(ctx, keys, func(b *pgx.Batch, i int) {
+		b.Queue(r.q.set, keys[i], []byte(vals[i]), ttlArg(expires[i]))
+	}, func(br pgx.BatchResults, i int) error {
+		_, err := br.Exec()
+		return errors.Wrapf(err, "key=%s val=%s expire=%s", keys[i], vals[i], expires[i])
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "batch set route table failed. keys=%d", len(keys))
+	}
+
+	return errs, nil
+}
+
+// BatchSetNxOrGet runs SetNxOrGet on every key with the value of the same index in one batch.
+// The current values of the keys that already exist are read with one more query.
+func (r *RouteTable) BatchSetNxOrGet(ctx context.Context, keys, vals []string, expire time.Duration) ([]routetable.SetNxOrGetResult, error) {
+	if len(keys) != len(vals) {
+		return nil, errors.Errorf("batch setnx got %d keys and %d values", len(keys), len(vals))
+	}
+
+	ttl := ttlArg(expire)
+	set := make([]bool, len(keys))
+
+	errs, err := r.sendBatch(ctx, keys, func(b *pgx.Batch, i int) {
+		b.Queue(r.q.setNx, keys[i], []byte(vals[i]), ttl)
+	}, func(br pgx.BatchResults, i int) error {
+		var cur []byte
+
+		err := br.QueryRow().Scan(&cur)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+
+		set[i] = err == nil
+
+		return errors.Wrapf(err, "key=%s", keys[i])
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "batch setnx route table failed. keys=%d", len(keys))
+	}
+
+	var existing []int
+
+	for i := range keys {
+		if errs[i] == nil && !set[i] {
+			existing = append(existing, i)
+		}
+	}
+
+	curs := make([]string, 0, len(existing))
+
+	if len(existing) > 0 {
+		existingKeys := make([]string, len(existing))
+		for j, i := range existing {
+			existingKeys[j] = keys[i]
+		}
+
+		if curs, err = r.BatchGet(ctx, existingKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]routetable.SetNxOrGetResult, len(keys))
+
+	for i := range keys {
+		switch {
+		case errs[i] != nil:
+			results[i] = routetable.SetNxOrGetResult{Err: errs[i]}
+		case set[i]:
+			results[i] = routetable.SetNxOrGetResult{Set: true, Addr: vals[i]}
+		}
+	}
+
+	for j, i := range existing {
+		if curs[j] != "" {
+			results[i] = routetable.SetNxOrGetResult{Addr: curs[j]}
+			continue
+		}
+
+		// the key has expired or been deleted since
+		ok, cur, err := r.SetNxOrGet(ctx, keys[i], vals[i], expire)
+		results[i] = routetable.SetNxOrGetResult{Set: ok, Addr: cur, Err: err}
+	}
+
+	return results, nil
+}
+
+// BatchCompareAndSwap runs CompareAndSwap on every key with the values of the same index in one batch.
+func (r *RouteTable) BatchCompareAndSwap(ctx context.Context, keys, olds, vals []string, expire time.Duration) ([]error, error) {
+	if len(keys) != len(olds) || len(keys) != len(vals) {
+		return nil, errors.Errorf("batch cas got %d keys, %d old values and %d values", len(keys), len(olds), len(vals))
+	}
+
+	ttl := ttlArg(expire)
+
+	errs, err := r.batchConditional(ctx, keys, olds, func(b *pgx.Batch, i int) {
+		b.Queue(r.q.cas, keys[i], []byte(olds[i]), []byte(vals[i]), ttl)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "batch cas route table failed. keys=%d", len(keys))
+	}
+
+	return errs, nil
+}
+
+// BatchExpireIfSame runs ExpireIfSame on every key with the value of the same index in one batch.
+func (r *RouteTable) BatchExpireIfSame(ctx context.Context, keys, values []string, expire time.Duration) ([]error, error) {
+	if len(keys) != len(values) {
+		return nil, errors.Errorf("batch expire got %d keys and %d values", len(keys), len(values))
+	}
+
+	if expire <= 0 {
+		return r.BatchDelIfSame(ctx, keys, values)
+	}
+
+	ttl := ttlArg(expire)
+
+	errs, err := r.batchConditional(ctx, keys, values, func(b *pgx.Batch, i int) {
+		b.Queue(r.q.expireSame, keys[i], []byte(values[i]), ttl)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "batch expire route table failed. keys=%d", len(keys))
+	}
+
+	return errs, nil
+}
+
+// BatchDelIfSame runs DelIfSame on every key with the value of the same index in one batch.
+func (r *RouteTable) BatchDelIfSame(ctx context.Context, keys, values []string) ([]error, error) {
+	if len(keys) != len(values) {
+		return nil, errors.Errorf("batch del got %d keys and %d values", len(keys), len(values))
+	}
+
+	errs, err := r.batchConditional(ctx, keys, values, func(b *pgx.Batch, i int) {
+		b.Queue(r.q.delSame, keys[i], []byte(values[i]))
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "batch del route table failed. keys=%d", len(keys))
+	}
+
+	return errs, nil
+}
+
+// batchConditional runs the conditional statements queued by queue and returns the result of every key.
+func (r *RouteTable) batchConditional(ctx context.Context, keys, expects []string, queue func(b *pgx.Batch, i int)) ([]error, error) {
+	return r.sendBatch(ctx, keys, queue, func(br pgx.BatchResults, i int) error {
+		var done, exists bool
+
+		if err := br.QueryRow().Scan(&done, &exists); err != nil {
+			return errors.Wrapf(err, "key=%s", keys[i])
+		}
+
+		return conditionalResult(keys[i], expects[i], done, exists)
+	})
+}
+
+// sendBatch queues one statement per key, sends them at once and reads the result of every key in order.
+// The returned error is only set if the batch could not be sent.
+func (r *RouteTable) sendBatch(ctx context.Context, keys []string, queue func(b *pgx.Batch, i int), read func(br pgx.BatchResults, i int) error) ([]error, error) {
+	errs := make([]error, len(keys))
+
+	if len(keys) == 0 {
+		return errs, nil
+	}
+
+	b := &pgx.Batch{}
+	for i := range keys {
+		queue(b, i)
+	}
+
+	br := r.db.SendBatch(ctx, b)
+
+	for i := range keys {
+		errs[i] = read(br, i)
+	}
+
+	if err := br.Close(); err != nil {
+		// a failed statement aborts the rest of the batch, whose results already hold the error
+		for _, e := range errs {
+			if e != nil {
+				return errs, nil
+			}
+		}
+
+		return nil, err
+	}
+
+	return errs, nil
+}
@@ -0,0 +1,445 @@
+// Package postgresql provides a PostgreSQL-based implementation of the route table.
+// It is intended for deployments that run PostgreSQL but no Redis.
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/trace/tracepg"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"github.com/go-pantheon/fabrica-util/xsync"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	defaultTable          = "route_table"
+	defaultReapInterval   = time.Minute
+	defaultReapBatchSize  = 1000
+	maxSetNxOrGetAttempts = 8
+)
+
+var _ routetable.Data = (*RouteTable)(nil)
+
+// DB is the part of a pgx connection pool used by the route table.
+// It is satisfied by *pgxpool.Pool, such as the pool of a tracepg.NewDB database.
+type DB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Option is a function type that configures a RouteTable instance.
+type Option func(*RouteTable)
+
+// WithTable returns an Option that sets the table of the route table, optionally qualified by its schema.
+// table must not be empty, otherwise the default table route_table will be used.
+func WithTable(table string) Option {
+	return func(r *RouteTable) {
+		if table == "" {
+			table = defaultTable
+		}
+
+		r.table = table
+	}
+}
+
+// WithReapInterval returns an Option that sets how often expired rows are deleted.
+// dur must be greater than 0, otherwise the default interval will be used.
+func WithReapInterval(dur time.Duration) Option {
+	return func(r *RouteTable) {
+		if dur <= 0 {
+			dur = defaultReapInterval
+		}
+
+		r.reapInterval = dur
+	}
+}
+
+// RouteTable implements the routetable.Data interface on a single PostgreSQL table of keys,
+// values and expiration timestamps. Expiration is evaluated with the clock of the database.
+// Expired rows are invisible to readers immediately and are deleted by a background reaper.
+type RouteTable struct {
+	db           DB
+	table        string
+	q            queries
+	reapInterval time.Duration
+	cursors      *scanCursors
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// New creates a new PostgreSQL-based route table data store and starts its reaper.
+// The table is expected to exist, see CreateTable. Close must be called to stop the reaper.
+func New(db DB, opts ...Option) *RouteTable {
+	r := &RouteTable{
+		db:           db,
+		table:        defaultTable,
+		reapInterval: defaultReapInterval,
+		cursors:      newScanCursors(),
+		closed:       make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	r.q = newQueries(r.table)
+
+	xsync.Go("routetable.postgresql.reap", func() error {
+		r.reapLoop()
+		return nil
+	})
+
+	return r
+}
+
+// NewTraced connects to the database of config with the tracing of tracepg and creates a route table on it.
+// The returned cleanup closes the route table and the connection pool.
+func NewTraced(ctx context.Context, config *tracepg.PostgreSQLConfig, opts ...Option) (*RouteTable, func(), error) {
+	db, cleanup, err := tracepg.NewDB(ctx, config)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "connect route table database failed")
+	}
+
+	r := New(db.GetPool(), opts...)
+
+	return r, func() {
+		_ = r.Close()
+
+		cleanup()
+	}, nil
+}
+
+// CreateTable creates the table, its expiration index and the sequence of its epochs if they do not exist.
+// Tables created by previous versions need it to be called again to create the sequence.
+func (r *RouteTable) CreateTable(ctx context.Context) error {
+	if _, err := r.db.Exec(ctx, r.q.createTable); err != nil {
+		return errors.Wrapf(err, "create route table failed. table=%s", r.table)
+	}
+
+	if _, err := r.db.Exec(ctx, r.q.createIndex); err != nil {
+		return errors.Wrapf(err, "create route table index failed. table=%s", r.table)
+	}
+
+	if _, err := r.db.Exec(ctx, fmt.Sprintf(r.q.createEpochs, time.Now().UnixMicro())); err != nil {
+		return errors.Wrapf(err, "create route table epoch sequence failed. table=%s", r.table)
+	}
+
+	return nil
+}
+
+// Close stops the background reaper. It does not close the database. It is safe to call Close more than once.
+func (r *RouteTable) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+
+	return nil
+}
+
+func (r *RouteTable) reapLoop() {
+	ticker := time.NewTicker(r.reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.closed:
+			return
+		case <-ticker.C:
+			if _, err := r.Reap(context.Background()); err != nil {
+				log.Warnf("reap route table failed. table=%s err=%+v", r.table, err)
+			}
+		}
+	}
+}
+
+// Reap deletes every expired row in batches and returns the number of rows deleted.
+func (r *RouteTable) Reap(ctx context.Context) (int64, error) {
+	var count int64
+
+	for {
+		tag, err := r.db.Exec(ctx, r.q.reap, defaultReapBatchSize)
+		if err != nil {
+			return count, errors.Wrapf(err, "table=%s", r.table)
+		}
+
+		count += tag.RowsAffected()
+
+		if tag.RowsAffected() < defaultReapBatchSize {
+			return count, nil
+		}
+	}
+}
+
+// Get retrieves a value by key.
+func (r *RouteTable) Get(ctx context.Context, key string) (string, error) {
+	var val []byte
+
+	if err := r.db.QueryRow(ctx, r.q.get, key).Scan(&val); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", xerrors.ErrRouteTableNotFoundFunc(key)
+		}
+
+		return "", errors.Wrapf(err, "key=%s", key)
+	}
+
+	return string(val), nil
+}
+
+// GetEx loads a value and resets its expiration time.
+// A zero expiration persists the row and a negative one leaves it unchanged.
+func (r *RouteTable) GetEx(ctx context.Context, key string, exp time.Duration) (string, error) {
+	arg := ttlArg(exp)
+	if exp < 0 {
+		arg = -1
+	}
+
+	var val []byte
+
+	if err := r.db.QueryRow(ctx, r.q.getEx, key, arg).Scan(&val); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", xerrors.ErrRouteTableNotFoundFunc(key)
+		}
+
+		return "", errors.Wrapf(err, "key=%s", key)
+	}
+
+	return string(val), nil
+}
+
+// BatchGet retrieves the values of keys in order with one query. Missing keys produce an empty string.
+func (r *RouteTable) BatchGet(ctx context.Context, keys []string) ([]string, error) {
+	vals, _, err := r.batchGet(ctx, r.q.batchGet, keys)
+	if err != nil {
+		return nil, errors.Wrapf(err, "batch get route table failed. keys=%d", len(keys))
+	}
+
+	return vals, nil
+}
+
+// BatchGetWithTTL retrieves the values and remaining time to live of keys in order with one query.
+// Missing keys produce an empty string, and keys that do not expire a zero TTL.
+func (r *RouteTable) BatchGetWithTTL(ctx context.Context, keys []string) ([]string, []time.Duration, error) {
+	vals, ttls, err := r.batchGet(ctx, r.q.batchTTL, keys)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "batch get route table with ttl failed. keys=%d", len(keys))
+	}
+
+	return vals, ttls, nil
+}
+
+// batchGet runs query, which selects the key, the value and optionally the ttl in microseconds
+// of the live rows of keys, and returns the values and ttls in the order of keys.
+func (r *RouteTable) batchGet(ctx context.Context, query string, keys []string) ([]string, []time.Duration, error) {
+	vals := make([]string, len(keys))
+	ttls := make([]time.Duration, len(keys))
+
+	if len(keys) == 0 {
+		return vals, ttls, nil
+	}
+
+	index := make(map[string][]int, len(keys))
+	for i, key := range keys {
+		index[key] = append(index[key], i)
+	}
+
+	rows, err := r.db.Query(ctx, query, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	withTTL := len(rows.FieldDescriptions()) == 3
+
+	for rows.Next() {
+		var (
+			key string
+			val []byte
+			ttl *int64
+		)
+
+		dest := []any{&key, &val}
+		if withTTL {
+			dest = append(dest, &ttl)
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+
+		for _, i := range index[key] {
+			vals[i] = string(val)
+
+			if ttl != nil && *ttl > 0 {
+				ttls[i] = time.Duration(*ttl) * time.Microsecond
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return vals, ttls, nil
+}
+
+// GetSet atomically sets a new value and returns the old value.
+// The old value is empty if the key did not exist.
+func (r *RouteTable) GetSet(ctx context.Context, key, val string, expire time.Duration) (string, error) {
+	var old string
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		for range maxSetNxOrGetAttempts {
+			var (
+				cur   []byte
+				alive bool
+			)
+
+			err := tx.QueryRow(ctx, r.q.lockGet, key).Scan(&cur, &alive)
+			if err == nil {
+				if alive {
+					old = string(cur)
+				}
+
+				_, err = tx.Exec(ctx, r.q.update, key, []byte(val), ttlArg(expire))
+
+				return err
+			}
+
+			if !errors.Is(err, pgx.ErrNoRows) {
+				return err
+			}
+
+			tag, err := tx.Exec(ctx, r.q.insertNx, key, []byte(val), ttlArg(expire))
+			if err != nil {
+				return err
+			}
+
+			if tag.RowsAffected() == 1 {
+				return nil
+			}
+
+			// the key has been inserted concurrently, so lock it and try again
+		}
+
+		return errors.Errorf("getset kept racing with concurrent inserts")
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "key=%s", key)
+	}
+
+	return old, nil
+}
+
+// Set stores a key-value pair with an expiration time.
+func (r *RouteTable) Set(ctx context.Context, key, val string, expire time.Duration) error {
+	if _, err := r.db.Exec(ctx, r.q.set, key, []byte(val), ttlArg(expire)); err != nil {
+		return errors.Wrapf(err, "key=%s val=%s expire=%s", key, val, expire)
+	}
+
+	return nil
+}
+
+// SetNxOrGet sets a key-value pair only if the key does not exist.
+// It returns the current value if the key already exists.
+func (r *RouteTable) SetNxOrGet(ctx context.Context, key, val string, expire time.Duration) (bool, string, error) {
+	for range maxSetNxOrGetAttempts {
+		var cur []byte
+
+		err := r.db.QueryRow(ctx, r.q.setNx, key, []byte(val), ttlArg(expire)).Scan(&cur)
+		if err == nil {
+			return true, val, nil
+		}
+
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return false, "", errors.Wrapf(err, "key=%s", key)
+		}
+
+		// the key exists, unless it has expired or been deleted since
+		got, err := r.Get(ctx, key)
+		if err == nil {
+			return false, got, nil
+		}
+
+		if !errors.Is(err, xerrors.ErrRouteTableNotFound) {
+			return false, "", err
+		}
+	}
+
+	return false, "", errors.Errorf("setnx kept racing with concurrent deletes. key=%s", key)
+}
+
+// CompareAndSwap sets key to val only if its current value is old.
+func (r *RouteTable) CompareAndSwap(ctx context.Context, key, old, val string, expire time.Duration) error {
+	return r.conditional(ctx, r.q.cas, key, old, []byte(val), ttlArg(expire))
+}
+
+// Expire sets an expiration time for a key. A non-positive expiration deletes the key.
+// Like Redis EXPIRE, it is not an error if the key does not exist.
+func (r *RouteTable) Expire(ctx context.Context, key string, expire time.Duration) error {
+	if expire <= 0 {
+		return r.Del(ctx, key)
+	}
+
+	if _, err := r.db.Exec(ctx, r.q.expire, key, ttlArg(expire)); err != nil {
+		return errors.Wrapf(err, "key=%s expire=%s", key, expire)
+	}
+
+	return nil
+}
+
+// ExpireIfSame sets an expiration time for a key only if its current value matches the expected value.
+// Like Expire, a non-positive expiration deletes the key.
+func (r *RouteTable) ExpireIfSame(ctx context.Context, key, expect string, expire time.Duration) error {
+	if expire <= 0 {
+		return r.DelIfSame(ctx, key, expect)
+	}
+
+	return r.conditional(ctx, r.q.expireSame, key, expect, ttlArg(expire))
+}
+
+// Del deletes a key. It is not an error if the key does not exist.
+func (r *RouteTable) Del(ctx context.Context, key string) error {
+	if _, err := r.db.Exec(ctx, r.q.del, key); err != nil {
+		return errors.Wrapf(err, "key=%s", key)
+	}
+
+	return nil
+}
+
+// DelIfSame deletes a key only if its current value matches the specified value.
+func (r *RouteTable) DelIfSame(ctx context.Context, key, expect string) error {
+	return r.conditional(ctx, r.q.delSame, key, expect)
+}
+
+// conditional runs a conditional statement on key if its value is expect.
+func (r *RouteTable) conditional(ctx context.Context, query, key, expect string, args ...any) error {
+	var done, exists bool
+
+	if err := r.db.QueryRow(ctx, query, append([]any{key, []byte(expect)}, args...)...).Scan(&done, &exists); err != nil {
+		return errors.Wrapf(err, "key=%s", key)
+	}
+
+	return conditionalResult(key, expect, done, exists)
+}
+
+func conditionalResult(key, expect string, done, exists bool) error {
+	switch {
+	case done:
+		return nil
+	case exists:
+		return xerrors.ErrRouteTableValueNotSameFunc(key, expect)
+	default:
+		return xerrors.ErrRouteTableNotFoundFunc(key)
+	}
+}
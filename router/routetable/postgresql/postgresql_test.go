@@ -0,0 +1,330 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable/internal/datatest"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDSNEnv is the environment variable of the database the tests run on. They are skipped if it is not set.
+const testDSNEnv = "ROUTETABLE_POSTGRES_DSN"
+
+var testTables atomic.Int64
+
+// newTestRouteTable creates a route table on a new table, which is dropped by the cleanup of t.
+func newTestRouteTable(t *testing.T) *RouteTable {
+	t.Helper()
+
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+
+	ctx := context.Background()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	table := fmt.Sprintf("route_table_test_%d_%d", os.Getpid(), testTables.Add(1))
+
+	r := New(pool, WithTable(table), WithReapInterval(time.Hour))
+	t.Cleanup(func() {
+		_ = r.Close()
+		_, _ = pool.Exec(ctx, "DROP TABLE IF EXISTS "+pgx.Identifier{table}.Sanitize())
+		_, _ = pool.Exec(ctx, "DROP SEQUENCE IF EXISTS "+r.q.epochs)
+	})
+
+	require.NoError(t, r.CreateTable(ctx))
+
+	return r
+}
+
+// expiredTTL is the ttl of the rows that expire before the test goes on, see expire.
+const expiredTTL = time.Millisecond
+
+func expire() {
+	time.Sleep(expiredTTL * 10)
+}
+
+func TestTTL(t *testing.T) {
+	t.Parallel()
+
+	datatest.TestTTL(t, newTestRouteTable(t))
+}
+
+func TestGetSet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	r := newTestRouteTable(t)
+
+	old, err := r.GetSet(ctx, "k", "a", time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, old)
+
+	old, err = r.GetSet(ctx, "k", "b", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "a", old)
+
+	// an expired row is replaced as if it did not exist
+	require.NoError(t, r.Set(ctx, "expired", "a", expiredTTL))
+	expire()
+
+	old, err = r.GetSet(ctx, "expired", "b", time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, old)
+
+	_, ttls, err := r.BatchGetWithTTL(ctx, []string{"expired"})
+	require.NoError(t, err)
+	assert.Greater(t, ttls[0], time.Second)
+}
+
+func TestGetSetConcurrent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	r := newTestRouteTable(t)
+
+	const n = 16
+
+	var (
+		wg   sync.WaitGroup
+		olds = make([]string, n)
+		errs = make([]error, n)
+	)
+
+	for i := range n {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			olds[i], errs[i] = r.GetSet(ctx, "k", fmt.Sprint(i), time.Minute)
+		}()
+	}
+
+	wg.Wait()
+
+	// the concurrent inserts of a new key are serialized, so every value is replaced once but the last one
+	seen := make(map[string]int)
+
+	for i := range n {
+		require.NoError(t, errs[i])
+		seen[olds[i]]++
+	}
+
+	last, err := r.Get(ctx, "k")
+	require.NoError(t, err)
+	seen[last]++
+
+	assert.Len(t, seen, n+1)
+	assert.Equal(t, 1, seen[""])
+}
+
+func TestSetNxOrGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	r := newTestRouteTable(t)
+
+	set, cur, err := r.SetNxOrGet(ctx, "k", "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, set)
+	assert.Equal(t, "a", cur)
+
+	set, cur, err = r.SetNxOrGet(ctx, "k", "b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, set)
+	assert.Equal(t, "a", cur)
+
+	// an expired row is replaced as if it did not exist
+	require.NoError(t, r.Set(ctx, "expired", "a", expiredTTL))
+	expire()
+
+	set, cur, err = r.SetNxOrGet(ctx, "expired", "b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, set)
+	assert.Equal(t, "b", cur)
+
+	val, err := r.Get(ctx, "expired")
+	require.NoError(t, err)
+	assert.Equal(t, "b", val)
+}
+
+func TestSetNxOrGetConcurrent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	r := newTestRouteTable(t)
+
+	const n = 16
+
+	var (
+		wg   sync.WaitGroup
+		sets atomic.Int64
+		curs = make([]string, n)
+		errs = make([]error, n)
+	)
+
+	for i := range n {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			var set bool
+
+			set, curs[i], errs[i] = r.SetNxOrGet(ctx, "k", fmt.Sprint(i), time.Minute)
+			if set {
+				sets.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int64(1), sets.Load())
+
+	for i := range n {
+		require.NoError(t, errs[i])
+		assert.Equal(t, curs[0], curs[i])
+	}
+}
+
+func TestConditional(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	r := newTestRouteTable(t)
+
+	require.NoError(t, r.Set(ctx, "k", "a", time.Minute))
+	require.NoError(t, r.Set(ctx, "expired", "a", expiredTTL))
+	expire()
+
+	tests := []struct {
+		name string
+		fn   func(key, expect string) error
+	}{
+		{name: "cas", fn: func(key, expect string) error { return r.CompareAndSwap(ctx, key, expect, "a", time.Minute) }},
+		{name: "expire", fn: func(key, expect string) error { return r.ExpireIfSame(ctx, key, expect, time.Minute) }},
+	}
+
+	for _, tt := range tests {
+		require.NoError(t, tt.fn("k", "a"), tt.name)
+		require.ErrorIs(t, tt.fn("k", "b"), xerrors.ErrRouteTableValueNotSame, tt.name)
+		require.ErrorIs(t, tt.fn("missing", "a"), xerrors.ErrRouteTableNotFound, tt.name)
+		require.ErrorIs(t, tt.fn("expired", "a"), xerrors.ErrRouteTableNotFound, tt.name)
+	}
+
+	require.NoError(t, r.CompareAndSwap(ctx, "k", "a", "b", time.Minute))
+
+	val, err := r.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, "b", val)
+
+	require.ErrorIs(t, r.DelIfSame(ctx, "k", "a"), xerrors.ErrRouteTableValueNotSame)
+	require.ErrorIs(t, r.DelIfSame(ctx, "expired", "a"), xerrors.ErrRouteTableNotFound)
+	require.NoError(t, r.DelIfSame(ctx, "k", "b"))
+	require.ErrorIs(t, r.DelIfSame(ctx, "k", "b"), xerrors.ErrRouteTableNotFound)
+}
+
+func TestReap(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	r := newTestRouteTable(t)
+
+	for i := range 3 {
+		require.NoError(t, r.Set(ctx, fmt.Sprint("expired", i), "a", expiredTTL))
+	}
+
+	require.NoError(t, r.Set(ctx, "live", "a", time.Minute))
+	require.NoError(t, r.Set(ctx, "persistent", "a", 0))
+	expire()
+
+	n, err := r.Reap(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	var rows int64
+	require.NoError(t, r.db.QueryRow(ctx, "SELECT count(*) FROM "+pgx.Identifier{r.table}.Sanitize()).Scan(&rows))
+	assert.Equal(t, int64(2), rows)
+}
+
+func TestScan(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	r := newTestRouteTable(t)
+
+	for i := range 25 {
+		require.NoError(t, r.Set(ctx, fmt.Sprintf("k%02d", i), "a", time.Minute))
+	}
+
+	require.NoError(t, r.Set(ctx, "other", "a", time.Minute))
+
+	var (
+		keys   []string
+		cursor uint64
+	)
+
+	for {
+		page, next, err := r.Scan(ctx, "k*", cursor, 10)
+		require.NoError(t, err)
+
+		keys = append(keys, page...)
+
+		if cursor == 0 {
+			// the keys before the cursor do not shift the next pages
+			require.NoError(t, r.Del(ctx, "k00"))
+			require.NoError(t, r.Del(ctx, "k01"))
+		}
+
+		if next == 0 {
+			break
+		}
+
+		cursor = next
+	}
+
+	require.Len(t, keys, 25)
+	assert.Equal(t, "k00", keys[0])
+	assert.Equal(t, "k24", keys[24])
+
+	_, _, err := r.Scan(ctx, "k*", 1, 10)
+	require.Error(t, err)
+}
+
+func TestScanCursors(t *testing.T) {
+	t.Parallel()
+
+	c := newScanCursors()
+
+	first := c.add("a")
+	assert.NotZero(t, first)
+
+	key, ok := c.get(first)
+	require.True(t, ok)
+	assert.Equal(t, "a", key)
+
+	for range maxScanCursors {
+		c.add("b")
+	}
+
+	// only the last cursors are kept
+	_, ok = c.get(first)
+	assert.False(t, ok)
+	assert.Len(t, c.keys, maxScanCursors)
+}
@@ -0,0 +1,153 @@
+package postgresql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// live is the condition of the rows that have not expired. Expired rows are invisible
+// to every statement and are deleted by the reaper.
+const live = `(expire_at IS NULL OR expire_at > now())`
+
+// expireAt is the expiration of a ttl argument in microseconds; a non-positive ttl means no expiration.
+func expireAt(arg int) string {
+	return fmt.Sprintf(`CASE WHEN $%[1]d::bigint > 0 THEN now() + $%[1]d::bigint * interval '1 microsecond' END`, arg)
+}
+
+// conditional builds a statement that runs stmt, an UPDATE or DELETE of the row of $1 if its value is $2
+// that returns a row when it runs, and selects whether it ran and whether the row exists.
+func conditional(table, stmt string) string {
+	return fmt.Sprintf(`WITH cur AS (SELECT 1 FROM %[1]s WHERE key = $1 AND %[2]s),
+done AS (%[3]s)
+SELECT EXISTS (SELECT 1 FROM done), EXISTS (SELECT 1 FROM cur)`, table, live, stmt)
+}
+
+// queries holds the statements of a table. Every value is a BYTEA argument,
+// since the encoded routing entries are binary.
+type queries struct {
+	createTable string
+	createIndex string
+	// createEpochs is formatted with the first epoch, see CreateTable.
+	createEpochs string
+	// epochs is the name of the sequence of the epochs, see nextEpochs.
+	epochs string
+
+	get        string
+	getEx      string
+	batchGet   string
+	batchTTL   string
+	scan       string
+	set        string
+	setNx      string
+	lockGet    string
+	lockBatch  string
+	nextEpochs string
+	floorEpoch string
+	update     string
+	insertNx   string
+	cas        string
+	expire     string
+	expireSame string
+	del        string
+	delSame    string
+	reap       string
+}
+
+func newQueries(table string) queries {
+	name := strings.Split(table, ".")
+	t := pgx.Identifier(name).Sanitize()
+	idx := pgx.Identifier{name[len(name)-1] + "_expire_at_idx"}.Sanitize()
+	seq := pgx.Identifier(append(name[:len(name)-1:len(name)-1], name[len(name)-1]+"_epoch_seq")).Sanitize()
+
+	return queries{
+		createTable: fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	key TEXT COLLATE "C" PRIMARY KEY,
+	value BYTEA NOT NULL,
+	expire_at TIMESTAMPTZ
+)`, t),
+		createIndex:  fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (expire_at) WHERE expire_at IS NOT NULL`, idx, t),
+		createEpochs: fmt.Sprintf(`CREATE SEQUENCE IF NOT EXISTS %s START WITH %%d`, seq),
+		epochs:       seq,
+
+		get: fmt.Sprintf(`SELECT value FROM %s WHERE key = $1 AND %s`, t, live),
+		getEx: fmt.Sprintf(`UPDATE %s SET expire_at = CASE WHEN $2::bigint > 0 THEN now() + $2::bigint * interval '1 microsecond'
+	WHEN $2::bigint = 0 THEN NULL ELSE expire_at END
+WHERE key = $1 AND %s RETURNING value`, t, live),
+		batchGet: fmt.Sprintf(`SELECT key, value FROM %s WHERE key = ANY($1) AND %s`, t, live),
+		batchTTL: fmt.Sprintf(`SELECT key, value, (EXTRACT(EPOCH FROM expire_at - now()) * 1000000)::bigint
+FROM %s WHERE key = ANY($1) AND %s`, t, live),
+		// the scan resumes after the key $2 if it is not null
+		scan: fmt.Sprintf(`SELECT key FROM %s WHERE key LIKE $1 AND ($2::text IS NULL OR key > $2) AND %s ORDER BY key LIMIT $3`, t, live),
+
+		set: fmt.Sprintf(`INSERT INTO %s (key, value, expire_at) VALUES ($1, $2, %s)
+ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expire_at = EXCLUDED.expire_at`, t, expireAt(3)),
+		// an expired row is replaced as if it did not exist
+		setNx: fmt.Sprintf(`INSERT INTO %[1]s AS t (key, value, expire_at) VALUES ($1, $2, %[2]s)
+ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expire_at = EXCLUDED.expire_at
+WHERE t.expire_at IS NOT NULL AND t.expire_at <= now()
+RETURNING value`, t, expireAt(3)),
+		lockGet: fmt.Sprintf(`SELECT value, %s FROM %s WHERE key = $1 FOR UPDATE`, live, t),
+		// the rows are locked in the order of their keys, so that concurrent batches do not deadlock
+		lockBatch:  fmt.Sprintf(`SELECT key, value, %s FROM %s WHERE key = ANY($1) ORDER BY key FOR UPDATE`, live, t),
+		nextEpochs: `SELECT nextval($1::regclass) FROM generate_series(1, $2)`,
+		floorEpoch: fmt.Sprintf(`SELECT setval($1::regclass, $2) FROM %s WHERE last_value < $2`, seq),
+		update:     fmt.Sprintf(`UPDATE %s SET value = $2, expire_at = %s WHERE key = $1`, t, expireAt(3)),
+		insertNx:   fmt.Sprintf(`INSERT INTO %s (key, value, expire_at) VALUES ($1, $2, %s) ON CONFLICT (key) DO NOTHING`, t, expireAt(3)),
+
+		cas: conditional(t, fmt.Sprintf(`UPDATE %s SET value = $3, expire_at = %s WHERE key = $1 AND value = $2 AND %s RETURNING 1`,
+			t, expireAt(4), live)),
+		expire:     fmt.Sprintf(`UPDATE %s SET expire_at = %s WHERE key = $1 AND %s`, t, expireAt(2), live),
+		expireSame: conditional(t, fmt.Sprintf(`UPDATE %s SET expire_at = %s WHERE key = $1 AND value = $2 AND %s RETURNING 1`, t, expireAt(3), live)),
+		del:        fmt.Sprintf(`DELETE FROM %s WHERE key = $1`, t),
+		delSame:    conditional(t, fmt.Sprintf(`DELETE FROM %s WHERE key = $1 AND value = $2 AND %s RETURNING 1`, t, live)),
+
+		reap: fmt.Sprintf(`DELETE FROM %[1]s WHERE key IN (SELECT key FROM %[1]s WHERE expire_at <= now() LIMIT $1)`, t),
+	}
+}
+
+// ttlArg converts a duration to the microsecond argument of the statements.
+// Positive durations below one microsecond are rounded up so that they still expire.
+func ttlArg(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return max(ttl.Microseconds(), 1)
+}
+
+// likePrefix converts the literal prefix of the glob pattern match into a LIKE pattern,
+// so that the index narrows a scan down to the keys that can match.
+func likePrefix(match string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(match); i++ {
+		c := match[i]
+
+		switch c {
+		case '*', '?', '[':
+			b.WriteByte('%')
+			return b.String()
+		case '\\':
+			if i+1 == len(match) {
+				b.WriteByte('%')
+				return b.String()
+			}
+
+			i++
+			c = match[i]
+		}
+
+		if c == '%' || c == '_' || c == '\\' {
+			b.WriteByte('\\')
+		}
+
+		b.WriteByte(c)
+	}
+
+	b.WriteByte('%')
+
+	return b.String()
+}
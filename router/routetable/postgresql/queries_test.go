@@ -0,0 +1,57 @@
+package postgresql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLikePrefix(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		match string
+		want  string
+	}{
+		{match: "", want: "%"},
+		{match: "*", want: "%"},
+		{match: "rt1:player:blue:*", want: "rt1:player:blue:%"},
+		{match: "rt1:play?r:*", want: "rt1:play%"},
+		{match: "rt1:[ab]:*", want: "rt1:%"},
+		{match: `rt1:a\*b:*`, want: "rt1:a*b:%"},
+		{match: "rt1:100%_done", want: `rt1:100\%\_done%`},
+		{match: `a\\b`, want: `a\\b%`},
+		{match: `a\`, want: "a%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.match, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, likePrefix(tt.match))
+		})
+	}
+}
+
+func TestTTLArg(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, int64(0), ttlArg(0))
+	assert.Equal(t, int64(0), ttlArg(-time.Second))
+	assert.Equal(t, int64(1), ttlArg(time.Nanosecond))
+	assert.Equal(t, int64(1500000), ttlArg(time.Millisecond*1500))
+}
+
+func TestNewQueries(t *testing.T) {
+	t.Parallel()
+
+	q := newQueries("routing.route_table")
+	assert.Contains(t, q.createTable, `CREATE TABLE IF NOT EXISTS "routing"."route_table"`)
+	assert.Contains(t, q.createIndex, `"route_table_expire_at_idx" ON "routing"."route_table"`)
+	assert.Equal(t, `"routing"."route_table_epoch_seq"`, q.epochs)
+	assert.Contains(t, q.floorEpoch, `FROM "routing"."route_table_epoch_seq"`)
+
+	q = newQueries(`evil"; DROP TABLE x; --`)
+	assert.Contains(t, q.get, `FROM "evil""; DROP TABLE x; --" WHERE`)
+}
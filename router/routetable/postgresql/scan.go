@@ -0,0 +1,115 @@
+package postgresql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-util/errors"
+)
+
+// maxScanCursors is the number of the last cursors returned by Scan that a route table can resume.
+const maxScanCursors = 1024
+
+// Scan iterates the live keys matching the glob pattern match in ascending order. An empty match matches every key.
+// The rows are read by the literal prefix of match and filtered with routetable.MatchPattern, so a page may be
+// empty before the end. Every page resumes after the last key of the previous one, so keys present during
+// the whole iteration are returned exactly once. The cursor refers to that key, which is kept by the route table
+// for its last 1024 cursors, so it can only be resumed on the route table that returned it.
+func (r *RouteTable) Scan(ctx context.Context, match string, cursor uint64, count int64) ([]string, uint64, error) {
+	count = max(count, 1)
+
+	var after *string
+
+	if cursor != 0 {
+		key, ok := r.cursors.get(cursor)
+		if !ok {
+			return nil, 0, errors.Errorf("scan cursor not found. match=%s cursor=%d", match, cursor)
+		}
+
+		after = &key
+	}
+
+	rows, err := r.db.Query(ctx, r.q.scan, likePrefix(match), after, count)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "scan failed. match=%s cursor=%d", match, cursor)
+	}
+	defer rows.Close()
+
+	var (
+		keys []string
+		last string
+		read int64
+	)
+
+	for rows.Next() {
+		if err := rows.Scan(&last); err != nil {
+			return nil, 0, errors.Wrapf(err, "scan failed. match=%s cursor=%d", match, cursor)
+		}
+
+		read++
+
+		if match == "" || routetable.MatchPattern(match, last) {
+			keys = append(keys, last)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, errors.Wrapf(err, "scan failed. match=%s cursor=%d", match, cursor)
+	}
+
+	if read < count {
+		return keys, 0, nil
+	}
+
+	return keys, r.cursors.add(last), nil
+}
+
+// scanCursors maps the cursors returned by Scan to the last key of their page.
+// Only the last maxScanCursors cursors are kept.
+type scanCursors struct {
+	mu   sync.Mutex
+	next uint64
+	keys map[uint64]string
+	// order holds the kept cursors from the oldest.
+	order []uint64
+}
+
+func newScanCursors() *scanCursors {
+	// the cursors of a previous process are unlikely to be reused
+	return &scanCursors{
+		next: uint64(time.Now().UnixNano()),
+		keys: make(map[uint64]string),
+	}
+}
+
+// add returns a new cursor that resumes after key.
+func (c *scanCursors) add(key string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.next++
+	if c.next == 0 {
+		c.next++
+	}
+
+	c.keys[c.next] = key
+	c.order = append(c.order, c.next)
+
+	if len(c.order) > maxScanCursors {
+		delete(c.keys, c.order[0])
+		c.order = c.order[1:]
+	}
+
+	return c.next
+}
+
+func (c *scanCursors) get(cursor uint64) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.keys[cursor]
+
+	return key, ok
+}
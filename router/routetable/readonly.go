@@ -1,58 +1,63 @@
 package routetable
 
-import (
-	"context"
-
-	"github.com/go-pantheon/fabrica-util/errors"
-)
-
-type buildKeyFunc func(name, color string, oid int64) string
+import "context"
 
 var _ ReadOnlyRouteTable = (*readOnlyRouteTable)(nil)
 
 // readOnlyRouteTable is a basic implementation of the ReadOnlyRouteTable interface.
-// It provides routing functionality with key generation.
+// It provides routing functionality with pluggable key encoding.
 type readOnlyRouteTable struct {
-	data     Data
-	name     string
-	buildKey buildKeyFunc
+	data  Data
+	name  string
+	codec KeyCodec
 }
 
 // NewReadOnlyRouteTable creates a new readOnlyRouteTable with the given data store,
-// name, key generation function.
-func NewReadOnlyRouteTable(rtd Data, name string) *readOnlyRouteTable {
+// name, and optional configuration options.
+func NewReadOnlyRouteTable(rtd Data, name string, opts ...Option) *readOnlyRouteTable {
+	return newReadOnlyRouteTable(rtd, name, newOptions(opts...))
+}
+
+func newReadOnlyRouteTable(rtd Data, name string, o *options) *readOnlyRouteTable {
 	rt := &readOnlyRouteTable{
-		data:     rtd,
-		name:     name,
-		buildKey: Key,
+		data:  rtd,
+		name:  name,
+		codec: o.codec,
 	}
 
 	return rt
 }
 
+// BuildKey builds the data store key of a routing entry with the route table's KeyCodec.
 func (r *readOnlyRouteTable) BuildKey(color string, oid int64) string {
-	return r.buildKey(r.name, color, oid)
+	return r.codec.Encode(r.name, color, oid)
 }
 
 // Get retrieves a routing entry from the route table.
 func (r *readOnlyRouteTable) Get(ctx context.Context, color string, uid int64) (addr string, err error) {
-	addr, err = r.data.Get(ctx, r.buildKey(r.name, color, uid))
+	addr, _, err = r.GetWithEpoch(ctx, color, uid)
+	return addr, err
+}
+
+// GetWithEpoch retrieves a routing entry and the epoch of its current owner.
+func (r *readOnlyRouteTable) GetWithEpoch(ctx context.Context, color string, uid int64) (addr string, epoch uint64, err error) {
+	e, err := r.GetEntry(ctx, color, uid)
 	if err != nil {
-		return "", errors.WithMessage(err, "get route table failed")
+		return "", 0, err
 	}
 
-	return addr, nil
+	return e.Addr, e.Epoch, nil
 }
 
 func (r *readOnlyRouteTable) BatchGet(ctx context.Context, color string, keys []int64) (addrs []string, err error) {
-	keysStr := make([]string, 0, len(keys))
-	for _, key := range keys {
-		keysStr = append(keysStr, r.buildKey(r.name, color, key))
+	entries, err := r.BatchGetEntries(ctx, color, keys)
+	if err != nil {
+		return nil, err
 	}
 
-	addrs, err = r.data.BatchGet(ctx, keysStr)
-	if err != nil {
-		return nil, errors.WithMessage(err, "batch get route table failed")
+	addrs = make([]string, len(entries))
+	for i, e := range entries {
+		addrs[i] = e.Addr
 	}
 
 	return addrs, nil
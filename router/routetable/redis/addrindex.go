@@ -0,0 +1,224 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+var _ routetable.AddrIndex = (*AddrIndex)(nil)
+
+// WithAddrIndex returns an Option that makes the route table maintain an address index of the keys
+// encoded by codec, which must be the codec of the master route table. The index is returned by AddrIndex.
+//
+// On a Redis Cluster the index keys of a color must be in the hash slot of its routes, which requires
+// a codec whose keys of a color share their hash tag, like LegacyKeyCodec. The index is disabled
+// with an error log on a Redis Cluster with another codec, such as V1KeyCodec or LegacyClusterKeyCodec.
+func WithAddrIndex(codec routetable.KeyCodec) Option {
+	return func(r *RouteTable) {
+		if codec == nil {
+			codec = routetable.LegacyKeyCodec
+		}
+
+		x := &AddrIndex{
+			client: r.client,
+			codec:  codec,
+		}
+
+		if _, ok := r.client.(*redis.ClusterClient); ok && x.tag(indexCheckName, indexCheckColor) == "" {
+			log.Errorf("address index is disabled, the codec does not put the routes of a color in one hash slot. codec=%T", codec)
+			return
+		}
+
+		r.index = x
+	}
+}
+
+// indexCheckName and indexCheckColor are the name and color of the routes encoded to check a codec, see WithAddrIndex.
+const (
+	indexCheckName  = "name"
+	indexCheckColor = "color"
+)
+
+// countPage is the number of oids Count prunes at once.
+const countPage = 256
+
+// AddrIndex implements the routetable.AddrIndex interface with one Redis set per address.
+// The sets are updated by the scripts that write the routes, so a route and its index change atomically.
+// A set expires with the last route written to it, and is persisted with a route without expiration.
+// The oids of the routes that expired stay until ListByAddr or Count prunes them,
+// and an empty set is deleted by Redis.
+type AddrIndex struct {
+	client redis.UniversalClient
+	codec  routetable.KeyCodec
+}
+
+// AddrIndex returns the address index maintained by the route table,
+// or nil if it was not created with WithAddrIndex.
+func (r *RouteTable) AddrIndex() routetable.AddrIndex {
+	if r.index == nil {
+		return nil
+	}
+
+	return r.index
+}
+
+// key returns the index key of addr, see routetable.AddrIndexKey.
+func (x *AddrIndex) key(name, color, addr string) string {
+	return x.tag(name, color) + routetable.AddrIndexKey(name, color, addr)
+}
+
+// tag returns the hash tag that puts the index keys of name and color in the hash slot of their routes,
+// or an empty string if the routes of a color are spread across slots.
+func (x *AddrIndex) tag(name, color string) string {
+	tag := hashTag(x.codec.Encode(name, color, 0))
+	if tag != hashTag(x.codec.Encode(name, color, 1)) {
+		return ""
+	}
+
+	return "{" + tag + "}"
+}
+
+// args returns the index arguments of the scripts that write key: the prefix of its index keys,
+// which only lack the escaped address and the closing brace, and its oid.
+// Both are empty if key is not a route of the codec of the index.
+func (x *AddrIndex) args(key string) []any {
+	if x == nil {
+		return []any{"", ""}
+	}
+
+	name, color, oid, err := x.codec.Decode(key)
+	if err != nil {
+		return []any{"", ""}
+	}
+
+	prefix := strings.TrimSuffix(x.key(name, color, ""), "}")
+
+	return []any{prefix, strconv.FormatInt(oid, 10)}
+}
+
+// keys returns the index keys declared by the scripts that write key, see routeLua: the index keys
+// of from and to, the owners of the route before and after the write, or key for an empty owner.
+// It is empty if key is not a route of the codec of the index.
+func (x *AddrIndex) keys(key, from, to string) []string {
+	if x == nil {
+		return nil
+	}
+
+	name, color, _, err := x.codec.Decode(key)
+	if err != nil {
+		return nil
+	}
+
+	keys := make([]string, 0, 2)
+
+	for _, addr := range []string{from, to} {
+		if addr == "" {
+			keys = append(keys, key)
+		} else {
+			keys = append(keys, x.key(name, color, addr))
+		}
+	}
+
+	return keys
+}
+
+// owner returns the address under which val is indexed, or an empty string if it is empty or not a route entry,
+// like indexed in routeLua.
+func owner(val string) string {
+	if val == "" {
+		return ""
+	}
+
+	e, err := routetable.ParseRouteEntry(val)
+	if err != nil {
+		return ""
+	}
+
+	return e.Addr
+}
+
+// Prune removes the oids from the index of addr whose route does not exist or is routed to another address
+// with one script, which checks and removes them atomically.
+func (x *AddrIndex) Prune(ctx context.Context, name, color, addr string, oids ...int64) error {
+	if len(oids) == 0 {
+		return nil
+	}
+
+	key := x.key(name, color, addr)
+
+	keys := make([]string, 0, len(oids)+1)
+	args := make([]any, 0, len(oids)+1)
+
+	keys = append(keys, key)
+	args = append(args, addr)
+
+	for _, oid := range oids {
+		keys = append(keys, x.codec.Encode(name, color, oid))
+		args = append(args, strconv.FormatInt(oid, 10))
+	}
+
+	if err := pruneScript.Run(ctx, x.client, keys, args...).Err(); err != nil {
+		return errors.Wrapf(err, "key=%s", key)
+	}
+
+	return nil
+}
+
+// Scan iterates the oids recorded for addr with SSCAN.
+func (x *AddrIndex) Scan(ctx context.Context, name, color, addr string, cursor uint64, count int64) ([]int64, uint64, error) {
+	key := x.key(name, color, addr)
+
+	vals, next, err := x.client.SScan(ctx, key, cursor, "", count).Result()
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "key=%s cursor=%d", key, cursor)
+	}
+
+	oids := make([]int64, 0, len(vals))
+
+	for _, v := range vals {
+		oid, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "invalid oid in address index. key=%s member=%s", key, v)
+		}
+
+		oids = append(oids, oid)
+	}
+
+	return oids, next, nil
+}
+
+// Count returns the number of oids recorded for addr with SCARD, after pruning the oids of the routes
+// that expired or moved to another address page by page, so it reads every route recorded for addr.
+func (x *AddrIndex) Count(ctx context.Context, name, color, addr string) (int64, error) {
+	for cursor := uint64(0); ; {
+		oids, next, err := x.Scan(ctx, name, color, addr, cursor, countPage)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := x.Prune(ctx, name, color, addr, oids...); err != nil {
+			return 0, err
+		}
+
+		if next == 0 {
+			break
+		}
+
+		cursor = next
+	}
+
+	key := x.key(name, color, addr)
+
+	n, err := x.client.SCard(ctx, key).Result()
+	if err != nil {
+		return 0, errors.Wrapf(err, "key=%s", key)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,305 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testName  = "player"
+	testColor = "blue"
+)
+
+func listAllByAddr(t *testing.T, rt routetable.MasterRouteTable, addr string) []int64 {
+	t.Helper()
+
+	var (
+		all    []int64
+		cursor uint64
+	)
+
+	for {
+		oids, next, err := rt.ListByAddr(context.Background(), testColor, addr, cursor, 2)
+		require.NoError(t, err)
+
+		all = append(all, oids...)
+
+		if next == 0 {
+			return all
+		}
+
+		cursor = next
+	}
+}
+
+func TestAddrIndex(t *testing.T) {
+	t.Parallel()
+
+	const a, b = "10.0.0.1:9000", "10.0.0.2:9000"
+
+	ctx := context.Background()
+	data, mr := newTestRouteTable(t, WithAddrIndex(routetable.LegacyKeyCodec))
+	rt := routetable.NewMasterRouteTable(data, testName, routetable.WithAddrIndex(data.AddrIndex()))
+
+	_, err := rt.BatchSetNxOrGet(ctx, testColor, []int64{1, 2, 3, 4, 5, 6}, a)
+	require.NoError(t, err)
+	require.NoError(t, rt.Set(ctx, testColor, 7, b))
+
+	_, _, err = rt.GetSet(ctx, testColor, 2, b)
+	require.NoError(t, err)
+	_, err = rt.CompareAndSwap(ctx, testColor, 3, a, b)
+	require.NoError(t, err)
+	require.NoError(t, rt.Del(ctx, testColor, 4))
+
+	_, epoch, err := rt.GetWithEpoch(ctx, testColor, 6)
+	require.NoError(t, err)
+	require.NoError(t, rt.DelIfSame(ctx, testColor, 6, a, epoch))
+
+	// the sets are in the hash slot of the routes of the color, and the address is escaped
+	members, err := mr.Members("{blue}ra1:player:blue:{10.0.0.1%3A9000}")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "5"}, members)
+
+	assert.ElementsMatch(t, []int64{1, 5}, listAllByAddr(t, rt, a))
+	assert.ElementsMatch(t, []int64{2, 3, 7}, listAllByAddr(t, rt, b))
+
+	// oid 5 expires without a write, so it is left in the index until it is counted or listed
+	require.NoError(t, rt.DelDelay(ctx, testColor, 5, time.Second))
+	mr.FastForward(2 * time.Second)
+
+	n, err := rt.CountByAddr(ctx, testColor, a)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	members, err = mr.Members("{blue}ra1:player:blue:{10.0.0.1%3A9000}")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, members)
+
+	assert.ElementsMatch(t, []int64{1}, listAllByAddr(t, rt, a))
+}
+
+func TestAddrIndexTTL(t *testing.T) {
+	t.Parallel()
+
+	const set = "{blue}ra1:player:blue:{a}"
+
+	ctx := context.Background()
+	rt, mr := newTestRouteTable(t, WithAddrIndex(routetable.LegacyKeyCodec))
+
+	key := func(oid int64) string {
+		return routetable.Key(testName, testColor, oid)
+	}
+
+	// the set expires with the route that expires last
+	require.NoError(t, rt.Set(ctx, key(1), "a", time.Minute))
+	assert.Equal(t, time.Minute, mr.TTL(set))
+
+	require.NoError(t, rt.Set(ctx, key(2), "a", 2*time.Minute))
+	assert.Equal(t, 2*time.Minute, mr.TTL(set))
+
+	require.NoError(t, rt.Set(ctx, key(1), "a", time.Second))
+	assert.Equal(t, 2*time.Minute, mr.TTL(set))
+
+	_, err := rt.GetEx(ctx, key(1), 3*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 3*time.Minute, mr.TTL(set))
+
+	require.NoError(t, rt.Expire(ctx, key(2), 4*time.Minute))
+	assert.Equal(t, 4*time.Minute, mr.TTL(set))
+
+	// a persistent route persists the set
+	_, err = rt.GetEx(ctx, key(1), 0)
+	require.NoError(t, err)
+	assert.Zero(t, mr.TTL(set))
+
+	require.NoError(t, rt.Set(ctx, key(3), "a", time.Minute))
+	assert.Zero(t, mr.TTL(set))
+
+	// the set expires after its routes, leaving no stale members
+	require.NoError(t, rt.Del(ctx, key(1)))
+	require.NoError(t, rt.Del(ctx, key(2)))
+	require.NoError(t, rt.Del(ctx, key(3)))
+	require.NoError(t, rt.Set(ctx, key(4), "a", time.Minute))
+	assert.Equal(t, time.Minute, mr.TTL(set))
+
+	mr.FastForward(time.Minute)
+	assert.False(t, mr.Exists(key(4)))
+	assert.False(t, mr.Exists(set))
+}
+
+func TestAddrIndexRouteChanged(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, mr := newTestRouteTable(t, WithAddrIndex(routetable.LegacyKeyCodec))
+
+	key := routetable.Key(testName, testColor, 1)
+	require.NoError(t, rt.Set(ctx, key, "a", 0))
+
+	// a script given the index keys of stale owners writes nothing
+	err := getSetScript.Run(ctx, rt.client, rt.keys(key, "", "b"), rt.args(key, "b", 0)...).Err()
+	require.Error(t, err)
+	assert.True(t, isRouteChanged(err))
+
+	val, err := mr.Get(key)
+	require.NoError(t, err)
+	assert.Equal(t, "a", val)
+	assert.False(t, mr.Exists("{blue}ra1:player:blue:{b}"))
+
+	// the owner is read again until the declared keys are the current ones
+	calls := 0
+	err = rt.withOwner(ctx, key, func(cur string) error {
+		calls++
+		if calls == 1 {
+			cur = ""
+		}
+
+		return getSetScript.Run(ctx, rt.client, rt.keys(key, owner(cur), "b"), rt.args(key, "b", 0)...).Err()
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	members, err := mr.Members("{blue}ra1:player:blue:{b}")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, members)
+	assert.False(t, mr.Exists("{blue}ra1:player:blue:{a}"))
+}
+
+func TestAddrIndexWrites(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, mr := newTestRouteTable(t, WithAddrIndex(routetable.LegacyKeyCodec))
+
+	key := func(oid int64) string {
+		return routetable.Key(testName, testColor, oid)
+	}
+
+	members := func(addr string) []string {
+		t.Helper()
+
+		if !mr.Exists("{blue}ra1:player:blue:{" + addr + "}") {
+			return nil
+		}
+
+		m, err := mr.Members("{blue}ra1:player:blue:{" + addr + "}")
+		require.NoError(t, err)
+
+		return m
+	}
+
+	errs, err := rt.BatchSetWithTTL(ctx, []string{key(1), key(2), key(3), key(4)}, []string{"a", "a", "a", "a"},
+		[]time.Duration{time.Minute, time.Minute, time.Minute, 0})
+	require.NoError(t, err)
+	require.Equal(t, []error{nil, nil, nil, nil}, errs)
+	assert.ElementsMatch(t, []string{"1", "2", "3", "4"}, members("a"))
+
+	// a failed condition leaves the index unchanged
+	errs, err = rt.BatchCompareAndSwap(ctx, []string{key(1), key(2)}, []string{"a", "x"}, []string{"b", "b"}, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, errs[0])
+	require.Error(t, errs[1])
+	assert.ElementsMatch(t, []string{"2", "3", "4"}, members("a"))
+	assert.Equal(t, []string{"1"}, members("b"))
+
+	errs, err = rt.BatchExpireIfSame(ctx, []string{key(2)}, []string{"a"}, 0)
+	require.NoError(t, err)
+	require.NoError(t, errs[0])
+
+	errs, err = rt.BatchDelIfSame(ctx, []string{key(3)}, []string{"a"})
+	require.NoError(t, err)
+	require.NoError(t, errs[0])
+	assert.Equal(t, []string{"4"}, members("a"))
+
+	// the last member leaves an empty set, which Redis deletes
+	require.NoError(t, rt.Expire(ctx, key(4), 0))
+	assert.Nil(t, members("a"))
+	assert.False(t, mr.Exists(key(4)))
+
+	// keys that are not routes of the codec are not indexed
+	require.NoError(t, rt.Set(ctx, "other", "a", 0))
+	assert.Nil(t, members("a"))
+}
+
+func TestAddrIndexClusterCodec(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, mr := newTestRouteTable(t, WithAddrIndex(routetable.LegacyClusterKeyCodec))
+
+	require.NoError(t, rt.Set(ctx, routetable.LegacyClusterKeyCodec.Encode(testName, testColor, 1), "a", 0))
+
+	// the routes of a color are spread across slots, so the index keys have no hash tag of the color
+	members, err := mr.Members("ra1:player:blue:{a}")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, members)
+}
+
+func TestAddrIndexClusterCodecs(t *testing.T) {
+	t.Parallel()
+
+	// the index of a color must be in the hash slot of its routes on a cluster
+	for _, codec := range []routetable.KeyCodec{routetable.V1KeyCodec, routetable.LegacyClusterKeyCodec} {
+		rt, _ := newTestClusterRouteTable(t, WithAddrIndex(codec))
+		assert.Nil(t, rt.AddrIndex(), "%T", codec)
+	}
+
+	ctx := context.Background()
+	data, mr := newTestClusterRouteTable(t, WithAddrIndex(routetable.LegacyKeyCodec))
+	require.NotNil(t, data.AddrIndex())
+
+	rt := routetable.NewMasterRouteTable(data, testName, routetable.WithAddrIndex(data.AddrIndex()))
+	require.NoError(t, rt.Set(ctx, testColor, 1, "a"))
+	require.NoError(t, rt.Set(ctx, testColor, 2, "a"))
+	_, _, err := rt.GetSet(ctx, testColor, 2, "b")
+	require.NoError(t, err)
+
+	members, err := mr.Members("{blue}ra1:player:blue:{a}")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, members)
+
+	n, err := rt.CountByAddr(ctx, testColor, "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestAddrIndexPrune(t *testing.T) {
+	t.Parallel()
+
+	const a, b = "10.0.0.1:9000", "10.0.0.2:9000"
+
+	ctx := context.Background()
+	data, mr := newTestRouteTable(t, WithAddrIndex(routetable.LegacyKeyCodec))
+	rt := routetable.NewMasterRouteTable(data, testName, routetable.WithAddrIndex(data.AddrIndex()))
+	idx := data.AddrIndex()
+
+	require.NoError(t, rt.Set(ctx, testColor, 1, a))
+	require.NoError(t, rt.Set(ctx, testColor, 2, b))
+
+	// stale members, as left by routes that expired
+	key := "{blue}ra1:player:blue:{10.0.0.1%3A9000}"
+	_, err := mr.SAdd(key, "2", "3")
+	require.NoError(t, err)
+
+	// oid 1 is still routed to a and kept
+	require.NoError(t, idx.Prune(ctx, testName, testColor, a, 1, 2, 3))
+
+	members, err := mr.Members(key)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, members)
+}
+
+func TestAddrIndexNotConfigured(t *testing.T) {
+	t.Parallel()
+
+	data, mr := newTestRouteTable(t)
+	assert.Nil(t, data.AddrIndex())
+
+	require.NoError(t, data.Set(context.Background(), routetable.Key(testName, testColor, 1), "10.0.0.1:9000", 0))
+	assert.Equal(t, []string{routetable.Key(testName, testColor, 1)}, mr.Keys())
+}
@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultInvalidationChannel is the pub/sub channel used when no channel is given to NewInvalidator.
+const DefaultInvalidationChannel = "routetable:invalidate"
+
+var _ routetable.Invalidator = (*Invalidator)(nil)
+
+// Invalidator implements the routetable.Invalidator interface with Redis pub/sub.
+type Invalidator struct {
+	client  redis.UniversalClient
+	channel string
+}
+
+// NewInvalidator creates a new Redis pub/sub invalidator on the given channel.
+// An empty channel uses DefaultInvalidationChannel.
+func NewInvalidator(client redis.UniversalClient, channel string) *Invalidator {
+	if channel == "" {
+		channel = DefaultInvalidationChannel
+	}
+
+	return &Invalidator{
+		client:  client,
+		channel: channel,
+	}
+}
+
+// Publish publishes key to the invalidation channel.
+func (i *Invalidator) Publish(ctx context.Context, key string) error {
+	if err := i.client.Publish(ctx, i.channel, key).Err(); err != nil {
+		return errors.Wrapf(err, "publish invalidation failed. channel=%s key=%s", i.channel, key)
+	}
+
+	return nil
+}
+
+// Subscribe calls fn with every key published to the invalidation channel until ctx is done.
+// The subscription is re-established by the client after a connection loss, which loses the keys
+// published in between, so fn is called with routetable.InvalidateAll on every subscription confirmation.
+func (i *Invalidator) Subscribe(ctx context.Context, fn func(key string)) error {
+	ps := i.client.Subscribe(ctx, i.channel)
+	defer ps.Close()
+
+	if _, err := ps.Receive(ctx); err != nil {
+		return errors.Wrapf(err, "subscribe invalidation failed. channel=%s", i.channel)
+	}
+
+	fn(routetable.InvalidateAll)
+
+	ch := ps.ChannelWithSubscriptions()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+
+			switch msg := msg.(type) {
+			case *redis.Message:
+				fn(msg.Payload)
+			case *redis.Subscription:
+				if msg.Kind == "subscribe" {
+					fn(routetable.InvalidateAll)
+				}
+			}
+		}
+	}
+}
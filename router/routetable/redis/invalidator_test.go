@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-util/xsync"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvalidatorResubscribe(t *testing.T) {
+	t.Parallel()
+
+	data, mr := newTestRouteTable(t)
+	inv := NewInvalidator(data.client, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	keys := make(chan string, 16)
+
+	xsync.Go("test.subscribe", func() error {
+		return inv.Subscribe(ctx, func(key string) { keys <- key })
+	})
+
+	next := func() string {
+		select {
+		case key := <-keys:
+			return key
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no invalidation received")
+			return ""
+		}
+	}
+
+	assert.Equal(t, routetable.InvalidateAll, next())
+
+	require.NoError(t, inv.Publish(ctx, "k"))
+	assert.Equal(t, "k", next())
+
+	// keys published while the subscription is down are lost, so the resubscription invalidates everything
+	mr.Close()
+	require.NoError(t, mr.Restart())
+
+	assert.Equal(t, routetable.InvalidateAll, next())
+
+	require.NoError(t, inv.Publish(ctx, "k2"))
+	assert.Equal(t, "k2", next())
+}
@@ -3,6 +3,7 @@ package redis
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/go-pantheon/fabrica-kit/router/routetable"
@@ -13,16 +14,89 @@ import (
 
 var _ routetable.Data = (*RouteTable)(nil)
 
+// Option is a function type that configures a RouteTable instance.
+type Option func(*RouteTable)
+
 // RouteTable implements the routetable.Data interface using Redis.
 type RouteTable struct {
 	client redis.UniversalClient
+	index  *AddrIndex
 }
 
 // New creates a new Redis-based route table data store.
-func New(client redis.UniversalClient) *RouteTable {
-	return &RouteTable{
+func New(client redis.UniversalClient, opts ...Option) *RouteTable {
+	r := &RouteTable{
 		client: client,
 	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// maxOwnerRetries is how many times a write of an indexed route is retried when the owner of the route
+// changes between the read of the route and the write, see withOwner.
+const maxOwnerRetries = 16
+
+// args returns the arguments of a script that writes the route of key, followed by its index arguments.
+func (r *RouteTable) args(key string, args ...any) []any {
+	return append(args, r.index.args(key)...)
+}
+
+// keys returns the keys of a script that writes the route of key from the owner from to the owner to:
+// key and keys, followed by the index keys of the owners, see AddrIndex.keys.
+func (r *RouteTable) keys(key, from, to string, keys ...string) []string {
+	return append(append([]string{key}, keys...), r.index.keys(key, from, to)...)
+}
+
+// withOwner runs fn with the current value of key, or an empty value if it does not exist, for the scripts
+// that declare the index key of the current owner of the route. fn runs again with the value read again
+// while it fails because the owner changed in the meantime. Without an address index, fn runs once with an empty value.
+func (r *RouteTable) withOwner(ctx context.Context, key string, fn func(cur string) error) error {
+	if r.index == nil {
+		return fn("")
+	}
+
+	for range maxOwnerRetries {
+		cur, err := r.client.Get(ctx, key).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return errors.Wrapf(err, "get route failed. key=%s", key)
+		}
+
+		if err := fn(cur); !isRouteChanged(err) {
+			return err
+		}
+	}
+
+	return errors.Errorf("the owner of the route kept changing. key=%s retries=%d", key, maxOwnerRetries)
+}
+
+// isRouteChanged reports whether err is the error of a script that did not write a route
+// because its owner changed, see routeChanged.
+func isRouteChanged(err error) bool {
+	return err != nil && strings.Contains(err.Error(), routeChanged)
+}
+
+// owners returns the index owners of vals, the values of keys read before a batch of writes that declare
+// the index keys of the current owners. They are empty without an address index.
+func (r *RouteTable) owners(ctx context.Context, keys []string) ([]string, error) {
+	owners := make([]string, len(keys))
+	if r.index == nil {
+		return owners, nil
+	}
+
+	vals, err := r.BatchGet(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, val := range vals {
+		owners[i] = owner(val)
+	}
+
+	return owners, nil
 }
 
 // Get retrieves a value from Redis by key.
@@ -35,9 +109,23 @@ func (r *RouteTable) Get(ctx context.Context, key string) (string, error) {
 	return val, errors.Wrapf(err, "key=%s", key)
 }
 
-// GetEx loads a value and resets its expiration time.
+// GetEx loads a value and resets its expiration time. A zero expiration persists the key and a negative one
+// leaves it unchanged. With an address index, it runs a script that also extends the expiration of the index.
 func (r *RouteTable) GetEx(ctx context.Context, key string, exp time.Duration) (string, error) {
-	val, err := r.client.GetEx(ctx, key, exp).Result()
+	var (
+		val string
+		err error
+	)
+
+	if r.index != nil && exp >= 0 {
+		err = r.withOwner(ctx, key, func(cur string) error {
+			val, err = getExScript.Run(ctx, r.client, r.keys(key, owner(cur), owner(cur)), r.args(key, ttlArg(exp))...).Text()
+			return err
+		})
+	} else {
+		val, err = r.client.GetEx(ctx, key, exp).Result()
+	}
+
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
 			return "", xerrors.ErrRouteTableNotFoundFunc(key)
@@ -49,7 +137,18 @@ func (r *RouteTable) GetEx(ctx context.Context, key string, exp time.Duration) (
 	return val, nil
 }
 
+// BatchGet retrieves the values of keys in order. Missing keys produce an empty string.
+// On a Redis Cluster the keys are grouped by hash slot and the MGET of every slot is pipelined,
+// so the keys do not need to share a slot.
 func (r *RouteTable) BatchGet(ctx context.Context, keys []string) (addrs []string, err error) {
+	if len(keys) == 0 {
+		return []string{}, nil
+	}
+
+	if _, ok := r.client.(*redis.ClusterClient); ok {
+		return r.clusterBatchGet(ctx, keys)
+	}
+
 	vals, err := r.client.MGet(ctx, keys...).Result()
 	if err != nil {
 		return nil, errors.Wrapf(err, "batch get route table failed")
@@ -57,37 +156,94 @@ func (r *RouteTable) BatchGet(ctx context.Context, keys []string) (addrs []strin
 
 	addrs = make([]string, 0, len(vals))
 	for _, val := range vals {
-		if val == nil {
-			addrs = append(addrs, "")
-		} else {
-			addrs = append(addrs, val.(string))
+		addrs = append(addrs, toString(val))
+	}
+
+	return addrs, nil
+}
+
+func (r *RouteTable) clusterBatchGet(ctx context.Context, keys []string) ([]string, error) {
+	var (
+		slots   []int
+		indexes = make(map[int][]int)
+	)
+
+	for i, key := range keys {
+		slot := hashSlot(key)
+		if _, ok := indexes[slot]; !ok {
+			slots = append(slots, slot)
+		}
+
+		indexes[slot] = append(indexes[slot], i)
+	}
+
+	cmds := make([]*redis.SliceCmd, 0, len(slots))
+
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, slot := range slots {
+			slotKeys := make([]string, 0, len(indexes[slot]))
+			for _, i := range indexes[slot] {
+				slotKeys = append(slotKeys, keys[i])
+			}
+
+			cmds = append(cmds, pipe.MGet(ctx, slotKeys...))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "batch get route table failed. slots=%d", len(slots))
+	}
+
+	addrs := make([]string, len(keys))
+
+	for i, slot := range slots {
+		for j, val := range cmds[i].Val() {
+			addrs[indexes[slot][j]] = toString(val)
 		}
 	}
 
 	return addrs, nil
 }
 
+func toString(val any) string {
+	if s, ok := val.(string); ok {
+		return s
+	}
+
+	return ""
+}
+
 // GetSet atomically sets a new value and returns the old value.
+// The old value is empty if the key did not exist.
 func (r *RouteTable) GetSet(ctx context.Context, key, val string, expire time.Duration) (string, error) {
-	cmd := r.client.GetSet(ctx, key, val)
-	if err := cmd.Err(); err != nil {
-		return "", errors.Wrapf(err, "key=%s", key)
-	}
+	var old string
 
-	if err := r.client.Expire(ctx, key, expire).Err(); err != nil {
+	err := r.withOwner(ctx, key, func(cur string) (err error) {
+		old, err = getSetScript.Run(ctx, r.client, r.keys(key, owner(cur), owner(val)), r.args(key, val, ttlArg(expire))...).Text()
+		return err
+	})
+	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			return "", xerrors.ErrRouteTableNotFoundFunc(key)
+			return "", nil
 		}
 
-		return "", err
+		return "", errors.Wrapf(err, "key=%s", key)
 	}
 
-	return cmd.Val(), nil
+	return old, nil
 }
 
 // Set stores a key-value pair in Redis with an expiration time.
+// With an address index, it runs GetSet to update the index with the route.
 func (r *RouteTable) Set(ctx context.Context, key, val string, expire time.Duration) error {
-	if err := r.client.Set(ctx, key, val, expire).Err(); err != nil {
+	if r.index != nil {
+		_, err := r.GetSet(ctx, key, val, expire)
+		return err
+	}
+
+	// go-redis keeps the current expiration with the negative redis.KeepTTL
+	if err := r.client.Set(ctx, key, val, max(expire, 0)).Err(); err != nil {
 		return errors.Wrapf(err, "key=%s val=%s expire=%s", key, val, expire)
 	}
 
@@ -95,26 +251,301 @@ func (r *RouteTable) Set(ctx context.Context, key, val string, expire time.Durat
 }
 
 // SetNxOrGet sets a key-value pair only if the key does not exist.
+// It returns the current value if the key already exists.
 func (r *RouteTable) SetNxOrGet(ctx context.Context, key, val string, expire time.Duration) (bool, string, error) {
-	ok, err := r.client.SetNX(ctx, key, val, expire).Result()
+	set, cur, err := setNxOrGetResult(key, setNxOrGetScript.Run(ctx, r.client, r.keys(key, "", owner(val)), r.args(key, val, ttlArg(expire))...))
 	if err != nil {
-		return false, "", errors.Wrapf(err, "setnx route table failed. key=%s val=%s expire=%s", key, val, expire)
+		return false, "", errors.WithMessagef(err, "setnx route table failed. val=%s expire=%s", val, expire)
 	}
 
-	if !ok {
-		v, err := r.client.Get(ctx, key).Result()
-		if errors.Is(err, redis.Nil) {
-			return false, "", xerrors.ErrRouteTableNotFoundFunc(key)
+	return set, cur, nil
+}
+
+func setNxOrGetResult(key string, cmd *redis.Cmd) (bool, string, error) {
+	ret, err := cmd.Slice()
+	if err != nil {
+		return false, "", errors.Wrapf(err, "key=%s", key)
+	}
+
+	if len(ret) != 2 {
+		return false, "", errors.Errorf("setnx script returned %d values. key=%s", len(ret), key)
+	}
+
+	set, _ := ret[0].(int64)
+	cur, _ := ret[1].(string)
+
+	return set == 1, cur, nil
+}
+
+// BatchSet runs Set on every key with the value of the same index in one pipeline.
+func (r *RouteTable) BatchSet(ctx context.Context, keys, vals []string, expire time.Duration) ([]error, error) {
+	ttls := make([]time.Duration, len(keys))
+	for i := range ttls {
+		ttls[i] = expire
+	}
+
+	return r.BatchSetWithTTL(ctx, keys, vals, ttls)
+}
+
+// BatchSetWithTTL runs Set on every key with the value and the expiration time of the same index in one pipeline.
+func (r *RouteTable) BatchSetWithTTL(ctx context.Context, keys, vals []string, expires []time.Duration) ([]error, error) {
+	if len(keys) != len(vals) || len(keys) != len(expires) {
+		return nil, errors.Errorf("batch set got %d keys, %d values and %d expiration times", len(keys), len(vals), len(expires))
+	}
+
+	if r.index != nil {
+		return r.batchGetSet(ctx, keys, vals, expires)
+	}
+
+	cmds := make([]*redis.StatusCmd, len(keys))
+
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Set(ctx, key, vals[i], max(expires[i], 0))
 		}
 
-		return false, v, errors.Wrapf(err, "key=%s", key)
+		return nil
+	})
+	if err != nil && !isRedisError(err) {
+		return nil, errors.Wrapf(err, "batch set route table failed. keys=%d", len(keys))
 	}
 
-	return true, val, nil
+	errs := make([]error, len(keys))
+
+	for i, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			errs[i] = errors.Wrapf(err, "key=%s val=%s expire=%s", keys[i], vals[i], expires[i])
+		}
+	}
+
+	return errs, nil
+}
+
+// batchGetSet is BatchSetWithTTL with GetSet, which updates the address index with the routes.
+// The keys whose owner changed after they were read are set again one by one.
+func (r *RouteTable) batchGetSet(ctx context.Context, keys, vals []string, expires []time.Duration) ([]error, error) {
+	owners, err := r.owners(ctx, keys)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "batch set route table failed. keys=%d", len(keys))
+	}
+
+	cmds, err := r.runScripts(ctx, getSetScript, len(keys), func(i int) []string {
+		return r.keys(keys[i], owners[i], owner(vals[i]))
+	}, func(i int) []any {
+		return r.args(keys[i], vals[i], ttlArg(expires[i]))
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "batch set route table failed. keys=%d", len(keys))
+	}
+
+	errs := make([]error, len(keys))
+
+	for i, cmd := range cmds {
+		if isRouteChanged(cmd.Err()) {
+			_, errs[i] = r.GetSet(ctx, keys[i], vals[i], expires[i])
+			continue
+		}
+
+		if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+			errs[i] = errors.Wrapf(err, "key=%s val=%s expire=%s", keys[i], vals[i], expires[i])
+		}
+	}
+
+	return errs, nil
+}
+
+// BatchSetNxOrGet runs SetNxOrGet on every key with the value of the same index in one pipeline.
+func (r *RouteTable) BatchSetNxOrGet(ctx context.Context, keys, vals []string, expire time.Duration) ([]routetable.SetNxOrGetResult, error) {
+	if len(keys) != len(vals) {
+		return nil, errors.Errorf("batch setnx got %d keys and %d values", len(keys), len(vals))
+	}
+
+	ttl := ttlArg(expire)
+
+	cmds, err := r.runScripts(ctx, setNxOrGetScript, len(keys), func(i int) []string {
+		return r.keys(keys[i], "", owner(vals[i]))
+	}, func(i int) []any {
+		return r.args(keys[i], vals[i], ttl)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "batch setnx route table failed. keys=%d", len(keys))
+	}
+
+	results := make([]routetable.SetNxOrGetResult, len(keys))
+
+	for i, cmd := range cmds {
+		set, cur, err := setNxOrGetResult(keys[i], cmd)
+		results[i] = routetable.SetNxOrGetResult{Set: set, Addr: cur, Err: err}
+	}
+
+	return results, nil
 }
 
-// Expire sets an expiration time for a key.
+// CompareAndSwap sets key to val only if its current value is old.
+func (r *RouteTable) CompareAndSwap(ctx context.Context, key, old, val string, expire time.Duration) error {
+	code, err := compareAndSwapScript.Run(ctx, r.client, r.keys(key, owner(old), owner(val)), r.args(key, old, val, ttlArg(expire))...).Int64()
+	if err != nil {
+		return errors.Wrapf(err, "key=%s", key)
+	}
+
+	return conditionalResult(key, old, code)
+}
+
+// BatchCompareAndSwap runs CompareAndSwap on every key with the values of the same index in one pipeline.
+func (r *RouteTable) BatchCompareAndSwap(ctx context.Context, keys, olds, vals []string, expire time.Duration) ([]error, error) {
+	if len(keys) != len(olds) || len(keys) != len(vals) {
+		return nil, errors.Errorf("batch cas got %d keys, %d old values and %d values", len(keys), len(olds), len(vals))
+	}
+
+	ttl := ttlArg(expire)
+
+	cmds, err := r.runScripts(ctx, compareAndSwapScript, len(keys), func(i int) []string {
+		return r.keys(keys[i], owner(olds[i]), owner(vals[i]))
+	}, func(i int) []any {
+		return r.args(keys[i], olds[i], vals[i], ttl)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "batch cas route table failed. keys=%d", len(keys))
+	}
+
+	return conditionalResults(keys, olds, cmds), nil
+}
+
+// Assign sets key to val with a new epoch if the condition of mode holds, see routetable.Data.
+// The epochs of a key are counted by a counter in its hash slot, which is seeded with the server time
+// in microseconds. The counter outlives the key, so that its epochs keep increasing after it expires
+// or is deleted, and expires itself ten times the ttl of the key after its last assignment, and at least a day.
+// While the key exists its epoch is also in its value, and a counter seeded again from the server time
+// is above the epochs of a key removed long before, as they are allocated far less than once per microsecond.
+func (r *RouteTable) Assign(ctx context.Context, mode routetable.AssignMode, key, expect, val string, expire time.Duration) (routetable.AssignResult, error) {
+	if _, err := routetable.ReplaceEpoch(val, 0); err != nil {
+		return routetable.AssignResult{}, errors.WithMessagef(err, "key=%s", key)
+	}
+
+	var ret routetable.AssignResult
+
+	assign := func(cur string) (err error) {
+		keys := r.keys(key, assignOwner(mode, expect, owner(cur)), owner(val), epochKey(key))
+		ret, err = assignResult(key, mode, expect, assignScript.Run(ctx, r.client, keys, r.args(key, int(mode), expect, val, ttlArg(expire), epochTTLArg(expire))...))
+
+		return err
+	}
+
+	// Only an unconditional assignment needs the current owner, the others know it if they write.
+	if mode == routetable.AssignAlways {
+		return ret, r.withOwner(ctx, key, assign)
+	}
+
+	return ret, assign("")
+}
+
+// assignOwner returns the owner of a route when Assign with mode writes it, where cur is its owner read before.
+func assignOwner(mode routetable.AssignMode, expect, cur string) string {
+	switch mode {
+	case routetable.AssignAlways:
+		return cur
+	case routetable.AssignIfAddr:
+		return expect
+	default:
+		return ""
+	}
+}
+
+// BatchAssign runs Assign on every key with the values of the same index in one pipeline.
+func (r *RouteTable) BatchAssign(ctx context.Context, mode routetable.AssignMode, keys, expects, vals []string, expire time.Duration) ([]routetable.AssignResult, error) {
+	if len(keys) != len(expects) || len(keys) != len(vals) {
+		return nil, errors.Errorf("batch assign got %d keys, %d expected values and %d values", len(keys), len(expects), len(vals))
+	}
+
+	for i, val := range vals {
+		if _, err := routetable.ReplaceEpoch(val, 0); err != nil {
+			return nil, errors.WithMessagef(err, "key=%s", keys[i])
+		}
+	}
+
+	var owners []string
+
+	if mode == routetable.AssignAlways {
+		var err error
+		if owners, err = r.owners(ctx, keys); err != nil {
+			return nil, errors.WithMessagef(err, "batch assign route table failed. keys=%d", len(keys))
+		}
+	}
+
+	ttl, epochTTL := ttlArg(expire), epochTTLArg(expire)
+
+	cmds, err := r.runScripts(ctx, assignScript, len(keys), func(i int) []string {
+		var cur string
+		if owners != nil {
+			cur = owners[i]
+		}
+
+		return r.keys(keys[i], assignOwner(mode, expects[i], cur), owner(vals[i]), epochKey(keys[i]))
+	}, func(i int) []any {
+		return r.args(keys[i], int(mode), expects[i], vals[i], ttl, epochTTL)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "batch assign route table failed. keys=%d", len(keys))
+	}
+
+	results := make([]routetable.AssignResult, len(keys))
+
+	for i, cmd := range cmds {
+		if isRouteChanged(cmd.Err()) {
+			ret, err := r.Assign(ctx, mode, keys[i], expects[i], vals[i], expire)
+			ret.Err = err
+			results[i] = ret
+
+			continue
+		}
+
+		ret, err := assignResult(keys[i], mode, expects[i], cmd)
+		ret.Err = err
+		results[i] = ret
+	}
+
+	return results, nil
+}
+
+func assignResult(key string, mode routetable.AssignMode, expect string, cmd *redis.Cmd) (routetable.AssignResult, error) {
+	ret, err := cmd.Slice()
+	if err != nil {
+		return routetable.AssignResult{}, errors.Wrapf(err, "key=%s", key)
+	}
+
+	vals := make([]string, 3)
+	for i := 1; i < len(ret) && i < len(vals); i++ {
+		vals[i], _ = ret[i].(string)
+	}
+
+	code, _ := ret[0].(int64)
+
+	switch {
+	case code == scriptOK:
+		return routetable.AssignResult{Assigned: true, Prev: vals[1], Value: vals[2]}, nil
+	case code == scriptNotSame && mode == routetable.AssignIfAbsent:
+		return routetable.AssignResult{Value: vals[1]}, nil
+	case code == scriptNotSame:
+		return routetable.AssignResult{Value: vals[1]}, xerrors.ErrRouteTableValueNotSameFunc(key, expect)
+	default:
+		return routetable.AssignResult{}, conditionalResult(key, expect, code)
+	}
+}
+
+// Expire sets an expiration time for a key. A non-positive expiration deletes the key.
+// With an address index, it runs a script that also extends the expiration of the index or removes the key from it.
 func (r *RouteTable) Expire(ctx context.Context, key string, expire time.Duration) error {
+	if r.index != nil {
+		err := r.withOwner(ctx, key, func(cur string) error {
+			return expireScript.Run(ctx, r.client, r.keys(key, owner(cur), expireOwner(cur, expire)), r.args(key, ttlArg(expire))...).Err()
+		})
+		if err != nil {
+			return errors.Wrapf(err, "key=%s expire=%s", key, expire)
+		}
+
+		return nil
+	}
+
 	if err := r.client.Expire(ctx, key, expire).Err(); err != nil {
 		if errors.Is(err, redis.Nil) {
 			return xerrors.ErrRouteTableNotFoundFunc(key)
@@ -126,35 +557,60 @@ func (r *RouteTable) Expire(ctx context.Context, key string, expire time.Duratio
 	return nil
 }
 
-func (r *RouteTable) ExpireIfSame(ctx context.Context, key, expect string, expire time.Duration) error {
-	txf := func(tx *redis.Tx) error {
-		v, err := tx.Get(ctx, key).Result()
-		if errors.Is(err, redis.Nil) {
-			return xerrors.ErrRouteTableNotFoundFunc(key)
-		}
+// expireOwner returns the owner of the route val after it is expired with expire, which deletes it if it is not positive.
+func expireOwner(val string, expire time.Duration) string {
+	if expire <= 0 {
+		return ""
+	}
 
-		if err != nil {
-			return errors.Wrapf(err, "key=%s", key)
-		}
+	return owner(val)
+}
 
-		if v != expect {
-			return xerrors.ErrRouteTableValueNotSameFunc(key, expect)
-		}
+// ExpireIfSame sets an expiration time for a key only if its current value matches the expected value.
+// Like EXPIRE, a non-positive expiration deletes the key.
+func (r *RouteTable) ExpireIfSame(ctx context.Context, key, expect string, expire time.Duration) error {
+	code, err := expireIfSameScript.Run(ctx, r.client, r.keys(key, owner(expect), expireOwner(expect, expire)), r.args(key, expect, ttlArg(expire))...).Int64()
+	if err != nil {
+		return errors.Wrapf(err, "key=%s", key)
+	}
 
-		_, err = tx.Expire(ctx, key, expire).Result()
+	return conditionalResult(key, expect, code)
+}
 
-		return errors.Wrapf(err, "key=%s", key)
+// BatchExpireIfSame runs ExpireIfSame on every key with the value of the same index in one pipeline.
+// Each key is checked and renewed atomically, but the batch as a whole is not atomic.
+func (r *RouteTable) BatchExpireIfSame(ctx context.Context, keys, values []string, expire time.Duration) ([]error, error) {
+	if len(keys) != len(values) {
+		return nil, errors.Errorf("batch expire got %d keys and %d values", len(keys), len(values))
 	}
 
-	if err := r.client.Watch(ctx, txf, key); err != nil {
-		return errors.Wrapf(err, "key=%s", key)
+	ttl := ttlArg(expire)
+
+	cmds, err := r.runScripts(ctx, expireIfSameScript, len(keys), func(i int) []string {
+		return r.keys(keys[i], owner(values[i]), expireOwner(values[i], expire))
+	}, func(i int) []any {
+		return r.args(keys[i], values[i], ttl)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "batch expire route table failed. keys=%d", len(keys))
 	}
 
-	return nil
+	return conditionalResults(keys, values, cmds), nil
 }
 
-// Del deletes a key from Redis.
+// Del deletes a key from Redis. With an address index, the key is also removed from the index.
 func (r *RouteTable) Del(ctx context.Context, key string) error {
+	if r.index != nil {
+		err := r.withOwner(ctx, key, func(cur string) error {
+			return delScript.Run(ctx, r.client, r.keys(key, owner(cur), ""), r.args(key)...).Err()
+		})
+		if err != nil {
+			return errors.Wrapf(err, "key=%s", key)
+		}
+
+		return nil
+	}
+
 	if err := r.client.Del(ctx, key).Err(); err != nil {
 		if errors.Is(err, redis.Nil) {
 			return nil
@@ -168,28 +624,57 @@ func (r *RouteTable) Del(ctx context.Context, key string) error {
 
 // DelIfSame deletes a key only if its current value matches the specified value.
 func (r *RouteTable) DelIfSame(ctx context.Context, key, expect string) error {
-	txf := func(tx *redis.Tx) error {
-		v, err := tx.Get(ctx, key).Result()
-		if errors.Is(err, redis.Nil) {
-			return xerrors.ErrRouteTableNotFoundFunc(key)
-		}
-
-		if err != nil {
-			return errors.Wrapf(err, "key=%s", key)
-		}
+	code, err := delIfSameScript.Run(ctx, r.client, r.keys(key, owner(expect), ""), r.args(key, expect)...).Int64()
+	if err != nil {
+		return errors.Wrapf(err, "key=%s", key)
+	}
 
-		if v != expect {
-			return xerrors.ErrRouteTableValueNotSameFunc(key, expect)
-		}
+	return conditionalResult(key, expect, code)
+}
 
-		_, err = tx.Del(ctx, key).Result()
+// BatchDelIfSame runs DelIfSame on every key with the value of the same index in one pipeline.
+func (r *RouteTable) BatchDelIfSame(ctx context.Context, keys, values []string) ([]error, error) {
+	if len(keys) != len(values) {
+		return nil, errors.Errorf("batch del got %d keys and %d values", len(keys), len(values))
+	}
 
-		return errors.Wrapf(err, "key=%s", key)
+	cmds, err := r.runScripts(ctx, delIfSameScript, len(keys), func(i int) []string {
+		return r.keys(keys[i], owner(values[i]), "")
+	}, func(i int) []any {
+		return r.args(keys[i], values[i])
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "batch del route table failed. keys=%d", len(keys))
 	}
 
-	if err := r.client.Watch(ctx, txf, key); err != nil {
-		return errors.Wrapf(err, "key=%s", key)
+	return conditionalResults(keys, values, cmds), nil
+}
+
+func conditionalResults(keys, values []string, cmds []*redis.Cmd) []error {
+	errs := make([]error, len(keys))
+
+	for i, cmd := range cmds {
+		code, err := cmd.Int64()
+		if err != nil {
+			errs[i] = errors.Wrapf(err, "key=%s", keys[i])
+			continue
+		}
+
+		errs[i] = conditionalResult(keys[i], values[i], code)
 	}
 
-	return nil
+	return errs
+}
+
+func conditionalResult(key, expect string, code int64) error {
+	switch code {
+	case scriptOK:
+		return nil
+	case scriptNotFound:
+		return xerrors.ErrRouteTableNotFoundFunc(key)
+	case scriptNotSame:
+		return xerrors.ErrRouteTableValueNotSameFunc(key, expect)
+	default:
+		return errors.Errorf("unexpected script result %d. key=%s", code, key)
+	}
 }
@@ -0,0 +1,424 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/internal/datatest"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRouteTable(t *testing.T, opts ...Option) (*RouteTable, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return New(client, opts...), mr
+}
+
+// newTestClusterRouteTable creates a route table on a cluster client of a miniredis, which serves every slot.
+func newTestClusterRouteTable(t *testing.T, opts ...Option) (*RouteTable, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return New(client, opts...), mr
+}
+
+func TestTTL(t *testing.T) {
+	t.Parallel()
+
+	t.Run("plain", func(t *testing.T) {
+		t.Parallel()
+
+		rt, _ := newTestRouteTable(t)
+		datatest.TestTTL(t, rt)
+	})
+
+	t.Run("indexed", func(t *testing.T) {
+		t.Parallel()
+
+		rt, _ := newTestRouteTable(t, WithAddrIndex(routetable.LegacyKeyCodec))
+		datatest.TestTTL(t, rt)
+	})
+}
+
+func testEntry(t *testing.T, addr string) string {
+	t.Helper()
+
+	b, err := routetable.RouteEntry{Addr: addr, Node: "node", Metadata: map[string]string{"zone": "a"}}.MarshalBinary()
+	require.NoError(t, err)
+
+	return string(b)
+}
+
+func parseEntry(t *testing.T, val string) routetable.RouteEntry {
+	t.Helper()
+
+	e, err := routetable.ParseRouteEntry(val)
+	require.NoError(t, err)
+
+	return e
+}
+
+func TestAssign(t *testing.T) {
+	t.Parallel()
+
+	const a, b = "10.0.0.1:9000", "10.0.0.2:9000"
+
+	ctx := context.Background()
+	rt, mr := newTestRouteTable(t)
+	mr.SetTime(time.UnixMicro(1700000000000000))
+
+	_, err := rt.Assign(ctx, routetable.AssignIfAddr, "k", a, testEntry(t, b), time.Minute)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	ret, err := rt.Assign(ctx, routetable.AssignIfAbsent, "k", "", testEntry(t, a), time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ret.Assigned)
+	assert.Empty(t, ret.Prev)
+
+	first := parseEntry(t, ret.Value)
+	assert.Equal(t, a, first.Addr)
+	assert.Equal(t, "node", first.Node)
+	assert.Equal(t, uint64(1700000000000001), first.Epoch)
+	assert.Equal(t, time.Minute, mr.TTL("k"))
+
+	got, err := rt.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, ret.Value, got)
+
+	ret, err = rt.Assign(ctx, routetable.AssignIfAbsent, "k", "", testEntry(t, b), time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ret.Assigned)
+	assert.Equal(t, got, ret.Value)
+
+	_, err = rt.Assign(ctx, routetable.AssignIfAddr, "k", b, testEntry(t, b), time.Minute)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableValueNotSame)
+
+	ret, err = rt.Assign(ctx, routetable.AssignIfAddr, "k", a, testEntry(t, b), 0)
+	require.NoError(t, err)
+	assert.Equal(t, got, ret.Prev)
+	assert.Equal(t, first.Epoch+1, parseEntry(t, ret.Value).Epoch)
+	assert.Zero(t, mr.TTL("k"))
+
+	// the counter survives the deletion of the key, whatever the clock
+	mr.Del("k")
+	mr.SetTime(time.UnixMicro(1600000000000000))
+
+	ret, err = rt.Assign(ctx, routetable.AssignAlways, "k", "", testEntry(t, a), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, first.Epoch+2, parseEntry(t, ret.Value).Epoch)
+	assert.Equal(t, minEpochTTL, mr.TTL(epochKey("k")))
+
+	// the counter expires long after the key, and is refreshed by every assignment
+	_, err = rt.Assign(ctx, routetable.AssignAlways, "k", "", testEntry(t, a), 10*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 100*time.Hour, mr.TTL(epochKey("k")))
+
+	mr.FastForward(100 * time.Hour)
+	assert.False(t, mr.Exists(epochKey("k")))
+
+	_, err = rt.Assign(ctx, routetable.AssignAlways, "k", "", "10.0.0.1:9000", time.Minute)
+	require.ErrorIs(t, err, routetable.ErrInvalidRouteEntry)
+}
+
+func TestAssignLegacyValue(t *testing.T) {
+	t.Parallel()
+
+	const a, b = "10.0.0.1:9000", "10.0.0.2:9000"
+
+	ctx := context.Background()
+	rt, mr := newTestRouteTable(t)
+	mr.SetTime(time.UnixMicro(1000))
+
+	// a bare address written before RouteEntry was introduced
+	require.NoError(t, mr.Set("k", a))
+
+	_, err := rt.Assign(ctx, routetable.AssignIfAddr, "k", b, testEntry(t, b), time.Minute)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableValueNotSame)
+
+	// the counter is seeded with the server time
+	ret, err := rt.Assign(ctx, routetable.AssignIfAddr, "k", a, testEntry(t, b), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, a, ret.Prev)
+	assert.Equal(t, uint64(1001), parseEntry(t, ret.Value).Epoch)
+
+	// a format that is not written
+	require.NoError(t, mr.Set("k", "\x01"+a))
+
+	_, err = rt.Assign(ctx, routetable.AssignIfAddr, "k", a, testEntry(t, b), time.Minute)
+	require.Error(t, err)
+}
+
+func TestBatchAssign(t *testing.T) {
+	t.Parallel()
+
+	const a, b = "10.0.0.1:9000", "10.0.0.2:9000"
+
+	ctx := context.Background()
+	rt, _ := newTestRouteTable(t)
+
+	_, err := rt.Assign(ctx, routetable.AssignAlways, "k2", "", testEntry(t, b), time.Minute)
+	require.NoError(t, err)
+
+	results, err := rt.BatchAssign(ctx, routetable.AssignIfAbsent, []string{"k1", "k2"}, []string{"", ""},
+		[]string{testEntry(t, a), testEntry(t, a)}, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.True(t, results[0].Assigned)
+	assert.False(t, results[1].Assigned)
+	assert.Equal(t, b, parseEntry(t, results[1].Value).Addr)
+
+	results, err = rt.BatchAssign(ctx, routetable.AssignIfAddr, []string{"k1", "k2", "k3"}, []string{a, a, a},
+		[]string{testEntry(t, b), testEntry(t, b), testEntry(t, b)}, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	assert.True(t, results[0].Assigned)
+	require.ErrorIs(t, results[1].Err, xerrors.ErrRouteTableValueNotSame)
+	require.ErrorIs(t, results[2].Err, xerrors.ErrRouteTableNotFound)
+
+	_, err = rt.BatchAssign(ctx, routetable.AssignAlways, []string{"k1"}, nil, nil, time.Minute)
+	require.Error(t, err)
+}
+
+func TestBatchSetWithTTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	for _, indexed := range []bool{false, true} {
+		var opts []Option
+		if indexed {
+			opts = append(opts, WithAddrIndex(routetable.LegacyKeyCodec))
+		}
+
+		rt, mr := newTestRouteTable(t, opts...)
+		mr.HSet("wrong", "f", "v")
+
+		errs, err := rt.BatchSetWithTTL(ctx, []string{"k1", "wrong", "k2"}, []string{"a", "b", "c"},
+			[]time.Duration{time.Minute, time.Minute, 0})
+		require.NoError(t, err)
+		require.NoError(t, errs[0])
+		require.NoError(t, errs[2])
+
+		if indexed {
+			// the script reads the old value, which fails on a key of another type
+			require.Error(t, errs[1])
+		}
+
+		val, err := mr.Get("k1")
+		require.NoError(t, err)
+		assert.Equal(t, "a", val)
+		assert.Equal(t, time.Minute, mr.TTL("k1"))
+
+		val, err = mr.Get("k2")
+		require.NoError(t, err)
+		assert.Equal(t, "c", val)
+		assert.Zero(t, mr.TTL("k2"))
+
+		_, err = rt.BatchSetWithTTL(ctx, []string{"k1"}, []string{"a"}, nil)
+		require.Error(t, err)
+	}
+}
+
+func TestBatchSetNxOrGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, mr := newTestRouteTable(t)
+
+	require.NoError(t, mr.Set("k2", "b"))
+	mr.HSet("wrong", "f", "v")
+
+	results, err := rt.BatchSetNxOrGet(ctx, []string{"k1", "k2", "wrong"}, []string{"a", "a", "a"}, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	require.NoError(t, results[0].Err)
+	assert.True(t, results[0].Set)
+	assert.Equal(t, "a", results[0].Addr)
+
+	require.NoError(t, results[1].Err)
+	assert.False(t, results[1].Set)
+	assert.Equal(t, "b", results[1].Addr)
+
+	require.Error(t, results[2].Err)
+
+	_, err = rt.BatchSetNxOrGet(ctx, []string{"k1"}, nil, time.Minute)
+	require.Error(t, err)
+}
+
+func TestBatchConditional(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		run  func(rt *RouteTable, keys, expects []string) ([]error, error)
+		// check checks k1 after the batch
+		check func(t *testing.T, mr *miniredis.Miniredis)
+	}{
+		{
+			name: "cas",
+			run: func(rt *RouteTable, keys, expects []string) ([]error, error) {
+				vals := make([]string, len(keys))
+				for i := range vals {
+					vals[i] = "b"
+				}
+
+				return rt.BatchCompareAndSwap(ctx, keys, expects, vals, time.Hour)
+			},
+			check: func(t *testing.T, mr *miniredis.Miniredis) {
+				val, err := mr.Get("k1")
+				require.NoError(t, err)
+				assert.Equal(t, "b", val)
+				assert.Equal(t, time.Hour, mr.TTL("k1"))
+			},
+		},
+		{
+			name: "expire",
+			run: func(rt *RouteTable, keys, expects []string) ([]error, error) {
+				return rt.BatchExpireIfSame(ctx, keys, expects, time.Hour)
+			},
+			check: func(t *testing.T, mr *miniredis.Miniredis) {
+				assert.Equal(t, time.Hour, mr.TTL("k1"))
+			},
+		},
+		{
+			name: "del",
+			run: func(rt *RouteTable, keys, expects []string) ([]error, error) {
+				return rt.BatchDelIfSame(ctx, keys, expects)
+			},
+			check: func(t *testing.T, mr *miniredis.Miniredis) {
+				assert.False(t, mr.Exists("k1"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rt, mr := newTestRouteTable(t)
+			require.NoError(t, mr.Set("k1", "a"))
+			require.NoError(t, mr.Set("k2", "a"))
+			mr.HSet("wrong", "f", "v")
+
+			errs, err := tt.run(rt, []string{"k1", "k2", "missing", "wrong"}, []string{"a", "x", "a", "a"})
+			require.NoError(t, err)
+			require.Len(t, errs, 4)
+			require.NoError(t, errs[0])
+			require.ErrorIs(t, errs[1], xerrors.ErrRouteTableValueNotSame)
+			require.ErrorIs(t, errs[2], xerrors.ErrRouteTableNotFound)
+			require.Error(t, errs[3])
+
+			val, err := mr.Get("k2")
+			require.NoError(t, err)
+			assert.Equal(t, "a", val)
+
+			tt.check(t, mr)
+
+			_, err = tt.run(rt, []string{"k1"}, nil)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestClusterBatchGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, mr := newTestClusterRouteTable(t)
+
+	// the keys spread over slots, some sharing one, in an order unrelated to their slots
+	keys := []string{"a", "{a}b", "b", "missing", "{a}c", "c", "a"}
+	for _, key := range keys {
+		if key != "missing" {
+			require.NoError(t, mr.Set(key, "v:"+key))
+		}
+	}
+
+	require.NotEqual(t, hashSlot("a"), hashSlot("b"))
+
+	hook := &mgetHook{}
+	rt.client.AddHook(hook)
+
+	vals, err := rt.BatchGet(ctx, keys)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v:a", "v:{a}b", "v:b", "", "v:{a}c", "v:c", "v:a"}, vals)
+
+	// one MGET per slot, which a real cluster requires
+	slots := make(map[int]bool)
+
+	for _, mget := range hook.mgets {
+		slot := hashSlot(mget[0])
+		for _, key := range mget {
+			assert.Equal(t, slot, hashSlot(key), key)
+		}
+
+		assert.False(t, slots[slot])
+		slots[slot] = true
+	}
+
+	assert.Len(t, slots, 4)
+
+	vals, err = rt.BatchGet(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, vals)
+}
+
+// mgetHook records the keys of the MGET commands of the pipelines.
+type mgetHook struct {
+	mu    sync.Mutex
+	mgets [][]string
+}
+
+func (h *mgetHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *mgetHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h *mgetHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		h.mu.Lock()
+
+		for _, cmd := range cmds {
+			if cmd.Name() != "mget" {
+				continue
+			}
+
+			keys := make([]string, 0, len(cmd.Args())-1)
+			for _, arg := range cmd.Args()[1:] {
+				keys = append(keys, arg.(string))
+			}
+
+			h.mgets = append(h.mgets, keys)
+		}
+
+		h.mu.Unlock()
+
+		return next(ctx, cmds)
+	}
+}
@@ -0,0 +1,134 @@
+package redis
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pantheon/fabrica-util/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// A cluster scan cursor holds the index of the master being scanned in its high bits
+// and the SCAN cursor of that master in the others.
+const (
+	shardCursorBits = 54
+	shardCursorMask = 1<<shardCursorBits - 1
+	maxScanShards   = 1 << (64 - shardCursorBits)
+)
+
+// BatchGetWithTTL retrieves the values and remaining time to live of keys in order with one pipeline.
+// Missing keys produce an empty string, and keys that do not expire a zero TTL.
+func (r *RouteTable) BatchGetWithTTL(ctx context.Context, keys []string) ([]string, []time.Duration, error) {
+	gets := make([]*redis.StringCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			gets[i] = pipe.Get(ctx, key)
+			ttls[i] = pipe.PTTL(ctx, key)
+		}
+
+		return nil
+	})
+	if err != nil && !isRedisError(err) {
+		return nil, nil, errors.Wrapf(err, "batch get route table with ttl failed. keys=%d", len(keys))
+	}
+
+	addrs := make([]string, len(keys))
+	durs := make([]time.Duration, len(keys))
+
+	for i, key := range keys {
+		if err := gets[i].Err(); err != nil && !errors.Is(err, redis.Nil) {
+			return nil, nil, errors.Wrapf(err, "key=%s", key)
+		}
+
+		addrs[i] = gets[i].Val()
+
+		// PTTL returns -1 for keys without expiration and -2 for missing keys
+		if d := ttls[i].Val(); d > 0 {
+			durs[i] = d
+		}
+	}
+
+	return addrs, durs, nil
+}
+
+// Scan iterates the keys matching the glob pattern match with SCAN. An empty match matches every key.
+//
+// On a Redis Cluster the masters are scanned one after the other, ordered by address,
+// and the returned cursor encodes both the master and its SCAN cursor.
+// An iteration that spans a change of the cluster topology may miss or repeat keys.
+func (r *RouteTable) Scan(ctx context.Context, match string, cursor uint64, count int64) ([]string, uint64, error) {
+	cc, ok := r.client.(*redis.ClusterClient)
+	if !ok {
+		keys, next, err := r.client.Scan(ctx, cursor, match, count).Result()
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "scan failed. match=%s cursor=%d", match, cursor)
+		}
+
+		return keys, next, nil
+	}
+
+	masters, err := clusterMasters(ctx, cc)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	shard := cursor >> shardCursorBits
+	if shard >= uint64(len(masters)) {
+		return nil, 0, errors.Errorf("invalid cluster scan cursor. cursor=%d masters=%d", cursor, len(masters))
+	}
+
+	node := masters[shard]
+
+	keys, next, err := node.Scan(ctx, cursor&shardCursorMask, match, count).Result()
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "scan failed. node=%s match=%s cursor=%d", node.Options().Addr, match, cursor)
+	}
+
+	if next > shardCursorMask {
+		return nil, 0, errors.Errorf("scan cursor overflow. node=%s cursor=%d", node.Options().Addr, next)
+	}
+
+	if next != 0 {
+		return keys, shard<<shardCursorBits | next, nil
+	}
+
+	if shard+1 < uint64(len(masters)) {
+		return keys, (shard + 1) << shardCursorBits, nil
+	}
+
+	return keys, 0, nil
+}
+
+// clusterMasters returns the clients of the masters of the cluster ordered by address.
+func clusterMasters(ctx context.Context, cc *redis.ClusterClient) ([]*redis.Client, error) {
+	var (
+		mu      sync.Mutex
+		masters []*redis.Client
+	)
+
+	err := cc.ForEachMaster(ctx, func(ctx context.Context, c *redis.Client) error {
+		mu.Lock()
+		masters = append(masters, c)
+		mu.Unlock()
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list cluster masters failed")
+	}
+
+	if len(masters) > maxScanShards {
+		return nil, errors.Errorf("too many cluster masters to scan. masters=%d", len(masters))
+	}
+
+	slices.SortFunc(masters, func(a, b *redis.Client) int {
+		return strings.Compare(a.Options().Addr, b.Options().Addr)
+	})
+
+	return masters, nil
+}
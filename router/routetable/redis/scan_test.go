@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchGetWithTTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, mr := newTestRouteTable(t)
+
+	require.NoError(t, mr.Set("expiring", "a"))
+	mr.SetTTL("expiring", time.Minute)
+	require.NoError(t, mr.Set("persistent", "b"))
+
+	vals, ttls, err := rt.BatchGetWithTTL(ctx, []string{"expiring", "missing", "persistent"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "", "b"}, vals)
+	assert.Equal(t, []time.Duration{time.Minute, 0, 0}, ttls)
+
+	mr.HSet("wrong", "f", "v")
+
+	_, _, err = rt.BatchGetWithTTL(ctx, []string{"expiring", "wrong"})
+	require.Error(t, err)
+}
+
+func TestScan(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		new  func(t *testing.T, opts ...Option) (*RouteTable, *miniredis.Miniredis)
+	}{
+		{name: "client", new: newTestRouteTable},
+		{name: "cluster", new: newTestClusterRouteTable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			rt, mr := tt.new(t)
+
+			want := make([]string, 0, 30)
+
+			for i := range 30 {
+				key := fmt.Sprintf("r:%d", i)
+				want = append(want, key)
+				require.NoError(t, mr.Set(key, "a"))
+			}
+
+			require.NoError(t, mr.Set("other", "a"))
+
+			var (
+				keys   []string
+				cursor uint64
+			)
+
+			for {
+				page, next, err := rt.Scan(ctx, "r:*", cursor, 7)
+				require.NoError(t, err)
+
+				keys = append(keys, page...)
+
+				if next == 0 {
+					break
+				}
+
+				cursor = next
+			}
+
+			assert.ElementsMatch(t, want, keys)
+		})
+	}
+}
+
+func TestClusterScanCursor(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, _ := newTestClusterRouteTable(t)
+
+	// the cursor of a master that does not exist
+	_, _, err := rt.Scan(ctx, "*", 1<<shardCursorBits, 10)
+	require.Error(t, err)
+}
@@ -0,0 +1,376 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pantheon/fabrica-util/errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// minEpochTTL is the minimum time the epoch counter of a route is kept after its last assignment.
+	minEpochTTL = 24 * time.Hour
+	// epochTTLFactor is how many times the ttl of a route its epoch counter is kept after its last assignment.
+	epochTTLFactor = 10
+)
+
+// Result codes returned by the conditional scripts.
+const (
+	scriptNotFound int64 = 0
+	scriptNotSame  int64 = -1
+	scriptOK       int64 = 1
+)
+
+// routeChanged is in the error of a script that did not write a route because the owner of the route
+// is not the one declared by the caller, which reads the route again and retries, see RouteTable.withOwner.
+const routeChanged = "ROUTECHANGED"
+
+// routeLua is the prelude of the scripts that write routes. It parses the stored values and maintains
+// the address index within the writes, see AddrIndex. The last two ARGV of these scripts are the prefix
+// of the index keys of KEYS[1] and its oid, and the prefix is empty if the route table has no index.
+// With an index, the last two KEYS are the index keys of the owners of the route before and after the write,
+// or KEYS[1] for no owner, see AddrIndex.keys.
+const routeLua = `
+local function uvarint(s, i)
+	local v, m = 0, 1
+	repeat
+		local b = string.byte(s, i)
+		if not b then
+			error('invalid route entry')
+		end
+		v, m, i = v + (b % 128) * m, m * 128, i + 1
+	until b < 128
+	return v, i
+end
+
+-- owner returns the address and epoch of a stored value, like routetable.ParseRouteEntry
+local function owner(v)
+	local f = string.byte(v, 1)
+	if f == 2 then
+		if #v < 9 then
+			error('invalid route entry')
+		end
+		local e = 0
+		for i = 2, 9 do
+			e = e * 256 + string.byte(v, i)
+		end
+		local n, i = uvarint(v, 10)
+		return string.sub(v, i, i + n - 1), e
+	end
+	if f and f < 32 then
+		error('invalid route entry')
+	end
+	return v, 0
+end
+
+-- indexed returns the address under which a value is indexed, or nil if it is not a route entry
+local function indexed(v)
+	if not v or v == '' then
+		return nil
+	end
+	local ok, addr = pcall(owner, v)
+	if ok then
+		return addr
+	end
+	return nil
+end
+
+-- indexKey escapes addr like routetable.AddrIndexKey
+local function indexKey(prefix, addr)
+	return prefix .. string.gsub(addr, '[%%:{}]', function(c)
+		return string.format('%%%02X', string.byte(c))
+	end) .. '}'
+end
+
+-- touch extends the expiration of the index key k to ttl, the ttl of a route written to it, so that the index
+-- outlives its routes. A non-positive ttl persists it, and a persistent index is only expired when it is new.
+local function touch(k, ttl, new)
+	ttl = tonumber(ttl)
+	if ttl <= 0 then
+		redis.call('PERSIST', k)
+		return
+	end
+	local cur = redis.call('PTTL', k)
+	if new or (cur >= 0 and cur < ttl) then
+		redis.call('PEXPIRE', k, ttl)
+	end
+end
+
+-- reindex moves KEYS[1] from the index of the owner of old to the index of the owner of new,
+-- either of which may be nil, and touches the index of new with ttl unless it is nil.
+-- It fails with ROUTECHANGED if the index keys are not the ones declared in KEYS,
+-- and must run before the write so that an error leaves both unchanged.
+local function reindex(old, new, ttl)
+	local prefix, oid = ARGV[#ARGV - 1], ARGV[#ARGV]
+	if prefix == '' then
+		return
+	end
+	local from, to = indexed(old), indexed(new)
+	local fromKey = from and indexKey(prefix, from) or KEYS[1]
+	local toKey = to and indexKey(prefix, to) or KEYS[1]
+	if fromKey ~= KEYS[#KEYS - 1] or toKey ~= KEYS[#KEYS] then
+		error('` + routeChanged + ` the owner of the route changed. key=' .. KEYS[1])
+	end
+	if from and from ~= to then
+		redis.call('SREM', fromKey, oid)
+	end
+	if to then
+		local added = redis.call('SADD', toKey, oid) == 1
+		if ttl then
+			touch(toKey, ttl, added and redis.call('SCARD', toKey) == 1)
+		end
+	end
+end
+
+local function set(key, val, ttl)
+	if tonumber(ttl) > 0 then
+		redis.call('SET', key, val, 'PX', ttl)
+	else
+		redis.call('SET', key, val)
+	end
+end
+`
+
+// Every compound operation is a single Lua script so that it is atomic on the server.
+// redis.Script runs them with EVALSHA and falls back to EVAL the first time a node sees them.
+// ARGV carrying a ttl is in milliseconds; a non-positive ttl means no expiration.
+var (
+	// getSetScript sets KEYS[1] to ARGV[1] with ttl ARGV[2] and returns the old value or nil.
+	getSetScript = redis.NewScript(routeLua + `
+local old = redis.call('GET', KEYS[1])
+reindex(old, ARGV[1], ARGV[2])
+set(KEYS[1], ARGV[1], ARGV[2])
+return old
+`)
+
+	// setNxOrGetScript sets KEYS[1] to ARGV[1] with ttl ARGV[2] if it does not exist.
+	// It returns {1, ARGV[1]} when set, otherwise {0, current value}.
+	setNxOrGetScript = redis.NewScript(routeLua + `
+local cur = redis.call('GET', KEYS[1])
+if cur then
+	return {0, cur}
+end
+reindex(nil, ARGV[1], ARGV[2])
+set(KEYS[1], ARGV[1], ARGV[2])
+return {1, ARGV[1]}
+`)
+
+	// compareAndSwapScript sets KEYS[1] to ARGV[2] with ttl ARGV[3] if its value equals ARGV[1].
+	compareAndSwapScript = redis.NewScript(routeLua + `
+local v = redis.call('GET', KEYS[1])
+if not v then
+	return 0
+end
+if v ~= ARGV[1] then
+	return -1
+end
+reindex(v, ARGV[2], ARGV[3])
+set(KEYS[1], ARGV[2], ARGV[3])
+return 1
+`)
+
+	// expireIfSameScript sets the ttl of KEYS[1] to ARGV[2] if its value equals ARGV[1].
+	// A non-positive ttl deletes the key, like EXPIRE does.
+	expireIfSameScript = redis.NewScript(routeLua + `
+local v = redis.call('GET', KEYS[1])
+if not v then
+	return 0
+end
+if v ~= ARGV[1] then
+	return -1
+end
+if tonumber(ARGV[2]) > 0 then
+	reindex(v, v, ARGV[2])
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+else
+	reindex(v, nil)
+	redis.call('DEL', KEYS[1])
+end
+return 1
+`)
+
+	// expireScript sets the ttl of KEYS[1] to ARGV[1] and returns 1, or 0 if it does not exist.
+	// A non-positive ttl deletes the key, like EXPIRE does.
+	expireScript = redis.NewScript(routeLua + `
+local v = redis.call('GET', KEYS[1])
+if not v then
+	return 0
+end
+if tonumber(ARGV[1]) > 0 then
+	reindex(v, v, ARGV[1])
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+else
+	reindex(v, nil)
+	redis.call('DEL', KEYS[1])
+end
+return 1
+`)
+
+	// getExScript returns the value of KEYS[1] or nil, and sets its ttl to ARGV[1].
+	// A non-positive ttl persists the key, like GETEX with PERSIST does.
+	getExScript = redis.NewScript(routeLua + `
+local v = redis.call('GET', KEYS[1])
+if not v then
+	return nil
+end
+reindex(v, v, ARGV[1])
+if tonumber(ARGV[1]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+else
+	redis.call('PERSIST', KEYS[1])
+end
+return v
+`)
+
+	// assignScript sets KEYS[1] to ARGV[3], an entry encoded by routetable.RouteEntry.MarshalBinary, with ttl ARGV[4]
+	// and a new epoch if the condition of mode ARGV[1] holds: 0 always, 1 if KEYS[1] does not exist,
+	// 2 if KEYS[1] is routed to the address ARGV[2], see routetable.AssignMode.
+	// KEYS[2] is the epoch counter of KEYS[1], seeded with the server time in microseconds and expired
+	// after ttl ARGV[5], and the new epoch is one more than the greater of the counter and the epoch of the current value.
+	// It returns {1, old value or '', new value} when assigned, {0} if KEYS[1] does not exist
+	// and {-1, current value} if the condition does not hold.
+	assignScript = redis.NewScript(routeLua + `
+local mode = tonumber(ARGV[1])
+local cur = redis.call('GET', KEYS[1])
+local prev = 0
+if cur then
+	if mode == 1 then
+		return {-1, cur}
+	end
+	local addr, e = owner(cur)
+	if mode == 2 and addr ~= ARGV[2] then
+		return {-1, cur}
+	end
+	prev = e
+elseif mode == 2 then
+	return {0}
+end
+
+local last = tonumber(redis.call('GET', KEYS[2]))
+if not last then
+	local t = redis.call('TIME')
+	last = tonumber(t[1]) * 1000000 + tonumber(t[2])
+end
+local epoch = math.max(last, prev) + 1
+
+local b = {}
+local n = epoch
+for i = 8, 1, -1 do
+	b[i] = n % 256
+	n = math.floor(n / 256)
+end
+local val = string.char(2, unpack(b)) .. string.sub(ARGV[3], 10)
+reindex(cur, val, ARGV[4])
+redis.call('SET', KEYS[2], string.format('%.0f', epoch), 'PX', ARGV[5])
+set(KEYS[1], val, ARGV[4])
+return {1, cur or '', val}
+`)
+
+	// delScript deletes KEYS[1] and returns the number of deleted keys, like DEL.
+	delScript = redis.NewScript(routeLua + `
+local v = redis.call('GET', KEYS[1])
+if not v then
+	return 0
+end
+reindex(v, nil)
+return redis.call('DEL', KEYS[1])
+`)
+
+	// delIfSameScript deletes KEYS[1] if its value equals ARGV[1].
+	delIfSameScript = redis.NewScript(routeLua + `
+local v = redis.call('GET', KEYS[1])
+if not v then
+	return 0
+end
+if v ~= ARGV[1] then
+	return -1
+end
+reindex(v, nil)
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+	// pruneScript removes the oid ARGV[i] from the address index KEYS[1] of the address ARGV[1]
+	// if its route KEYS[i] does not exist or is routed to another address. It returns the number of removed oids.
+	pruneScript = redis.NewScript(routeLua + `
+local n = 0
+for i = 2, #KEYS do
+	if indexed(redis.call('GET', KEYS[i])) ~= ARGV[1] then
+		n = n + redis.call('SREM', KEYS[1], ARGV[i])
+	end
+end
+return n
+`)
+)
+
+// epochTTLArg returns the millisecond ttl of the epoch counter of a route assigned with expire, see Assign.
+func epochTTLArg(expire time.Duration) int64 {
+	return ttlArg(max(epochTTLFactor*expire, minEpochTTL))
+}
+
+// ttlArg converts a duration to the millisecond argument of the scripts.
+// Positive durations below one millisecond are rounded up so that they still expire.
+func ttlArg(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	if ms := ttl.Milliseconds(); ms > 0 {
+		return ms
+	}
+
+	return 1
+}
+
+// runScripts runs script n times in one pipeline, with the keys and arguments returned by keys and args.
+// The script is loaded and the pipeline retried once if a node does not know it yet.
+// The returned error is only set if the pipeline failed as a whole; script errors are left in the commands.
+func (r *RouteTable) runScripts(ctx context.Context, script *redis.Script, n int, keys func(i int) []string, args func(i int) []any) ([]*redis.Cmd, error) {
+	cmds, err := r.pipeScripts(ctx, script, n, keys, args)
+	if err != nil || !hasNoScript(cmds) {
+		return cmds, err
+	}
+
+	if err := script.Load(ctx, r.client).Err(); err != nil {
+		return nil, errors.Wrap(err, "load script failed")
+	}
+
+	return r.pipeScripts(ctx, script, n, keys, args)
+}
+
+func (r *RouteTable) pipeScripts(ctx context.Context, script *redis.Script, n int, keys func(i int) []string, args func(i int) []any) ([]*redis.Cmd, error) {
+	cmds := make([]*redis.Cmd, n)
+
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := range n {
+			cmds[i] = script.EvalSha(ctx, pipe, keys(i), args(i)...)
+		}
+
+		return nil
+	})
+
+	if err != nil && !isRedisError(err) {
+		return nil, err
+	}
+
+	return cmds, nil
+}
+
+// isRedisError reports whether err is an error reply of a command rather than a failure of the connection.
+func isRedisError(err error) bool {
+	var rerr redis.Error
+
+	return errors.As(err, &rerr)
+}
+
+func hasNoScript(cmds []*redis.Cmd) bool {
+	for _, cmd := range cmds {
+		if redis.HasErrorPrefix(cmd.Err(), "NOSCRIPT") {
+			return true
+		}
+	}
+
+	return false
+}
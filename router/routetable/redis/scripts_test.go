@@ -0,0 +1,158 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, mr := newTestRouteTable(t)
+
+	old, err := rt.GetSet(ctx, "k", "a", time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, old)
+
+	old, err = rt.GetSet(ctx, "k", "b", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "a", old)
+
+	val, err := mr.Get("k")
+	require.NoError(t, err)
+	assert.Equal(t, "b", val)
+	assert.Zero(t, mr.TTL("k"))
+}
+
+func TestSetNxOrGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, mr := newTestRouteTable(t)
+
+	set, cur, err := rt.SetNxOrGet(ctx, "k", "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, set)
+	assert.Equal(t, "a", cur)
+	assert.Equal(t, time.Minute, mr.TTL("k"))
+
+	set, cur, err = rt.SetNxOrGet(ctx, "k", "b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, set)
+	assert.Equal(t, "a", cur)
+
+	// an expired key does not exist
+	mr.FastForward(time.Minute)
+
+	set, cur, err = rt.SetNxOrGet(ctx, "k", "b", 0)
+	require.NoError(t, err)
+	assert.True(t, set)
+	assert.Equal(t, "b", cur)
+}
+
+func TestConditionalScripts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		run  func(rt *RouteTable, key, expect string) error
+		// want is the value of the key after a successful run, or empty if it is deleted
+		want string
+	}{
+		{
+			name: "cas",
+			run: func(rt *RouteTable, key, expect string) error {
+				return rt.CompareAndSwap(ctx, key, expect, "b", time.Hour)
+			},
+			want: "b",
+		},
+		{
+			name: "expire",
+			run: func(rt *RouteTable, key, expect string) error {
+				return rt.ExpireIfSame(ctx, key, expect, time.Hour)
+			},
+			want: "a",
+		},
+		{
+			name: "expire_delete",
+			run: func(rt *RouteTable, key, expect string) error {
+				return rt.ExpireIfSame(ctx, key, expect, 0)
+			},
+		},
+		{
+			name: "del",
+			run: func(rt *RouteTable, key, expect string) error {
+				return rt.DelIfSame(ctx, key, expect)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rt, mr := newTestRouteTable(t)
+			require.NoError(t, mr.Set("k", "a"))
+			mr.SetTTL("k", time.Minute)
+
+			require.ErrorIs(t, tt.run(rt, "missing", "a"), xerrors.ErrRouteTableNotFound)
+			require.ErrorIs(t, tt.run(rt, "k", "x"), xerrors.ErrRouteTableValueNotSame)
+
+			val, err := mr.Get("k")
+			require.NoError(t, err)
+			assert.Equal(t, "a", val)
+			assert.Equal(t, time.Minute, mr.TTL("k"))
+
+			require.NoError(t, tt.run(rt, "k", "a"))
+
+			if tt.want == "" {
+				assert.False(t, mr.Exists("k"))
+				return
+			}
+
+			val, err = mr.Get("k")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, val)
+			assert.Equal(t, time.Hour, mr.TTL("k"))
+		})
+	}
+}
+
+func TestScriptReload(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, mr := newTestRouteTable(t)
+
+	require.NoError(t, rt.Set(ctx, "k1", "a", time.Minute))
+	require.NoError(t, rt.Set(ctx, "k2", "a", time.Minute))
+	require.NoError(t, rt.CompareAndSwap(ctx, "k1", "a", "b", time.Minute))
+
+	// a restarted or failed over node has lost the scripts
+	require.NoError(t, rt.client.ScriptFlush(ctx).Err())
+
+	require.NoError(t, rt.CompareAndSwap(ctx, "k1", "b", "c", time.Minute))
+
+	require.NoError(t, rt.client.ScriptFlush(ctx).Err())
+
+	errs, err := rt.BatchCompareAndSwap(ctx, []string{"k1", "k2"}, []string{"c", "x"}, []string{"d", "d"}, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, errs[0])
+	require.ErrorIs(t, errs[1], xerrors.ErrRouteTableValueNotSame)
+
+	loaded, err := rt.client.ScriptExists(ctx, compareAndSwapScript.Hash()).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true}, loaded)
+
+	val, err := mr.Get("k1")
+	require.NoError(t, err)
+	assert.Equal(t, "d", val)
+}
@@ -0,0 +1,52 @@
+package redis
+
+import "strings"
+
+// slotCount is the number of hash slots of a Redis Cluster.
+const slotCount = 16384
+
+// hashSlot returns the Redis Cluster hash slot of key.
+func hashSlot(key string) int {
+	return int(crc16(hashTag(key)) % slotCount)
+}
+
+// hashTag returns the part of key that is hashed. Like Redis, it is the content
+// of the first non-empty {...} tag if present, otherwise the whole key.
+func hashTag(key string) string {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			return key[s+1 : s+1+e]
+		}
+	}
+
+	return key
+}
+
+// epochKey returns the key of the epoch counter of key. It is in the hash slot of key,
+// and its prefix keeps it out of the patterns of the route tables.
+func epochKey(key string) string {
+	if hashTag(key) != key {
+		return "epoch:" + key
+	}
+
+	return "epoch:{" + key + "}"
+}
+
+// crc16 implements the CRC16-XMODEM checksum used by Redis Cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
@@ -0,0 +1,49 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCRC16(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, uint16(0x31C3), crc16("123456789"))
+}
+
+func TestHashSlot(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{key: "foo", want: 12182},
+		{key: "hello", want: 866},
+		{key: "{foo}.bar", want: 12182},
+		{key: "x{foo}{hello}", want: 12182},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, hashSlot(tt.key))
+		})
+	}
+
+	// an empty or unterminated tag hashes the whole key
+	assert.Equal(t, int(crc16("{}foo")%slotCount), hashSlot("{}foo"))
+	assert.Equal(t, int(crc16("foo{")%slotCount), hashSlot("foo{"))
+	assert.Equal(t, hashSlot("r_player_blue_{1}"), hashSlot("r_room_red_{1}"))
+}
+
+func TestEpochKey(t *testing.T) {
+	t.Parallel()
+
+	for _, key := range []string{"r_player_{blue}_{1}", "r1:player:blue:{1}", "probe"} {
+		assert.Equal(t, hashSlot(key), hashSlot(epochKey(key)), key)
+		assert.NotEqual(t, key, epochKey(key))
+	}
+}
@@ -0,0 +1,309 @@
+package redis
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"github.com/go-pantheon/fabrica-util/xsync"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	watchBufferSize = 1024
+	// watchLastSize bounds the number of last seen values kept by a watch.
+	watchLastSize = 1 << 16
+
+	// keyspaceEventFlags are the notify-keyspace-events flags required by Watch:
+	// keyspace channel, string commands, generic commands and expired events.
+	keyspaceEventFlags = "K$gx"
+)
+
+var _ routetable.Watcher = (*RouteTable)(nil)
+
+// Watch streams the changes of the keys matching the glob pattern until ctx is done.
+//
+// It relies on keyspace notifications, which must be enabled with at least the "K$gx" flags,
+// for example with EnableKeyspaceNotifications. On a Redis Cluster every master at the time of
+// the call is subscribed. Notifications carry no values, so the new value is read after a set,
+// and the old value is the last one seen by this watch, which is empty for a key not seen before.
+// The value read can be newer than the notification: of several quick sets of a key, the first
+// can report the last value and the others are skipped as they do not change it.
+// Only the values of the last 65536 keys seen are kept, so the old value of a key changed
+// after a burst of changes of other keys can be empty.
+func (r *RouteTable) Watch(ctx context.Context, pattern string) (<-chan routetable.DataEvent, error) {
+	subs, err := r.psubscribe(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make(chan *redis.Message, watchBufferSize)
+
+	var wg sync.WaitGroup
+
+	for _, ps := range subs {
+		wg.Add(1)
+
+		xsync.Go("routetable.redis.watch.receive", func() error {
+			defer wg.Done()
+			defer ps.Close()
+
+			ch := ps.Channel()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case msg, ok := <-ch:
+					if !ok {
+						return nil
+					}
+
+					select {
+					case msgs <- msg:
+					case <-ctx.Done():
+						return nil
+					}
+				}
+			}
+		})
+	}
+
+	xsync.Go("routetable.redis.watch.close", func() error {
+		wg.Wait()
+		close(msgs)
+
+		return nil
+	})
+
+	out := make(chan routetable.DataEvent, watchBufferSize)
+	prefix := r.keyspacePrefix()
+
+	last := newLastValues(watchLastSize)
+	if key, ok := literalPattern(pattern); ok {
+		if v, err := r.client.Get(ctx, key).Result(); err == nil {
+			last.set(key, v)
+		}
+	}
+
+	xsync.Go("routetable.redis.watch", func() error {
+		defer close(out)
+
+		for msg := range msgs {
+			key := strings.TrimPrefix(msg.Channel, prefix)
+
+			ev, ok := r.toEvent(ctx, key, msg.Payload, last)
+			if !ok {
+				continue
+			}
+
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		return nil
+	})
+
+	return out, nil
+}
+
+// toEvent converts a keyspace notification to a DataEvent and updates the last seen values.
+// The value of a set is read when the notification is handled, so it is the current value of the key
+// rather than the value of the notification. Notifications that do not change the value are skipped.
+func (r *RouteTable) toEvent(ctx context.Context, key, event string, last *lastValues) (routetable.DataEvent, bool) {
+	old := last.get(key)
+
+	switch event {
+	case "set":
+		v, err := r.client.Get(ctx, key).Result()
+		if err != nil || v == old {
+			return routetable.DataEvent{}, false
+		}
+
+		last.set(key, v)
+
+		return routetable.DataEvent{Key: key, Old: old, New: v, Reason: routetable.EventSet}, true
+	case "del":
+		last.del(key)
+		return routetable.DataEvent{Key: key, Old: old, Reason: routetable.EventDeleted}, true
+	case "expired":
+		last.del(key)
+		return routetable.DataEvent{Key: key, Old: old, Reason: routetable.EventExpired}, true
+	default:
+		return routetable.DataEvent{}, false
+	}
+}
+
+type lastValue struct {
+	key, val string
+}
+
+// lastValues is a size-bounded LRU of the last values seen by a watch.
+// It is only used by the goroutine of the watch.
+type lastValues struct {
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newLastValues(size int) *lastValues {
+	return &lastValues{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (l *lastValues) get(key string) string {
+	e, ok := l.items[key]
+	if !ok {
+		return ""
+	}
+
+	l.ll.MoveToFront(e)
+
+	return e.Value.(*lastValue).val
+}
+
+func (l *lastValues) set(key, val string) {
+	if e, ok := l.items[key]; ok {
+		e.Value.(*lastValue).val = val
+		l.ll.MoveToFront(e)
+
+		return
+	}
+
+	l.items[key] = l.ll.PushFront(&lastValue{key: key, val: val})
+
+	if l.ll.Len() > l.size {
+		l.del(l.ll.Back().Value.(*lastValue).key)
+	}
+}
+
+func (l *lastValues) del(key string) {
+	if e, ok := l.items[key]; ok {
+		l.ll.Remove(e)
+		delete(l.items, key)
+	}
+}
+
+// psubscribe subscribes to the keyspace notifications of pattern on every node holding keys.
+func (r *RouteTable) psubscribe(ctx context.Context, pattern string) ([]*redis.PubSub, error) {
+	channel := r.keyspacePrefix() + pattern
+
+	cc, ok := r.client.(*redis.ClusterClient)
+	if !ok {
+		ps := r.client.PSubscribe(ctx, channel)
+		if _, err := ps.Receive(ctx); err != nil {
+			_ = ps.Close()
+			return nil, errors.Wrapf(err, "psubscribe failed. channel=%s", channel)
+		}
+
+		return []*redis.PubSub{ps}, nil
+	}
+
+	var (
+		mu   sync.Mutex
+		subs []*redis.PubSub
+	)
+
+	err := cc.ForEachMaster(ctx, func(ctx context.Context, c *redis.Client) error {
+		ps := c.PSubscribe(ctx, channel)
+		if _, err := ps.Receive(ctx); err != nil {
+			_ = ps.Close()
+			return errors.Wrapf(err, "psubscribe failed. node=%s channel=%s", c.Options().Addr, channel)
+		}
+
+		mu.Lock()
+		subs = append(subs, ps)
+		mu.Unlock()
+
+		return nil
+	})
+	if err != nil {
+		for _, ps := range subs {
+			_ = ps.Close()
+		}
+
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+func (r *RouteTable) keyspacePrefix() string {
+	db := 0
+	if c, ok := r.client.(*redis.Client); ok {
+		db = c.Options().DB
+	}
+
+	return fmt.Sprintf("__keyspace@%d__:", db)
+}
+
+// literalPattern returns the key matched by pattern if it has no unescaped glob metacharacters.
+func literalPattern(pattern string) (string, bool) {
+	var b strings.Builder
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*', '?', '[':
+			return "", false
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteByte(pattern[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String(), true
+}
+
+// EnableKeyspaceNotifications adds the notify-keyspace-events flags required by Watch
+// to the configuration of every master, keeping the flags already set.
+func EnableKeyspaceNotifications(ctx context.Context, client redis.UniversalClient) error {
+	if cc, ok := client.(*redis.ClusterClient); ok {
+		return cc.ForEachMaster(ctx, func(ctx context.Context, c *redis.Client) error {
+			return enableKeyspaceNotifications(ctx, c)
+		})
+	}
+
+	return enableKeyspaceNotifications(ctx, client)
+}
+
+func enableKeyspaceNotifications(ctx context.Context, c redis.Cmdable) error {
+	cfg, err := c.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return errors.Wrap(err, "get notify-keyspace-events failed")
+	}
+
+	flags := cfg["notify-keyspace-events"]
+
+	for _, f := range keyspaceEventFlags {
+		if strings.ContainsRune(flags, f) {
+			continue
+		}
+
+		// A is an alias of every class flag, which include $, g and x
+		if f != 'K' && strings.ContainsRune(flags, 'A') {
+			continue
+		}
+
+		flags += string(f)
+	}
+
+	if err := c.ConfigSet(ctx, "notify-keyspace-events", flags).Err(); err != nil {
+		return errors.Wrapf(err, "set notify-keyspace-events failed. flags=%s", flags)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToEvent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, mr := newTestRouteTable(t)
+	last := newLastValues(2)
+
+	// the value is read when the notification is handled, so the first of two sets reports the second value
+	require.NoError(t, mr.Set("k", "a"))
+	require.NoError(t, mr.Set("k", "b"))
+
+	ev, ok := rt.toEvent(ctx, "k", "set", last)
+	require.True(t, ok)
+	assert.Equal(t, routetable.DataEvent{Key: "k", New: "b", Reason: routetable.EventSet}, ev)
+
+	_, ok = rt.toEvent(ctx, "k", "set", last)
+	assert.False(t, ok)
+
+	ev, ok = rt.toEvent(ctx, "k", "expired", last)
+	require.True(t, ok)
+	assert.Equal(t, routetable.DataEvent{Key: "k", Old: "b", Reason: routetable.EventExpired}, ev)
+	assert.Empty(t, last.items)
+
+	_, ok = rt.toEvent(ctx, "k", "expire", last)
+	assert.False(t, ok)
+}
+
+func TestLastValues(t *testing.T) {
+	t.Parallel()
+
+	last := newLastValues(2)
+	last.set("a", "1")
+	last.set("b", "2")
+	assert.Equal(t, "1", last.get("a"))
+
+	// b is the least recently used
+	last.set("c", "3")
+	assert.Equal(t, "", last.get("b"))
+	assert.Equal(t, "1", last.get("a"))
+	assert.Equal(t, "3", last.get("c"))
+
+	last.del("a")
+	assert.Len(t, last.items, 1)
+	assert.Equal(t, 1, last.ll.Len())
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		new  func(t *testing.T, opts ...Option) (*RouteTable, *miniredis.Miniredis)
+	}{
+		{name: "client", new: newTestRouteTable},
+		{name: "cluster", new: newTestClusterRouteTable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			rt, mr := tt.new(t)
+			require.NoError(t, mr.Set("r:1", "a"))
+
+			events, err := rt.Watch(ctx, "r:*")
+			require.NoError(t, err)
+
+			receive := func() routetable.DataEvent {
+				t.Helper()
+
+				select {
+				case ev := <-events:
+					return ev
+				case <-time.After(time.Second):
+					require.FailNow(t, "no event")
+					return routetable.DataEvent{}
+				}
+			}
+
+			// miniredis does not send keyspace notifications, so they are published like Redis does
+			notify := func(key, event string) {
+				mr.Publish(rt.keyspacePrefix()+key, event)
+			}
+
+			// the old value of a key matched by a pattern is unknown until it is seen
+			require.NoError(t, mr.Set("r:1", "b"))
+			notify("r:1", "set")
+			assert.Equal(t, routetable.DataEvent{Key: "r:1", New: "b", Reason: routetable.EventSet}, receive())
+
+			notify("other", "set")
+
+			require.NoError(t, mr.Set("r:1", "c"))
+			notify("r:1", "set")
+			assert.Equal(t, routetable.DataEvent{Key: "r:1", Old: "b", New: "c", Reason: routetable.EventSet}, receive())
+
+			mr.Del("r:1")
+			notify("r:1", "del")
+			assert.Equal(t, routetable.DataEvent{Key: "r:1", Old: "c", Reason: routetable.EventDeleted}, receive())
+
+			// the stream is closed once ctx is done
+			cancel()
+
+			for range events {
+			}
+		})
+	}
+}
+
+func TestWatchLiteral(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rt, mr := newTestRouteTable(t)
+	require.NoError(t, mr.Set("r:1", "a"))
+
+	events, err := rt.Watch(ctx, "r:1")
+	require.NoError(t, err)
+
+	// the current value of a literal key is the old value of its first event
+	require.NoError(t, mr.Set("r:1", "b"))
+	mr.Publish(rt.keyspacePrefix()+"r:1", "set")
+
+	select {
+	case ev := <-events:
+		assert.Equal(t, routetable.DataEvent{Key: "r:1", Old: "a", New: "b", Reason: routetable.EventSet}, ev)
+	case <-time.After(time.Second):
+		require.FailNow(t, "no event")
+	}
+}
@@ -7,25 +7,6 @@ import (
 	"github.com/go-pantheon/fabrica-util/errors"
 )
 
-const (
-	defaultTTL = time.Hour * 24
-)
-
-// Option is a function type that configures a BaseRouteTable instance.
-type Option func(*renewalRouteTable)
-
-// WithTTL returns an Option that sets the time-to-live for route table entries.
-// dur must be greater than 0, otherwise the default TTL will be used.
-func WithTTL(dur time.Duration) Option {
-	return func(r *renewalRouteTable) {
-		if dur <= 0 {
-			dur = defaultTTL
-		}
-
-		r.ttl = dur
-	}
-}
-
 var _ ReNewalRouteTable = (*renewalRouteTable)(nil)
 
 // renewalRouteTable is a basic implementation of the ReNewalRouteTable interface.
@@ -40,13 +21,14 @@ type renewalRouteTable struct {
 // NewRenewalRouteTable creates a new renewalRouteTable with the given data store,
 // name, key generation function, and optional configuration options.
 func NewRenewalRouteTable(rtd Data, name string, opts ...Option) *renewalRouteTable {
+	return newRenewalRouteTable(rtd, name, newOptions(opts...))
+}
+
+func newRenewalRouteTable(rtd Data, name string, o *options) *renewalRouteTable {
 	rt := &renewalRouteTable{
-		ReadOnlyRouteTable: NewReadOnlyRouteTable(rtd, name),
+		ReadOnlyRouteTable: newReadOnlyRouteTable(rtd, name, o),
 		data:               rtd,
-		ttl:                defaultTTL,
-	}
-	for _, opt := range opts {
-		opt(rt)
+		ttl:                o.ttl,
 	}
 
 	return rt
@@ -56,11 +38,50 @@ func (r *renewalRouteTable) TTL() time.Duration {
 	return r.ttl
 }
 
-// RenewSelf expires a routing entry only if its current value matches the specified value.
-func (r *renewalRouteTable) RenewSelf(ctx context.Context, color string, uid int64, value string) error {
-	if err := r.data.ExpireIfSame(ctx, r.BuildKey(color, uid), value, r.ttl); err != nil {
+// RenewSelf extends the expiration of a routing entry only if it is still owned by value with epoch.
+func (r *renewalRouteTable) RenewSelf(ctx context.Context, color string, uid int64, value string, epoch uint64) error {
+	key := r.BuildKey(color, uid)
+
+	val, err := ownedValue(ctx, r.data, key, value, epoch)
+	if err != nil {
+		return errors.WithMessage(err, "renewIfSame route table failed")
+	}
+
+	if err := r.data.ExpireIfSame(ctx, key, val, r.ttl); err != nil {
 		return errors.WithMessage(err, "renewIfSame route table failed")
 	}
 
 	return nil
 }
+
+// BatchRenewSelf renews the routing entries of oids that are still owned by value with the epoch
+// of the same index in one batch.
+// errs holds the result of each oid, and err is only returned if the batch could not run.
+func (r *renewalRouteTable) BatchRenewSelf(ctx context.Context, color string, oids []int64, value string, epochs []uint64) ([]error, error) {
+	keys, vals, errs, err := ownedValues(ctx, r, r.data, color, oids, value, epochs)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "batch renew route table failed. color=%s", color)
+	}
+
+	errs, err = batchIfOwned(keys, vals, errs, func(keys, vals []string) ([]error, error) {
+		return r.data.BatchExpireIfSame(ctx, keys, vals, r.ttl)
+	})
+	if err != nil {
+		return nil, errors.WithMessagef(err, "batch renew route table failed. color=%s", color)
+	}
+
+	return errs, nil
+}
+
+// buildKeys returns the keys of oids and a slice of the same length filled with value.
+func buildKeys(rt ReadOnlyRouteTable, color string, oids []int64, value string) (keys, values []string) {
+	keys = make([]string, len(oids))
+	values = make([]string, len(oids))
+
+	for i, oid := range oids {
+		keys[i] = rt.BuildKey(color, oid)
+		values[i] = value
+	}
+
+	return keys, values
+}
@@ -0,0 +1,259 @@
+package routetable
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"github.com/go-pantheon/fabrica-util/xsync"
+)
+
+const (
+	defaultRenewBatchSize = 500
+	// defaultRenewDivisor renews routes three times per TTL, so that two rounds can fail before they expire.
+	defaultRenewDivisor = 3
+	minRenewInterval    = time.Second
+)
+
+// RenewerOption is a function type that configures a Renewer instance.
+type RenewerOption func(*renewerOptions)
+
+type renewerOptions struct {
+	interval  time.Duration
+	batchSize int
+	onLost    func(color string, oid int64, err error)
+}
+
+// WithRenewInterval returns a RenewerOption that sets how often the tracked routes are renewed.
+// dur must be greater than 0, otherwise a third of the route table TTL will be used.
+func WithRenewInterval(dur time.Duration) RenewerOption {
+	return func(o *renewerOptions) {
+		o.interval = dur
+	}
+}
+
+// WithRenewBatchSize returns a RenewerOption that sets the maximum number of routes renewed in one batch.
+// size must be greater than 0, otherwise the default size will be used.
+func WithRenewBatchSize(size int) RenewerOption {
+	return func(o *renewerOptions) {
+		if size <= 0 {
+			size = defaultRenewBatchSize
+		}
+
+		o.batchSize = size
+	}
+}
+
+// WithOnLost returns a RenewerOption that sets the callback of routes that are no longer owned.
+// err wraps xerrors.ErrRouteTableNotFound or xerrors.ErrRouteTableValueNotSame.
+// The callback is called from the renewal goroutine and should not block.
+func WithOnLost(fn func(color string, oid int64, err error)) RenewerOption {
+	return func(o *renewerOptions) {
+		o.onLost = fn
+	}
+}
+
+type ownedRoute struct {
+	color string
+	oid   int64
+}
+
+// Renewer keeps the leases of the routes owned by one address alive.
+// It renews the tracked routes in batches at a fraction of the route table TTL,
+// and stops tracking the routes that have expired or been taken over by another address.
+type Renewer struct {
+	rt        ReNewalRouteTable
+	addr      string
+	interval  time.Duration
+	batchSize int
+	onLost    func(color string, oid int64, err error)
+
+	mu     sync.Mutex
+	routes map[ownedRoute]uint64 // epoch by route
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRenewer creates a Renewer of the routes owned by addr in rt and starts its renewal loop.
+// Close must be called to stop it.
+func NewRenewer(rt ReNewalRouteTable, addr string, opts ...RenewerOption) *Renewer {
+	o := &renewerOptions{
+		batchSize: defaultRenewBatchSize,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.interval <= 0 {
+		o.interval = max(rt.TTL()/defaultRenewDivisor, minRenewInterval)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &Renewer{
+		rt:        rt,
+		addr:      addr,
+		interval:  o.interval,
+		batchSize: o.batchSize,
+		onLost:    o.onLost,
+		routes:    make(map[ownedRoute]uint64),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+
+	xsync.Go("routetable.renewer", func() error {
+		defer close(r.done)
+
+		r.loop(ctx)
+
+		return nil
+	})
+
+	return r
+}
+
+// Add starts tracking the route of (color, oid) owned with epoch, or updates its epoch if it is already tracked.
+func (r *Renewer) Add(color string, oid int64, epoch uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.routes[ownedRoute{color: color, oid: oid}] = epoch
+}
+
+// Remove stops tracking the route of (color, oid). The route itself is left unchanged.
+func (r *Renewer) Remove(color string, oid int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.routes, ownedRoute{color: color, oid: oid})
+}
+
+// Len returns the number of tracked routes.
+func (r *Renewer) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.routes)
+}
+
+// Close stops the renewal loop and waits for the running round to finish.
+// It is safe to call Close more than once.
+func (r *Renewer) Close() error {
+	r.cancel()
+	<-r.done
+
+	return nil
+}
+
+func (r *Renewer) loop(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rctx, cancel := context.WithTimeout(ctx, r.interval)
+
+			if err := r.Renew(rctx); err != nil && ctx.Err() == nil {
+				log.Warnf("renew route table failed. addr=%s err=%+v", r.addr, err)
+			}
+
+			cancel()
+		}
+	}
+}
+
+// Renew renews every tracked route once. Routes that are no longer owned are untracked
+// and reported to the OnLost callback. Routes that failed for other reasons are kept
+// to be retried in the next round, and their errors are joined in the returned error.
+func (r *Renewer) Renew(ctx context.Context) error {
+	var errs []error
+
+	for color, routes := range r.snapshot() {
+		for start := 0; start < len(routes.oids); start += r.batchSize {
+			end := min(start+r.batchSize, len(routes.oids))
+
+			if err := r.renewBatch(ctx, color, routes.oids[start:end], routes.epochs[start:end]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *Renewer) renewBatch(ctx context.Context, color string, oids []int64, epochs []uint64) error {
+	results, err := r.rt.BatchRenewSelf(ctx, color, oids, r.addr, epochs)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for i, err := range results {
+		if err == nil {
+			continue
+		}
+
+		if errors.Is(err, xerrors.ErrRouteTableNotFound) || errors.Is(err, xerrors.ErrRouteTableValueNotSame) {
+			r.lose(color, oids[i], epochs[i], err)
+			continue
+		}
+
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// lose untracks a route that is no longer owned, unless it has been added again with another epoch since the snapshot.
+func (r *Renewer) lose(color string, oid int64, epoch uint64, err error) {
+	route := ownedRoute{color: color, oid: oid}
+
+	r.mu.Lock()
+	cur, tracked := r.routes[route]
+	tracked = tracked && cur == epoch
+
+	if tracked {
+		delete(r.routes, route)
+	}
+
+	r.mu.Unlock()
+
+	if tracked && r.onLost != nil {
+		r.onLost(color, oid, err)
+	}
+}
+
+type ownedRoutes struct {
+	oids   []int64
+	epochs []uint64
+}
+
+// snapshot returns the tracked routes grouped by color.
+func (r *Renewer) snapshot() map[string]*ownedRoutes {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byColor := make(map[string]*ownedRoutes)
+
+	for route, epoch := range r.routes {
+		routes, ok := byColor[route.color]
+		if !ok {
+			routes = &ownedRoutes{}
+			byColor[route.color] = routes
+		}
+
+		routes.oids = append(routes.oids, route.oid)
+		routes.epochs = append(routes.epochs, epoch)
+	}
+
+	return byColor
+}
@@ -0,0 +1,89 @@
+package routetable_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenewer(t *testing.T) {
+	t.Parallel()
+
+	const self, other = "10.0.0.1:9000", "10.0.0.2:9000"
+
+	ctx := context.Background()
+	rt, clock := newTestMasterRouteTable(t, routetable.WithTTL(time.Minute))
+
+	epochs := make(map[int64]uint64)
+
+	for oid, addr := range map[int64]string{1: self, 2: self, 3: other} {
+		_, epoch, err := rt.GetSet(ctx, testColor, oid, addr)
+		require.NoError(t, err)
+
+		epochs[oid] = epoch
+	}
+
+	var (
+		mu   sync.Mutex
+		lost = make(map[int64]error)
+	)
+
+	renewer := routetable.NewRenewer(rt, self,
+		routetable.WithRenewInterval(time.Hour),
+		routetable.WithRenewBatchSize(2),
+		routetable.WithOnLost(func(color string, oid int64, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			assert.Equal(t, testColor, color)
+			lost[oid] = err
+		}),
+	)
+	t.Cleanup(func() {
+		_ = renewer.Close()
+	})
+
+	for oid := int64(1); oid <= 4; oid++ {
+		renewer.Add(testColor, oid, epochs[oid])
+	}
+
+	clock.Advance(time.Second * 50)
+	require.NoError(t, renewer.Renew(ctx))
+	clock.Advance(time.Second * 50)
+
+	for _, oid := range []int64{1, 2} {
+		addr, err := rt.Get(ctx, testColor, oid)
+		require.NoError(t, err)
+		assert.Equal(t, self, addr)
+	}
+
+	_, err := rt.Get(ctx, testColor, 3)
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	assert.Equal(t, 2, renewer.Len())
+	require.Len(t, lost, 2)
+	require.ErrorIs(t, lost[3], xerrors.ErrRouteTableValueNotSame)
+	require.ErrorIs(t, lost[4], xerrors.ErrRouteTableNotFound)
+
+	renewer.Remove(testColor, 1)
+	assert.Equal(t, 1, renewer.Len())
+}
+
+func TestRenewerClose(t *testing.T) {
+	t.Parallel()
+
+	rt, _ := newTestMasterRouteTable(t)
+	renewer := routetable.NewRenewer(rt, "10.0.0.1:9000", routetable.WithRenewInterval(time.Millisecond))
+
+	renewer.Add(testColor, 1, 1)
+	time.Sleep(time.Millisecond * 10)
+
+	require.NoError(t, renewer.Close())
+	require.NoError(t, renewer.Close())
+}
@@ -4,11 +4,12 @@ package routetable
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/go-pantheon/fabrica-util/errors"
 )
 
 type RouteTable interface {
@@ -22,60 +23,167 @@ type MasterRouteTable interface {
 
 	GetEx(ctx context.Context, color string, oid int64) (addr string, err error)
 	Set(ctx context.Context, color string, key int64, addr string) error
-	GetSet(ctx context.Context, color string, key int64, addr string) (old string, err error)
-	SetNxOrGet(ctx context.Context, color string, key int64, addr string) (ok bool, result string, err error)
+	GetSet(ctx context.Context, color string, key int64, addr string) (old string, epoch uint64, err error)
+	SetNxOrGet(ctx context.Context, color string, key int64, addr string) (ok bool, result string, epoch uint64, err error)
+	GetSetEntry(ctx context.Context, color string, key int64, e RouteEntry) (old, cur RouteEntry, err error)
+	SetNxOrGetEntry(ctx context.Context, color string, key int64, e RouteEntry) (ok bool, cur RouteEntry, err error)
+	CompareAndSwap(ctx context.Context, color string, key int64, old, addr string) (epoch uint64, err error)
+
+	BatchSet(ctx context.Context, color string, keys []int64, addr string) (errs []error, err error)
+	BatchSetNxOrGet(ctx context.Context, color string, keys []int64, addr string) (results []SetNxOrGetResult, err error)
+	BatchDelIfSame(ctx context.Context, color string, keys []int64, value string, epochs []uint64) (errs []error, err error)
+
+	Del(ctx context.Context, color string, key int64) error
+	DelDelay(ctx context.Context, color string, key int64, delay time.Duration) error
+	DelIfSame(ctx context.Context, color string, key int64, value string, epoch uint64) error
+	DelDelayIfSame(ctx context.Context, color string, key int64, value string, epoch uint64, delay time.Duration) error
 
-	// DelDelay(ctx context.Context, color string, key int64, delay time.Duration) error
-	// DelIfSame(ctx context.Context, color string, key int64, value string) error
-	// DelDelayIfSame(ctx context.Context, color string, key int64, value string, delay time.Duration) error
-	// Del(ctx context.Context, color string, key int64) error
+	ListByAddr(ctx context.Context, color, addr string, cursor uint64, count int64) (keys []int64, next uint64, err error)
+	CountByAddr(ctx context.Context, color, addr string) (int64, error)
+	Drain(ctx context.Context, color, fromAddr string, picker DrainPicker, opts ...DrainOption) (DrainProgress, error)
+	Restore(ctx context.Context, entries []Entry) error
 }
 
 // ReNewalRouteTable is an interface for read-only access to the routing table.
 type ReNewalRouteTable interface {
 	ReadOnlyRouteTable
 
-	RenewSelf(ctx context.Context, color string, key int64, value string) error
+	RenewSelf(ctx context.Context, color string, key int64, value string, epoch uint64) error
+	BatchRenewSelf(ctx context.Context, color string, keys []int64, value string, epochs []uint64) (errs []error, err error)
 	TTL() time.Duration
 }
 
 type ReadOnlyRouteTable interface {
 	BuildKey(color string, oid int64) string
 	Get(ctx context.Context, color string, key int64) (addr string, err error)
+	GetWithEpoch(ctx context.Context, color string, key int64) (addr string, epoch uint64, err error)
 	BatchGet(ctx context.Context, color string, keys []int64) (addrs []string, err error)
+	GetEntry(ctx context.Context, color string, key int64) (RouteEntry, error)
+	GetEntryWithTTL(ctx context.Context, color string, key int64) (Entry, error)
+	BatchGetEntries(ctx context.Context, color string, keys []int64) ([]RouteEntry, error)
+	Scan(ctx context.Context, color string, cursor uint64, count int64) (entries []Entry, next uint64, err error)
+
+	// Watch and WatchAll stream ownership changes until ctx is done.
+	// They return ErrWatchNotSupported if the data store is not a Watcher.
+	Watch(ctx context.Context, color string, oid int64) (<-chan Event, error)
+	WatchAll(ctx context.Context, color string) (<-chan Event, error)
 }
 
 // Data is an interface for the underlying data storage of route tables.
+//
+// A write with a ttl, such as Set or Assign, expires the key after ttl if it is positive,
+// and persists it otherwise, whatever its expiration before. GetEx resets the expiration
+// of the key to a positive ttl, persists it with a zero ttl and keeps its expiration with a negative one.
+// Expire and ExpireIfSame delete the key with a non-positive expiration.
 type Data interface {
 	Get(ctx context.Context, key string) (addr string, err error)
 	GetEx(ctx context.Context, key string, ttl time.Duration) (addr string, err error)
 	BatchGet(ctx context.Context, keys []string) (addrs []string, err error)
+	// BatchGetWithTTL is BatchGet that also returns the remaining time to live of every key,
+	// which is zero for keys that do not expire or do not exist.
+	BatchGetWithTTL(ctx context.Context, keys []string) (addrs []string, ttls []time.Duration, err error)
+	// Scan iterates the keys matching the glob pattern match with the cursor semantics of Redis SCAN:
+	// it starts and ends at cursor 0, and count is a hint of the page size.
+	Scan(ctx context.Context, match string, cursor uint64, count int64) (keys []string, next uint64, err error)
 	Set(ctx context.Context, key, addr string, ttl time.Duration) error
 	SetNxOrGet(ctx context.Context, key, addr string, ttl time.Duration) (set bool, ret string, err error)
 	GetSet(ctx context.Context, key, addr string, ttl time.Duration) (old string, err error)
+	// CompareAndSwap sets key to addr only if its current value is old.
+	CompareAndSwap(ctx context.Context, key, old, addr string, ttl time.Duration) error
+	// Assign sets key to val, a RouteEntry encoded by MarshalBinary, with a new epoch allocated by the store,
+	// if the condition of mode holds. The condition, the allocation and the write are one atomic operation.
+	Assign(ctx context.Context, mode AssignMode, key, expect, val string, ttl time.Duration) (AssignResult, error)
 	Expire(ctx context.Context, key string, expiration time.Duration) error
 	ExpireIfSame(ctx context.Context, key, value string, expiration time.Duration) error
 	Del(ctx context.Context, key string) error
 	DelIfSame(ctx context.Context, key, value string) error
+
+	// The batch operations run the operation of the same name on every key, with the value of the same index.
+	// They return the result of each key, and err is only returned if the batch could not run.
+	// Each key is updated atomically, but the batch as a whole is not atomic.
+
+	BatchSet(ctx context.Context, keys, addrs []string, ttl time.Duration) (errs []error, err error)
+	// BatchSetWithTTL is BatchSet with the time to live of the same index, where zero means no expiration.
+	BatchSetWithTTL(ctx context.Context, keys, addrs []string, ttls []time.Duration) (errs []error, err error)
+	BatchSetNxOrGet(ctx context.Context, keys, addrs []string, ttl time.Duration) (results []SetNxOrGetResult, err error)
+	BatchCompareAndSwap(ctx context.Context, keys, olds, addrs []string, ttl time.Duration) (errs []error, err error)
+	BatchAssign(ctx context.Context, mode AssignMode, keys, expects, vals []string, ttl time.Duration) (results []AssignResult, err error)
+	BatchExpireIfSame(ctx context.Context, keys, values []string, expiration time.Duration) (errs []error, err error)
+	BatchDelIfSame(ctx context.Context, keys, values []string) (errs []error, err error)
+}
+
+// SetNxOrGetResult is the result of one key of a BatchSetNxOrGet.
+type SetNxOrGetResult struct {
+	// Set reports whether the key did not exist and has been set.
+	Set bool
+	// Addr is the current value of the key, which is the new value if Set is true.
+	// The route tables return the address of the current owner.
+	Addr string
+	// Epoch is the epoch of the current owner. It is only set by the route tables.
+	Epoch uint64
+	// Err is the error of this key. Set and Addr are undefined if it is not nil.
+	Err error
+}
+
+// InvalidateAll is the key an Invalidator passes to its subscribers when every routing entry may have changed.
+const InvalidateAll = ""
+
+// Invalidator broadcasts the keys of changed routing entries to every subscriber.
+type Invalidator interface {
+	// Publish notifies all subscribers that the routing entry of key has changed.
+	Publish(ctx context.Context, key string) error
+	// Subscribe calls fn with every published key until ctx is done.
+	// fn is called with InvalidateAll every time the subscription is established or re-established,
+	// as the keys published before may have been missed.
+	Subscribe(ctx context.Context, fn func(key string)) error
 }
 
+// Key builds a key in the form r_<name>_{<color>}_{<oid>}.
+// Redis Cluster only hashes the first {...} tag, so all routes of a color share one slot.
 func Key(name, color string, oid int64) string {
 	return fmt.Sprintf("r_%s_{%s}_{%d}", name, color, oid)
 }
 
+// ClusterKey builds a key in the form r_<name>_<color>_{<oid>}.
+// The oid is the only hash tag, so routes are distributed across Redis Cluster slots.
+func ClusterKey(name, color string, oid int64) string {
+	return fmt.Sprintf("r_%s_%s_{%d}", name, color, oid)
+}
+
+// SplitKey parses a key built by Key or ClusterKey.
+// The name may contain underscores, and so may the color of a key built by Key.
+// The color of a key built by ClusterKey is not delimited, so it must not contain underscores.
 func SplitKey(key string) (name, color string, oid int64, err error) {
-	parts := strings.Split(key, "_")
-	if len(parts) != 4 {
-		return "", "", 0, errors.New("invalid key")
+	rest, ok := strings.CutPrefix(key, legacyKeyPrefix)
+	if !ok || !strings.HasSuffix(rest, "}") {
+		return "", "", 0, errors.WithMessagef(ErrInvalidKey, "key=%s", key)
 	}
 
-	color = strings.Trim(strings.Trim(parts[2], "{"), "}")
+	i := strings.LastIndex(rest, "_{")
+	if i < 0 {
+		return "", "", 0, errors.WithMessagef(ErrInvalidKey, "key=%s", key)
+	}
 
-	oidStr := strings.Trim(strings.Trim(parts[3], "{"), "}")
-	oid, err = strconv.ParseInt(oidStr, 10, 64)
+	oid, err = strconv.ParseInt(rest[i+2:len(rest)-1], 10, 64)
 	if err != nil {
-		return "", "", 0, err
+		return "", "", 0, errors.WithMessagef(ErrInvalidKey, "key=%s err=%s", key, err)
+	}
+
+	rest = rest[:i]
+
+	if strings.HasSuffix(rest, "}") {
+		i = strings.LastIndex(rest, "_{")
+		if i <= 0 {
+			return "", "", 0, errors.WithMessagef(ErrInvalidKey, "key=%s", key)
+		}
+
+		return rest[:i], rest[i+2 : len(rest)-1], oid, nil
+	}
+
+	i = strings.LastIndexByte(rest, '_')
+	if i <= 0 {
+		return "", "", 0, errors.WithMessagef(ErrInvalidKey, "key=%s", key)
 	}
 
-	return parts[1], color, oid, nil
+	return rest[:i], rest[i+1:], oid, nil
 }
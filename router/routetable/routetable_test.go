@@ -0,0 +1,49 @@
+package routetable
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "r_player_{blue}_{42}", Key("player", "blue", 42))
+	assert.Equal(t, "r_player_blue_{42}", ClusterKey("player", "blue", 42))
+}
+
+func TestSplitKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		key   string
+		name  string
+		color string
+		oid   int64
+	}{
+		{key: Key("player", "blue", 42), name: "player", color: "blue", oid: 42},
+		{key: ClusterKey("player", "blue", 42), name: "player", color: "blue", oid: 42},
+		{key: Key("player_v2", "feature_x", -7), name: "player_v2", color: "feature_x", oid: -7},
+		{key: ClusterKey("player_v2", "blue", 7), name: "player_v2", color: "blue", oid: 7},
+		{key: Key("room", "", 1), name: "room", color: "", oid: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Parallel()
+
+			name, color, oid, err := SplitKey(tt.key)
+			require.NoError(t, err)
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.color, color)
+			assert.Equal(t, tt.oid, oid)
+		})
+	}
+
+	for _, key := range []string{"", "r_player", "r_player_{blue}_{x}", "x_player_{blue}_{1}", "r_{1}", "r1:player:blue:{1}"} {
+		_, _, _, err := SplitKey(key)
+		require.ErrorIs(t, err, ErrInvalidKey, key)
+	}
+}
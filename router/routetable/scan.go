@@ -0,0 +1,248 @@
+package routetable
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/go-pantheon/fabrica-util/errors"
+)
+
+const (
+	defaultScanCount  = 100
+	importBatchSize   = 100
+	maxExportLineSize = 64 * 1024
+)
+
+// Entry is a routing entry with its key and remaining time to live.
+type Entry struct {
+	Color string
+	OID   int64
+	RouteEntry
+	// TTL is the remaining time to live. Zero means the entry does not expire.
+	TTL time.Duration
+}
+
+// Scan returns a page of the routing entries of color, starting at cursor 0 and ending when
+// the returned cursor is 0. count is a hint of the page size, and a page may be empty before the end.
+// Like Redis SCAN, entries present during the whole iteration are returned at least once,
+// and entries changed during the iteration may be missed or returned more than once.
+func (r *readOnlyRouteTable) Scan(ctx context.Context, color string, cursor uint64, count int64) ([]Entry, uint64, error) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	keys, next, err := r.data.Scan(ctx, r.codec.Pattern(r.name, color), cursor, count)
+	if err != nil {
+		return nil, 0, errors.WithMessagef(err, "scan route table failed. color=%s cursor=%d", color, cursor)
+	}
+
+	if len(keys) == 0 {
+		return nil, next, nil
+	}
+
+	addrs, ttls, err := r.data.BatchGetWithTTL(ctx, keys)
+	if err != nil {
+		return nil, 0, errors.WithMessagef(err, "scan route table failed. color=%s cursor=%d", color, cursor)
+	}
+
+	entries := make([]Entry, 0, len(keys))
+
+	for i, key := range keys {
+		// the entry has expired or been deleted since it was scanned
+		if addrs[i] == "" {
+			continue
+		}
+
+		name, c, oid, err := r.codec.Decode(key)
+		if err != nil || name != r.name || c != color {
+			continue
+		}
+
+		e, err := decodeEntry(key, addrs[i])
+		if err != nil {
+			return nil, 0, errors.WithMessagef(err, "scan route table failed. color=%s cursor=%d", color, cursor)
+		}
+
+		entries = append(entries, Entry{Color: color, OID: oid, RouteEntry: e, TTL: ttls[i]})
+	}
+
+	return entries, next, nil
+}
+
+// Range calls fn with every routing entry of color until fn returns false.
+// It has the guarantees of Scan.
+func Range(ctx context.Context, rt ReadOnlyRouteTable, color string, fn func(Entry) bool) error {
+	var cursor uint64
+
+	for {
+		entries, next, err := rt.Scan(ctx, color, cursor, defaultScanCount)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			if !fn(e) {
+				return nil
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+
+		cursor = next
+	}
+}
+
+// exportedEntry is the JSON Lines representation of an Entry.
+type exportedEntry struct {
+	Color string `json:"color"`
+	OID   int64  `json:"oid"`
+	RouteEntry
+	TTLMs int64 `json:"ttl_ms,omitempty"`
+}
+
+// Export writes every routing entry of color to w as JSON Lines and returns the number of entries written.
+// Every line is an object with the color and oid fields, the fields of the RouteEntry, and ttl_ms,
+// the remaining time to live in milliseconds, which is omitted for entries that do not expire.
+func Export(ctx context.Context, rt ReadOnlyRouteTable, color string, w io.Writer) (int, error) {
+	var (
+		n      int
+		encErr error
+		enc    = json.NewEncoder(w)
+	)
+
+	err := Range(ctx, rt, color, func(e Entry) bool {
+		encErr = enc.Encode(exportedEntry{
+			Color:      e.Color,
+			OID:        e.OID,
+			RouteEntry: e.RouteEntry,
+			TTLMs:      ttlMillis(e.TTL),
+		})
+		if encErr != nil {
+			return false
+		}
+
+		n++
+
+		return true
+	})
+	if err != nil {
+		return n, errors.WithMessagef(err, "export route table failed. color=%s", color)
+	}
+
+	if encErr != nil {
+		return n, errors.Wrapf(encErr, "export route table failed. color=%s", color)
+	}
+
+	return n, nil
+}
+
+// ttlMillis converts a time to live to milliseconds, rounding up so that an entry
+// that expires in less than a millisecond is not exported as an entry that never expires.
+func ttlMillis(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return int64((ttl + time.Millisecond - 1) / time.Millisecond)
+}
+
+// Import restores the routing entries written by Export from r with their remaining time to live,
+// and returns the number of entries restored. Existing entries of the same oids are overwritten.
+func Import(ctx context.Context, rt MasterRouteTable, r io.Reader) (int, error) {
+	var (
+		n     int
+		line  int
+		batch = make([]Entry, 0, importBatchSize)
+	)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := rt.Restore(ctx, batch); err != nil {
+			return errors.WithMessagef(err, "import route table failed. line=%d", line)
+		}
+
+		n += len(batch)
+		batch = batch[:0]
+
+		return nil
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 4096), maxExportLineSize)
+
+	for sc.Scan() {
+		line++
+
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+
+		var e exportedEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return n, errors.Wrapf(err, "import route table failed. line=%d", line)
+		}
+
+		if e.Addr == "" {
+			return n, errors.Errorf("import route table failed, empty addr. line=%d", line)
+		}
+
+		batch = append(batch, Entry{
+			Color:      e.Color,
+			OID:        e.OID,
+			RouteEntry: e.RouteEntry,
+			TTL:        time.Duration(e.TTLMs) * time.Millisecond,
+		})
+
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return n, errors.Wrapf(err, "import route table failed. line=%d", line)
+	}
+
+	return n, flush()
+}
+
+// Restore stores entries with their own attributes and time to live, or without expiration if it is zero,
+// in one batch. It is meant to restore a snapshot and bypasses the TTL and the epoch assignment of the route table.
+// The batch is not atomic: the entries that do not fail are restored even if an error is returned.
+func (r *masterRouteTable) Restore(ctx context.Context, entries []Entry) error {
+	var (
+		keys = make([]string, len(entries))
+		vals = make([]string, len(entries))
+		ttls = make([]time.Duration, len(entries))
+	)
+
+	for i, e := range entries {
+		keys[i] = r.BuildKey(e.Color, e.OID)
+		vals[i] = encodeEntry(e.RouteEntry)
+		ttls[i] = e.TTL
+	}
+
+	errs, err := r.data.BatchSetWithTTL(ctx, keys, vals, ttls)
+	if err != nil {
+		return errors.WithMessagef(err, "restore route table failed. entries=%d", len(entries))
+	}
+
+	r.invalidateSucceeded(ctx, keys, errs)
+
+	for i, err := range errs {
+		if err != nil {
+			return errors.WithMessagef(err, "restore route table failed. color=%s oid=%d", entries[i].Color, entries[i].OID)
+		}
+	}
+
+	return nil
+}
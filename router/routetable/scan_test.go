@@ -0,0 +1,117 @@
+package routetable_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScan(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, _ := newTestMasterRouteTable(t, routetable.WithTTL(time.Minute))
+
+	_, err := rt.BatchSet(ctx, testColor, []int64{1, 2, 3, 4, 5}, "10.0.0.1:9000")
+	require.NoError(t, err)
+	require.NoError(t, rt.Set(ctx, "red", 6, "10.0.0.1:9000"))
+
+	var (
+		entries []routetable.Entry
+		cursor  uint64
+	)
+
+	for {
+		page, next, err := rt.Scan(ctx, testColor, cursor, 2)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(page), 2)
+
+		entries = append(entries, page...)
+
+		if next == 0 {
+			break
+		}
+
+		cursor = next
+	}
+
+	require.Len(t, entries, 5)
+
+	for _, e := range entries {
+		assert.Equal(t, testColor, e.Color)
+		assert.Equal(t, time.Minute, e.TTL)
+	}
+
+	count := 0
+	require.NoError(t, routetable.Range(ctx, rt, testColor, func(routetable.Entry) bool {
+		count++
+		return count < 3
+	}))
+	assert.Equal(t, 3, count)
+}
+
+func TestExportImport(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	src, clock := newTestMasterRouteTable(t, routetable.WithTTL(time.Minute))
+
+	route := routetable.RouteEntry{
+		Addr:       "10.0.0.2:9000",
+		Node:       "player-2",
+		Version:    "v1.2.0",
+		AssignedAt: time.UnixMicro(1700000000000000).UTC(),
+		Epoch:      7,
+		Metadata:   map[string]string{"zone": "a"},
+	}
+
+	require.NoError(t, src.Restore(ctx, []routetable.Entry{
+		{Color: testColor, OID: 1, RouteEntry: routetable.RouteEntry{Addr: "10.0.0.1:9000"}, TTL: time.Minute},
+		{Color: testColor, OID: 2, RouteEntry: route},
+		{Color: testColor, OID: 3, RouteEntry: routetable.RouteEntry{Addr: "10.0.0.3:9000"}, TTL: time.Second*20 + time.Microsecond*500},
+	}))
+
+	clock.Advance(time.Second * 20)
+
+	var buf bytes.Buffer
+
+	n, err := routetable.Export(ctx, src, testColor, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Contains(t, buf.String(), `{"color":"blue","oid":1,"addr":"10.0.0.1:9000","ttl_ms":40000}`)
+	// a time to live below one millisecond is rounded up instead of becoming permanent
+	assert.Contains(t, buf.String(), `{"color":"blue","oid":3,"addr":"10.0.0.3:9000","ttl_ms":1}`)
+	assert.Contains(t, buf.String(), `{"color":"blue","oid":2,"addr":"10.0.0.2:9000","node":"player-2","version":"v1.2.0",`+
+		`"assigned_at":"2023-11-14T22:13:20Z","epoch":7,"metadata":{"zone":"a"}}`)
+
+	dst, clock := newTestMasterRouteTable(t)
+
+	n, err = routetable.Import(ctx, dst, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	clock.Advance(time.Second * 40)
+
+	addrs, err := dst.BatchGet(ctx, testColor, []int64{1, 2, 3})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "10.0.0.2:9000", ""}, addrs)
+
+	e, err := dst.GetEntry(ctx, testColor, 2)
+	require.NoError(t, err)
+	assert.True(t, route.AssignedAt.Equal(e.AssignedAt))
+
+	e.AssignedAt = route.AssignedAt
+	assert.Equal(t, route, e)
+
+	_, err = routetable.Import(ctx, dst, strings.NewReader("{\"color\":\"blue\",\"oid\":3}\n"))
+	require.Error(t, err)
+
+	_, err = routetable.Import(ctx, dst, strings.NewReader("not json\n"))
+	require.Error(t, err)
+}
@@ -0,0 +1,255 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+)
+
+var (
+	_ routetable.Data    = (*Data)(nil)
+	_ routetable.Watcher = (*Data)(nil)
+)
+
+// Data is an instrumenting decorator of a routetable.Data. Its spans carry the keys of the operations.
+type Data struct {
+	data routetable.Data
+	in   *instrument
+}
+
+// NewData creates an instrumenting decorator of data, whose spans and metrics are attributed to the route table name.
+func NewData(data routetable.Data, name string, opts ...Option) (*Data, error) {
+	in, err := newInstrument(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Data{data: data, in: in}, nil
+}
+
+// Get loads a value and counts the lookup.
+func (d *Data) Get(ctx context.Context, key string) (val string, err error) {
+	ctx, o := d.in.start(ctx, "get", keyAttr(key))
+	defer o.end(&err)
+
+	val, err = d.data.Get(ctx, key)
+	o.lookup(err)
+
+	return val, err
+}
+
+// GetEx loads a value, resets its expiration time and counts the lookup.
+func (d *Data) GetEx(ctx context.Context, key string, ttl time.Duration) (val string, err error) {
+	ctx, o := d.in.start(ctx, "getex", keyAttr(key))
+	defer o.end(&err)
+
+	val, err = d.data.GetEx(ctx, key, ttl)
+	o.lookup(err)
+
+	return val, err
+}
+
+// BatchGet loads the values of keys and counts the lookups.
+func (d *Data) BatchGet(ctx context.Context, keys []string) (vals []string, err error) {
+	ctx, o := d.in.start(ctx, "batch_get", countAttr(len(keys)))
+	defer o.end(&err)
+
+	if vals, err = d.data.BatchGet(ctx, keys); err == nil {
+		o.lookups(vals)
+	}
+
+	return vals, err
+}
+
+// BatchGetWithTTL loads the values of keys and their time to live and counts the lookups.
+func (d *Data) BatchGetWithTTL(ctx context.Context, keys []string) (vals []string, ttls []time.Duration, err error) {
+	ctx, o := d.in.start(ctx, "batch_get_ttl", countAttr(len(keys)))
+	defer o.end(&err)
+
+	if vals, ttls, err = d.data.BatchGetWithTTL(ctx, keys); err == nil {
+		o.lookups(vals)
+	}
+
+	return vals, ttls, err
+}
+
+// Scan iterates the keys matching the glob pattern match.
+func (d *Data) Scan(ctx context.Context, match string, cursor uint64, count int64) (keys []string, next uint64, err error) {
+	ctx, o := d.in.start(ctx, "scan", keyAttr(match))
+	defer o.end(&err)
+
+	return d.data.Scan(ctx, match, cursor, count)
+}
+
+// Set stores a value.
+func (d *Data) Set(ctx context.Context, key, val string, ttl time.Duration) (err error) {
+	ctx, o := d.in.start(ctx, "set", keyAttr(key))
+	defer o.end(&err)
+
+	return d.data.Set(ctx, key, val, ttl)
+}
+
+// SetNxOrGet sets a value if the key does not exist and counts the conflict otherwise.
+func (d *Data) SetNxOrGet(ctx context.Context, key, val string, ttl time.Duration) (set bool, cur string, err error) {
+	ctx, o := d.in.start(ctx, "setnx", keyAttr(key))
+	defer o.end(&err)
+
+	set, cur, err = d.data.SetNxOrGet(ctx, key, val, ttl)
+	o.setNx(set, err)
+
+	return set, cur, err
+}
+
+// GetSet sets a new value and returns the old one.
+func (d *Data) GetSet(ctx context.Context, key, val string, ttl time.Duration) (old string, err error) {
+	ctx, o := d.in.start(ctx, "getset", keyAttr(key))
+	defer o.end(&err)
+
+	return d.data.GetSet(ctx, key, val, ttl)
+}
+
+// CompareAndSwap sets key to val only if its current value is old.
+func (d *Data) CompareAndSwap(ctx context.Context, key, old, val string, ttl time.Duration) (err error) {
+	ctx, o := d.in.start(ctx, "cas", keyAttr(key))
+	defer o.end(&err)
+
+	return d.data.CompareAndSwap(ctx, key, old, val, ttl)
+}
+
+// Assign sets key to val with a new epoch if the condition of mode holds, and counts the conflicts.
+func (d *Data) Assign(ctx context.Context, mode routetable.AssignMode, key, expect, val string, ttl time.Duration) (ret routetable.AssignResult, err error) {
+	ctx, o := d.in.start(ctx, "assign", keyAttr(key))
+	defer o.end(&err)
+
+	ret, err = d.data.Assign(ctx, mode, key, expect, val, ttl)
+	if err == nil || errors.Is(err, xerrors.ErrRouteTableValueNotSame) {
+		o.assign(mode, []routetable.AssignResult{{Assigned: ret.Assigned, Err: err}})
+	}
+
+	return ret, err
+}
+
+// Expire sets an expiration time for a key.
+func (d *Data) Expire(ctx context.Context, key string, expiration time.Duration) (err error) {
+	ctx, o := d.in.start(ctx, "expire", keyAttr(key))
+	defer o.end(&err)
+
+	return d.data.Expire(ctx, key, expiration)
+}
+
+// ExpireIfSame sets an expiration time for a key only if its current value matches value.
+func (d *Data) ExpireIfSame(ctx context.Context, key, value string, expiration time.Duration) (err error) {
+	ctx, o := d.in.start(ctx, "expire_same", keyAttr(key))
+	defer o.end(&err)
+
+	return d.data.ExpireIfSame(ctx, key, value, expiration)
+}
+
+// Del deletes a key.
+func (d *Data) Del(ctx context.Context, key string) (err error) {
+	ctx, o := d.in.start(ctx, "del", keyAttr(key))
+	defer o.end(&err)
+
+	return d.data.Del(ctx, key)
+}
+
+// DelIfSame deletes a key only if its current value matches value.
+func (d *Data) DelIfSame(ctx context.Context, key, value string) (err error) {
+	ctx, o := d.in.start(ctx, "del_same", keyAttr(key))
+	defer o.end(&err)
+
+	return d.data.DelIfSame(ctx, key, value)
+}
+
+// BatchSet stores the values of keys.
+func (d *Data) BatchSet(ctx context.Context, keys, vals []string, ttl time.Duration) (errs []error, err error) {
+	ctx, o := d.in.start(ctx, "batch_set", countAttr(len(keys)))
+	defer o.end(&err)
+
+	return d.data.BatchSet(ctx, keys, vals, ttl)
+}
+
+// BatchSetWithTTL stores the values of keys with the time to live of the same index.
+func (d *Data) BatchSetWithTTL(ctx context.Context, keys, vals []string, ttls []time.Duration) (errs []error, err error) {
+	ctx, o := d.in.start(ctx, "batch_set_ttl", countAttr(len(keys)))
+	defer o.end(&err)
+
+	return d.data.BatchSetWithTTL(ctx, keys, vals, ttls)
+}
+
+// BatchSetNxOrGet sets the values of the keys that do not exist and counts the conflicts.
+func (d *Data) BatchSetNxOrGet(ctx context.Context, keys, vals []string, ttl time.Duration) (results []routetable.SetNxOrGetResult, err error) {
+	ctx, o := d.in.start(ctx, "batch_setnx", countAttr(len(keys)))
+	defer o.end(&err)
+
+	if results, err = d.data.BatchSetNxOrGet(ctx, keys, vals, ttl); err == nil {
+		o.batchSetNx(results)
+	}
+
+	return results, err
+}
+
+// BatchCompareAndSwap runs CompareAndSwap on every key.
+func (d *Data) BatchCompareAndSwap(ctx context.Context, keys, olds, vals []string, ttl time.Duration) (errs []error, err error) {
+	ctx, o := d.in.start(ctx, "batch_cas", countAttr(len(keys)))
+	defer o.end(&err)
+
+	if errs, err = d.data.BatchCompareAndSwap(ctx, keys, olds, vals, ttl); err == nil {
+		o.batch(errs)
+	}
+
+	return errs, err
+}
+
+// BatchAssign runs Assign on every key.
+func (d *Data) BatchAssign(ctx context.Context, mode routetable.AssignMode, keys, expects, vals []string, ttl time.Duration) (results []routetable.AssignResult, err error) {
+	ctx, o := d.in.start(ctx, "batch_assign", countAttr(len(keys)))
+	defer o.end(&err)
+
+	if results, err = d.data.BatchAssign(ctx, mode, keys, expects, vals, ttl); err == nil {
+		o.assign(mode, results)
+	}
+
+	return results, err
+}
+
+// BatchExpireIfSame runs ExpireIfSame on every key.
+func (d *Data) BatchExpireIfSame(ctx context.Context, keys, values []string, expiration time.Duration) (errs []error, err error) {
+	ctx, o := d.in.start(ctx, "batch_expire_same", countAttr(len(keys)))
+	defer o.end(&err)
+
+	if errs, err = d.data.BatchExpireIfSame(ctx, keys, values, expiration); err == nil {
+		o.batch(errs)
+	}
+
+	return errs, err
+}
+
+// BatchDelIfSame runs DelIfSame on every key.
+func (d *Data) BatchDelIfSame(ctx context.Context, keys, values []string) (errs []error, err error) {
+	ctx, o := d.in.start(ctx, "batch_del_same", countAttr(len(keys)))
+	defer o.end(&err)
+
+	if errs, err = d.data.BatchDelIfSame(ctx, keys, values); err == nil {
+		o.batch(errs)
+	}
+
+	return errs, err
+}
+
+// Watch streams the changes of the wrapped data store if it is a routetable.Watcher.
+// Only the start of the watch is traced.
+func (d *Data) Watch(ctx context.Context, pattern string) (ch <-chan routetable.DataEvent, err error) {
+	w, ok := d.data.(routetable.Watcher)
+	if !ok {
+		return nil, routetable.ErrWatchNotSupported
+	}
+
+	_, o := d.in.start(ctx, "watch", keyAttr(pattern))
+	defer o.end(&err)
+
+	return w.Watch(ctx, pattern)
+}
@@ -0,0 +1,259 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+)
+
+var _ routetable.MasterRouteTable = (*MasterRouteTable)(nil)
+
+// MasterRouteTable is an instrumenting decorator of a routetable.MasterRouteTable.
+// Its spans carry the color and oid of the operations, or the color and the number of oids of the batches.
+// The scans, watches and address index queries are not instrumented.
+type MasterRouteTable struct {
+	routetable.MasterRouteTable
+
+	in *instrument
+}
+
+// NewMaster creates an instrumenting decorator of rt, whose spans and metrics are attributed to the route table name.
+func NewMaster(rt routetable.MasterRouteTable, name string, opts ...Option) (*MasterRouteTable, error) {
+	in, err := newInstrument(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MasterRouteTable{MasterRouteTable: rt, in: in}, nil
+}
+
+// Get retrieves a routing entry and counts the lookup.
+func (m *MasterRouteTable) Get(ctx context.Context, color string, oid int64) (addr string, err error) {
+	ctx, o := m.in.start(ctx, "get", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	addr, err = m.MasterRouteTable.Get(ctx, color, oid)
+	o.lookup(err)
+
+	return addr, err
+}
+
+// GetEx retrieves a routing entry, renews it and counts the lookup.
+func (m *MasterRouteTable) GetEx(ctx context.Context, color string, oid int64) (addr string, err error) {
+	ctx, o := m.in.start(ctx, "getex", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	addr, err = m.MasterRouteTable.GetEx(ctx, color, oid)
+	o.lookup(err)
+
+	return addr, err
+}
+
+// GetWithEpoch retrieves a routing entry with its epoch and counts the lookup.
+func (m *MasterRouteTable) GetWithEpoch(ctx context.Context, color string, oid int64) (addr string, epoch uint64, err error) {
+	ctx, o := m.in.start(ctx, "get", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	addr, epoch, err = m.MasterRouteTable.GetWithEpoch(ctx, color, oid)
+	o.lookup(err)
+
+	return addr, epoch, err
+}
+
+// GetEntry retrieves a routing entry with all its attributes and counts the lookup.
+func (m *MasterRouteTable) GetEntry(ctx context.Context, color string, oid int64) (e routetable.RouteEntry, err error) {
+	ctx, o := m.in.start(ctx, "get", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	e, err = m.MasterRouteTable.GetEntry(ctx, color, oid)
+	o.lookup(err)
+
+	return e, err
+}
+
+// GetEntryWithTTL retrieves a routing entry with its remaining time to live and counts the lookup.
+func (m *MasterRouteTable) GetEntryWithTTL(ctx context.Context, color string, oid int64) (e routetable.Entry, err error) {
+	ctx, o := m.in.start(ctx, "get", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	e, err = m.MasterRouteTable.GetEntryWithTTL(ctx, color, oid)
+	o.lookup(err)
+
+	return e, err
+}
+
+// BatchGet retrieves routing entries and counts the lookups.
+func (m *MasterRouteTable) BatchGet(ctx context.Context, color string, oids []int64) (addrs []string, err error) {
+	ctx, o := m.in.start(ctx, "batch_get", batchAttrs(color, len(oids))...)
+	defer o.end(&err)
+
+	if addrs, err = m.MasterRouteTable.BatchGet(ctx, color, oids); err == nil {
+		o.lookups(addrs)
+	}
+
+	return addrs, err
+}
+
+// BatchGetEntries retrieves routing entries with all their attributes and counts the lookups.
+func (m *MasterRouteTable) BatchGetEntries(ctx context.Context, color string, oids []int64) (entries []routetable.RouteEntry, err error) {
+	ctx, o := m.in.start(ctx, "batch_get", batchAttrs(color, len(oids))...)
+	defer o.end(&err)
+
+	if entries, err = m.MasterRouteTable.BatchGetEntries(ctx, color, oids); err == nil {
+		addrs := make([]string, len(entries))
+		for i, e := range entries {
+			addrs[i] = e.Addr
+		}
+
+		o.lookups(addrs)
+	}
+
+	return entries, err
+}
+
+// RenewSelf renews a routing entry owned by value with epoch.
+func (m *MasterRouteTable) RenewSelf(ctx context.Context, color string, oid int64, value string, epoch uint64) (err error) {
+	ctx, o := m.in.start(ctx, "renew", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	return m.MasterRouteTable.RenewSelf(ctx, color, oid, value, epoch)
+}
+
+// BatchRenewSelf renews the routing entries owned by value with the epochs of the same index.
+func (m *MasterRouteTable) BatchRenewSelf(ctx context.Context, color string, oids []int64, value string, epochs []uint64) (errs []error, err error) {
+	ctx, o := m.in.start(ctx, "batch_renew", batchAttrs(color, len(oids))...)
+	defer o.end(&err)
+
+	if errs, err = m.MasterRouteTable.BatchRenewSelf(ctx, color, oids, value, epochs); err == nil {
+		o.batch(errs)
+	}
+
+	return errs, err
+}
+
+// Set stores a routing entry.
+func (m *MasterRouteTable) Set(ctx context.Context, color string, oid int64, addr string) (err error) {
+	ctx, o := m.in.start(ctx, "set", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	return m.MasterRouteTable.Set(ctx, color, oid, addr)
+}
+
+// GetSet swaps a routing entry.
+func (m *MasterRouteTable) GetSet(ctx context.Context, color string, oid int64, addr string) (old string, epoch uint64, err error) {
+	ctx, o := m.in.start(ctx, "getset", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	return m.MasterRouteTable.GetSet(ctx, color, oid, addr)
+}
+
+// SetNxOrGet sets a routing entry if it does not exist and counts the conflict otherwise.
+func (m *MasterRouteTable) SetNxOrGet(ctx context.Context, color string, oid int64, addr string) (ok bool, cur string, epoch uint64, err error) {
+	ctx, o := m.in.start(ctx, "setnx", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	ok, cur, epoch, err = m.MasterRouteTable.SetNxOrGet(ctx, color, oid, addr)
+	o.setNx(ok, err)
+
+	return ok, cur, epoch, err
+}
+
+// GetSetEntry swaps a routing entry.
+func (m *MasterRouteTable) GetSetEntry(ctx context.Context, color string, oid int64, e routetable.RouteEntry) (old, cur routetable.RouteEntry, err error) {
+	ctx, o := m.in.start(ctx, "getset", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	return m.MasterRouteTable.GetSetEntry(ctx, color, oid, e)
+}
+
+// SetNxOrGetEntry sets a routing entry if it does not exist and counts the conflict otherwise.
+func (m *MasterRouteTable) SetNxOrGetEntry(ctx context.Context, color string, oid int64, e routetable.RouteEntry) (ok bool, cur routetable.RouteEntry, err error) {
+	ctx, o := m.in.start(ctx, "setnx", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	ok, cur, err = m.MasterRouteTable.SetNxOrGetEntry(ctx, color, oid, e)
+	o.setNx(ok, err)
+
+	return ok, cur, err
+}
+
+// CompareAndSwap moves a routing entry if it is still routed to old.
+func (m *MasterRouteTable) CompareAndSwap(ctx context.Context, color string, oid int64, old, addr string) (epoch uint64, err error) {
+	ctx, o := m.in.start(ctx, "cas", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	return m.MasterRouteTable.CompareAndSwap(ctx, color, oid, old, addr)
+}
+
+// BatchSet stores routing entries.
+func (m *MasterRouteTable) BatchSet(ctx context.Context, color string, oids []int64, addr string) (errs []error, err error) {
+	ctx, o := m.in.start(ctx, "batch_set", batchAttrs(color, len(oids))...)
+	defer o.end(&err)
+
+	return m.MasterRouteTable.BatchSet(ctx, color, oids, addr)
+}
+
+// BatchSetNxOrGet sets routing entries that do not exist and counts the conflicts.
+func (m *MasterRouteTable) BatchSetNxOrGet(ctx context.Context, color string, oids []int64, addr string) (results []routetable.SetNxOrGetResult, err error) {
+	ctx, o := m.in.start(ctx, "batch_setnx", batchAttrs(color, len(oids))...)
+	defer o.end(&err)
+
+	if results, err = m.MasterRouteTable.BatchSetNxOrGet(ctx, color, oids, addr); err == nil {
+		o.batchSetNx(results)
+	}
+
+	return results, err
+}
+
+// BatchDelIfSame deletes routing entries owned by value with the epochs of the same index.
+func (m *MasterRouteTable) BatchDelIfSame(ctx context.Context, color string, oids []int64, value string, epochs []uint64) (errs []error, err error) {
+	ctx, o := m.in.start(ctx, "batch_del_same", batchAttrs(color, len(oids))...)
+	defer o.end(&err)
+
+	if errs, err = m.MasterRouteTable.BatchDelIfSame(ctx, color, oids, value, epochs); err == nil {
+		o.batch(errs)
+	}
+
+	return errs, err
+}
+
+// Del deletes a routing entry.
+func (m *MasterRouteTable) Del(ctx context.Context, color string, oid int64) (err error) {
+	ctx, o := m.in.start(ctx, "del", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	return m.MasterRouteTable.Del(ctx, color, oid)
+}
+
+// DelDelay marks a routing entry for delayed deletion.
+func (m *MasterRouteTable) DelDelay(ctx context.Context, color string, oid int64, delay time.Duration) (err error) {
+	ctx, o := m.in.start(ctx, "del_delay", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	return m.MasterRouteTable.DelDelay(ctx, color, oid, delay)
+}
+
+// DelIfSame deletes a routing entry owned by value with epoch.
+func (m *MasterRouteTable) DelIfSame(ctx context.Context, color string, oid int64, value string, epoch uint64) (err error) {
+	ctx, o := m.in.start(ctx, "del_same", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	return m.MasterRouteTable.DelIfSame(ctx, color, oid, value, epoch)
+}
+
+// DelDelayIfSame marks a routing entry owned by value with epoch for delayed deletion.
+func (m *MasterRouteTable) DelDelayIfSame(ctx context.Context, color string, oid int64, value string, epoch uint64, delay time.Duration) (err error) {
+	ctx, o := m.in.start(ctx, "del_delay_same", routeAttrs(color, oid)...)
+	defer o.end(&err)
+
+	return m.MasterRouteTable.DelDelayIfSame(ctx, color, oid, value, epoch, delay)
+}
+
+// Drain moves the routing entries of fromAddr.
+func (m *MasterRouteTable) Drain(ctx context.Context, color, fromAddr string, picker routetable.DrainPicker, opts ...routetable.DrainOption) (p routetable.DrainProgress, err error) {
+	ctx, o := m.in.start(ctx, "drain", colorAttr(color))
+	defer o.end(&err)
+
+	return m.MasterRouteTable.Drain(ctx, color, fromAddr, picker, opts...)
+}
@@ -0,0 +1,198 @@
+// Package telemetry provides decorators of route tables that record OpenTelemetry spans and metrics
+// of every operation, with the metrics of the kit's metrics/routetable package and the spans of
+// its trace/traceroutetable package.
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	rtmetrics "github.com/go-pantheon/fabrica-kit/metrics/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/trace/traceroutetable"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option is a function type that configures the decorators.
+type Option func(*options)
+
+type options struct {
+	metrics *rtmetrics.MetricsConfig
+	tracing *traceroutetable.TracingConfig
+}
+
+// WithMeterProvider returns an Option that sets the provider of the metrics.
+// The global provider is used by default.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(o *options) {
+		if mp != nil {
+			o.metrics.MeterProvider = mp
+		}
+	}
+}
+
+// WithTracerProvider returns an Option that sets the provider of the spans.
+// The global provider is used by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		if tp != nil {
+			o.tracing.TracerProvider = tp
+		}
+	}
+}
+
+// instrument records the spans and metrics of the route table name.
+type instrument struct {
+	name    string
+	tracer  trace.Tracer
+	metrics *rtmetrics.Metrics
+}
+
+func newInstrument(name string, opts ...Option) (*instrument, error) {
+	o := &options{
+		metrics: rtmetrics.DefaultMetricsConfig(),
+		tracing: traceroutetable.DefaultTracingConfig(),
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	m, err := rtmetrics.NewMetrics(o.metrics)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "create route table metrics failed. name=%s", name)
+	}
+
+	return &instrument{
+		name:    name,
+		tracer:  traceroutetable.Tracer(o.tracing),
+		metrics: m,
+	}, nil
+}
+
+// op is a running operation.
+type op struct {
+	in    *instrument
+	ctx   context.Context
+	name  string
+	span  trace.Span
+	start time.Time
+}
+
+// start starts the span of the operation name. The returned context carries the span.
+func (in *instrument) start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, *op) {
+	ctx, span := traceroutetable.StartSpan(ctx, in.tracer, in.name, name, attrs...)
+
+	return ctx, &op{in: in, ctx: ctx, name: name, span: span, start: time.Now()}
+}
+
+// end records the result of the operation and ends its span. It takes a pointer so that it can be deferred.
+func (o *op) end(err *error) {
+	o.in.metrics.RecordOperation(o.ctx, o.in.name, o.name, o.start, *err)
+	traceroutetable.EndSpan(o.span, *err)
+}
+
+// lookup counts the result of a lookup of one routing entry.
+func (o *op) lookup(err error) {
+	switch {
+	case err == nil:
+		o.in.metrics.RecordLookups(o.ctx, o.in.name, 1, 0)
+	case errors.Is(err, xerrors.ErrRouteTableNotFound):
+		o.in.metrics.RecordLookups(o.ctx, o.in.name, 0, 1)
+	}
+}
+
+// lookups counts the results of a batch lookup, whose missing entries are empty.
+func (o *op) lookups(vals []string) {
+	var hits int64
+
+	for _, v := range vals {
+		if v != "" {
+			hits++
+		}
+	}
+
+	o.in.metrics.RecordLookups(o.ctx, o.in.name, hits, int64(len(vals))-hits)
+}
+
+// setNx counts a SetNx that found an existing routing entry.
+func (o *op) setNx(set bool, err error) {
+	if err == nil && !set {
+		o.in.metrics.RecordSetNxConflicts(o.ctx, o.in.name, 1)
+	}
+}
+
+// batchSetNx counts the keys of a batch SetNx that found an existing routing entry.
+func (o *op) batchSetNx(results []routetable.SetNxOrGetResult) {
+	var n int64
+
+	for _, r := range results {
+		if r.Err == nil && !r.Set {
+			n++
+		}
+	}
+
+	o.in.metrics.RecordSetNxConflicts(o.ctx, o.in.name, n)
+}
+
+// assign counts the keys of a batch assignment that found an existing routing entry,
+// or that were rejected with ErrRouteTableValueNotSame.
+func (o *op) assign(mode routetable.AssignMode, results []routetable.AssignResult) {
+	if mode == routetable.AssignIfAbsent {
+		var n int64
+
+		for _, r := range results {
+			if r.Err == nil && !r.Assigned {
+				n++
+			}
+		}
+
+		o.in.metrics.RecordSetNxConflicts(o.ctx, o.in.name, n)
+
+		return
+	}
+
+	errs := make([]error, len(results))
+	for i, r := range results {
+		errs[i] = r.Err
+	}
+
+	o.batch(errs)
+}
+
+// batch counts the keys of a batch rejected with ErrRouteTableValueNotSame.
+func (o *op) batch(errs []error) {
+	var n int64
+
+	for _, err := range errs {
+		if errors.Is(err, xerrors.ErrRouteTableValueNotSame) {
+			n++
+		}
+	}
+
+	o.in.metrics.RecordNotSame(o.ctx, o.in.name, o.name, n)
+}
+
+func keyAttr(key string) attribute.KeyValue {
+	return traceroutetable.KeyKey.String(key)
+}
+
+func countAttr(n int) attribute.KeyValue {
+	return traceroutetable.CountKey.Int(n)
+}
+
+func colorAttr(color string) attribute.KeyValue {
+	return traceroutetable.ColorKey.String(color)
+}
+
+func routeAttrs(color string, oid int64) []attribute.KeyValue {
+	return []attribute.KeyValue{colorAttr(color), traceroutetable.OIDKey.Int64(oid)}
+}
+
+func batchAttrs(color string, n int) []attribute.KeyValue {
+	return []attribute.KeyValue{colorAttr(color), countAttr(n)}
+}
@@ -0,0 +1,172 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/memory"
+	"github.com/go-pantheon/fabrica-kit/trace/traceroutetable"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type recorder struct {
+	spans  *tracetest.SpanRecorder
+	reader *sdkmetric.ManualReader
+}
+
+func newRecorder() (*recorder, []Option) {
+	r := &recorder{
+		spans:  tracetest.NewSpanRecorder(),
+		reader: sdkmetric.NewManualReader(),
+	}
+
+	return r, []Option{
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(r.spans))),
+		WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(r.reader))),
+	}
+}
+
+// sum returns the value of the counter name, or the number of records of the histogram name.
+func (r *recorder) sum(t *testing.T, name string) int64 {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, r.reader.Collect(context.Background(), &rm))
+
+	var n int64
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					n += dp.Value
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					n += int64(dp.Count)
+				}
+			}
+		}
+	}
+
+	return n
+}
+
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+
+	return attribute.Value{}
+}
+
+func TestData(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rec, opts := newRecorder()
+
+	mem := memory.New()
+	t.Cleanup(func() { _ = mem.Close() })
+
+	d, err := NewData(mem, "test", opts...)
+	require.NoError(t, err)
+
+	set, _, err := d.SetNxOrGet(ctx, "k1", "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, set)
+
+	set, _, err = d.SetNxOrGet(ctx, "k1", "b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, set)
+
+	_, err = d.Get(ctx, "k1")
+	require.NoError(t, err)
+
+	_, err = d.Get(ctx, "k2")
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+
+	vals, err := d.BatchGet(ctx, []string{"k1", "k2", "k3"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "", ""}, vals)
+
+	require.ErrorIs(t, d.DelIfSame(ctx, "k1", "b"), xerrors.ErrRouteTableValueNotSame)
+
+	assert.Equal(t, int64(6), rec.sum(t, "routetable.operation.duration"))
+	assert.Equal(t, int64(2), rec.sum(t, "routetable.lookups.hits"))
+	assert.Equal(t, int64(3), rec.sum(t, "routetable.lookups.misses"))
+	assert.Equal(t, int64(1), rec.sum(t, "routetable.setnx.conflicts"))
+	assert.Equal(t, int64(1), rec.sum(t, "routetable.value_not_same"))
+
+	spans := rec.spans.Ended()
+	require.Len(t, spans, 6)
+
+	get := spans[2]
+	assert.Equal(t, "routetable.get", get.Name())
+	assert.Equal(t, "test", spanAttr(get, traceroutetable.NameKey).AsString())
+	assert.Equal(t, "k1", spanAttr(get, traceroutetable.KeyKey).AsString())
+
+	// a missing entry is not a failure
+	assert.Equal(t, codes.Unset, spans[3].Status().Code)
+	assert.Equal(t, "not_found", spanAttr(spans[3], traceroutetable.ResultKey).AsString())
+}
+
+func TestMasterRouteTable(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rec, opts := newRecorder()
+
+	mem := memory.New()
+	t.Cleanup(func() { _ = mem.Close() })
+
+	rt, err := NewMaster(routetable.NewMasterRouteTable(mem, "test"), "test", opts...)
+	require.NoError(t, err)
+
+	ok, _, epoch, err := rt.SetNxOrGet(ctx, "blue", 1, "10.0.0.1:9000")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, _, _, err = rt.SetNxOrGet(ctx, "blue", 1, "10.0.0.2:9000")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	errs, err := rt.BatchRenewSelf(ctx, "blue", []int64{1, 2}, "10.0.0.1:9000", []uint64{epoch + 1, 0})
+	require.NoError(t, err)
+	require.ErrorIs(t, errs[0], xerrors.ErrRouteTableValueNotSame)
+	require.ErrorIs(t, errs[1], xerrors.ErrRouteTableNotFound)
+
+	addr, err := rt.Get(ctx, "blue", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:9000", addr)
+
+	assert.Equal(t, int64(1), rec.sum(t, "routetable.setnx.conflicts"))
+	assert.Equal(t, int64(1), rec.sum(t, "routetable.value_not_same"))
+	assert.Equal(t, int64(1), rec.sum(t, "routetable.lookups.hits"))
+
+	spans := rec.spans.Ended()
+	require.Len(t, spans, 4)
+
+	get := spans[3]
+	assert.Equal(t, "routetable.get", get.Name())
+	assert.Equal(t, "blue", spanAttr(get, traceroutetable.ColorKey).AsString())
+	assert.Equal(t, int64(1), spanAttr(get, traceroutetable.OIDKey).AsInt64())
+	assert.Equal(t, int64(2), spanAttr(spans[2], traceroutetable.CountKey).AsInt64())
+}
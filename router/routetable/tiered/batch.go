@@ -0,0 +1,209 @@
+package tiered
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+)
+
+// The batch operations mirror the result of every key like the operation of the same name.
+// Only the failure of a whole batch marks the route table degraded.
+
+// BatchSet stores the values of keys in both tiers.
+func (t *RouteTable) BatchSet(ctx context.Context, keys, vals []string, ttl time.Duration) ([]error, error) {
+	return run(t, ctx, "batch_set", func() ([]error, error) {
+		errs, err := t.primary.BatchSet(ctx, keys, vals, ttl)
+		if err == nil {
+			for i, e := range errs {
+				t.mirrorWrite(ctx, keys[i], vals[i], ttl, e)
+			}
+		}
+
+		return errs, err
+	}, func() ([]error, error) {
+		bases := t.bases(ctx, keys)
+		errs, err := t.local.BatchSet(ctx, keys, vals, ttl)
+		t.batchWritten(keys, bases, errs, err)
+
+		return errs, err
+	})
+}
+
+// BatchSetWithTTL stores the values of keys with the expiration time of the same index in both tiers.
+func (t *RouteTable) BatchSetWithTTL(ctx context.Context, keys, vals []string, ttls []time.Duration) ([]error, error) {
+	return run(t, ctx, "batch_set_ttl", func() ([]error, error) {
+		errs, err := t.primary.BatchSetWithTTL(ctx, keys, vals, ttls)
+		if err == nil {
+			for i, e := range errs {
+				t.mirrorWrite(ctx, keys[i], vals[i], ttls[i], e)
+			}
+		}
+
+		return errs, err
+	}, func() ([]error, error) {
+		bases := t.bases(ctx, keys)
+		errs, err := t.local.BatchSetWithTTL(ctx, keys, vals, ttls)
+		t.batchWritten(keys, bases, errs, err)
+
+		return errs, err
+	})
+}
+
+// BatchSetNxOrGet sets the values of the keys that do not exist and returns the current values of the others.
+func (t *RouteTable) BatchSetNxOrGet(ctx context.Context, keys, vals []string, ttl time.Duration) ([]routetable.SetNxOrGetResult, error) {
+	return run(t, ctx, "batch_setnx", func() ([]routetable.SetNxOrGetResult, error) {
+		results, err := t.primary.BatchSetNxOrGet(ctx, keys, vals, ttl)
+		if err == nil {
+			for i, r := range results {
+				t.mirrorWrite(ctx, keys[i], r.Addr, t.ttlOf(ttl), r.Err)
+			}
+		}
+
+		return results, err
+	}, func() ([]routetable.SetNxOrGetResult, error) {
+		bases := t.bases(ctx, keys)
+		results, err := t.local.BatchSetNxOrGet(ctx, keys, vals, ttl)
+		if err == nil {
+			for i, r := range results {
+				if r.Err == nil && r.Set {
+					t.written(keys[i], bases[i])
+				}
+			}
+		}
+
+		return results, err
+	})
+}
+
+// BatchCompareAndSwap sets every key to the value of the same index if its current value is the old one.
+func (t *RouteTable) BatchCompareAndSwap(ctx context.Context, keys, olds, vals []string, ttl time.Duration) ([]error, error) {
+	return run(t, ctx, "batch_cas", func() ([]error, error) {
+		errs, err := t.primary.BatchCompareAndSwap(ctx, keys, olds, vals, ttl)
+		if err == nil {
+			for i, e := range errs {
+				t.mirrorWrite(ctx, keys[i], vals[i], ttl, e)
+			}
+		}
+
+		return errs, err
+	}, func() ([]error, error) {
+		bases := t.bases(ctx, keys)
+		errs, err := t.local.BatchCompareAndSwap(ctx, keys, olds, vals, ttl)
+		t.batchWritten(keys, bases, errs, err)
+
+		return errs, err
+	})
+}
+
+// BatchAssign assigns the keys whose condition holds with new epochs.
+func (t *RouteTable) BatchAssign(ctx context.Context, mode routetable.AssignMode, keys, expects, vals []string, ttl time.Duration) ([]routetable.AssignResult, error) {
+	return run(t, ctx, "batch_assign", func() ([]routetable.AssignResult, error) {
+		results, err := t.primary.BatchAssign(ctx, mode, keys, expects, vals, ttl)
+		if err == nil {
+			for i, r := range results {
+				t.mirrorWrite(ctx, keys[i], r.Value, t.ttlOf(ttl), r.Err)
+			}
+		}
+
+		return results, err
+	}, func() ([]routetable.AssignResult, error) {
+		bases := t.bases(ctx, keys)
+		results, err := t.local.BatchAssign(ctx, mode, keys, expects, vals, ttl)
+		if err == nil {
+			for i, r := range results {
+				if r.Err == nil && r.Assigned {
+					t.written(keys[i], bases[i])
+				}
+			}
+		}
+
+		return results, err
+	})
+}
+
+// BatchExpireIfSame sets the expiration of the keys whose current values match.
+func (t *RouteTable) BatchExpireIfSame(ctx context.Context, keys, values []string, expiration time.Duration) ([]error, error) {
+	return run(t, ctx, "batch_expire_same", func() ([]error, error) {
+		errs, err := t.primary.BatchExpireIfSame(ctx, keys, values, expiration)
+		if err == nil {
+			for i, e := range errs {
+				val := values[i]
+				if expiration <= 0 {
+					val = ""
+				}
+
+				t.mirrorWrite(ctx, keys[i], val, expiration, e)
+			}
+		}
+
+		return errs, err
+	}, func() ([]error, error) {
+		bases := t.bases(ctx, keys)
+		errs, err := t.local.BatchExpireIfSame(ctx, keys, values, expiration)
+		if err == nil {
+			for i, e := range errs {
+				if e == nil {
+					t.expired(keys[i], values[i], expiration, bases[i])
+				}
+			}
+		}
+
+		return errs, err
+	})
+}
+
+// BatchDelIfSame deletes the keys whose current values match.
+func (t *RouteTable) BatchDelIfSame(ctx context.Context, keys, values []string) ([]error, error) {
+	return run(t, ctx, "batch_del_same", func() ([]error, error) {
+		errs, err := t.primary.BatchDelIfSame(ctx, keys, values)
+		if err == nil {
+			for i, e := range errs {
+				t.mirrorWrite(ctx, keys[i], "", 0, e)
+			}
+		}
+
+		return errs, err
+	}, func() ([]error, error) {
+		bases := t.bases(ctx, keys)
+		errs, err := t.local.BatchDelIfSame(ctx, keys, values)
+		if err == nil {
+			for i, e := range errs {
+				if e == nil {
+					t.deleted(keys[i], values[i], bases[i])
+				}
+			}
+		}
+
+		return errs, err
+	})
+}
+
+// bases returns the base of every key, see base. It must be called with mu held, before keys are written.
+func (t *RouteTable) bases(ctx context.Context, keys []string) []string {
+	bases, err := t.local.BatchGet(ctx, keys)
+	if err != nil {
+		bases = make([]string, len(keys))
+	}
+
+	for i, key := range keys {
+		if p, ok := t.pending[key]; ok {
+			bases[i] = p.base
+		}
+	}
+
+	return bases
+}
+
+// batchWritten records the keys written to the local tier by a batch over their bases. It must be called with mu held.
+func (t *RouteTable) batchWritten(keys, bases []string, errs []error, err error) {
+	if err != nil {
+		return
+	}
+
+	for i, e := range errs {
+		if e == nil {
+			t.written(keys[i], bases[i])
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package tiered
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/go-pantheon/fabrica-kit/router/routetable/tiered"
+
+// metrics holds the metrics of a tiered route table.
+type metrics struct {
+	fallbacks    metric.Int64Counter
+	reconciles   metric.Int64Counter
+	registration metric.Registration
+}
+
+func newMetrics(t *RouteTable, mp metric.MeterProvider) (*metrics, error) {
+	meter := mp.Meter(meterName)
+
+	degraded, err := meter.Int64ObservableGauge(
+		"routetable.tiered.degraded",
+		metric.WithDescription("Whether the route table is serving from the local tier"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	pendingKeys, err := meter.Int64ObservableGauge(
+		"routetable.tiered.pending",
+		metric.WithDescription("Number of keys written while degraded that are not reconciled yet"),
+		metric.WithUnit("keys"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	fallbacks, err := meter.Int64Counter(
+		"routetable.tiered.fallbacks",
+		metric.WithDescription("Number of operations served by the local tier"),
+		metric.WithUnit("operations"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	reconciles, err := meter.Int64Counter(
+		"routetable.tiered.reconciled",
+		metric.WithDescription("Number of keys reconciled into the primary store"),
+		metric.WithUnit("keys"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		var v int64
+		if t.degraded.Load() {
+			v = 1
+		}
+
+		t.mu.Lock()
+		n := len(t.pending)
+		t.mu.Unlock()
+
+		o.ObserveInt64(degraded, v)
+		o.ObserveInt64(pendingKeys, int64(n))
+
+		return nil
+	}, degraded, pendingKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &metrics{
+		fallbacks:    fallbacks,
+		reconciles:   reconciles,
+		registration: reg,
+	}, nil
+}
+
+func (m *metrics) fallback(ctx context.Context, op string) {
+	m.fallbacks.Add(ctx, 1, metric.WithAttributes(attribute.String("operation", op)))
+}
+
+func (m *metrics) reconciled(ctx context.Context, result string) {
+	m.reconciles.Add(ctx, 1, metric.WithAttributes(attribute.String("result", result)))
+}
+
+func (m *metrics) close() error {
+	return m.registration.Unregister()
+}
@@ -0,0 +1,194 @@
+package tiered
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+)
+
+// probeKey is read to check the primary. It does not have to exist.
+const probeKey = "routetable:tiered:probe"
+
+// The results of the reconciliation of a key, which are the result attribute of the reconciled metric.
+const (
+	resultWritten  = "written"
+	resultDeleted  = "deleted"
+	resultConflict = "conflict"
+	resultSkipped  = "skipped"
+)
+
+func (t *RouteTable) probeLoop() {
+	ticker := time.NewTicker(t.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.closed:
+			return
+		case <-ticker.C:
+			if !t.degraded.Load() {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), t.probeInterval)
+
+			if err := t.Recover(ctx); err != nil {
+				log.Warnf("tiered route table is still degraded. err=%+v", err)
+			}
+
+			cancel()
+		}
+	}
+}
+
+// Recover probes the primary and, if it responds, reconciles the keys written while degraded and
+// leaves the degraded state. It is called periodically by the prober and does nothing if the route table is not degraded.
+//
+// A key written to the local tier is swapped on the primary if the primary still holds the local value
+// the key had before it was first written while degraded, or set if it does not exist there, so a takeover
+// of a key served by the local tier survives the recovery. If the primary holds another value, which has been
+// assigned by another node meanwhile, the primary wins and the local tier is overwritten. The local value is
+// the one last read or written through the route table, so a key that was not in the local tier when
+// the primary failed is only set if it does not exist there.
+// A key deleted from the local tier is deleted from the primary if it still holds the deleted value.
+func (t *RouteTable) Recover(ctx context.Context) error {
+	if !t.degraded.Load() {
+		return nil
+	}
+
+	if _, err := t.primary.Get(ctx, probeKey); err != nil && !errors.Is(err, xerrors.ErrRouteTableNotFound) {
+		return errors.WithMessage(err, "probe primary route table failed")
+	}
+
+	for {
+		t.mu.Lock()
+
+		if len(t.pending) == 0 {
+			t.degraded.Store(false)
+			t.mu.Unlock()
+
+			log.Infof("tiered route table primary recovered")
+
+			return nil
+		}
+
+		batch := t.pending
+		t.pending = make(map[string]pending)
+		t.mu.Unlock()
+
+		if err := t.reconcile(ctx, batch); err != nil {
+			return err
+		}
+	}
+}
+
+// reconcile writes the pending keys back to the primary. On failure, the keys that have not been
+// reconciled are pending again unless they have been written since.
+func (t *RouteTable) reconcile(ctx context.Context, batch map[string]pending) error {
+	keys := slices.Sorted(maps.Keys(batch))
+
+	for i, key := range keys {
+		result, err := t.reconcileKey(ctx, key, batch[key])
+		if err != nil {
+			t.mu.Lock()
+
+			for _, k := range keys[i:] {
+				// the primary has not been written since the batch was taken, so it is still expected to hold the base
+				if p, ok := t.pending[k]; ok {
+					p.base = batch[k].base
+					t.pending[k] = p
+				} else {
+					t.pending[k] = batch[k]
+				}
+			}
+
+			t.mu.Unlock()
+
+			return errors.WithMessagef(err, "reconcile route table failed. key=%s", key)
+		}
+
+		t.metrics.reconciled(ctx, result)
+	}
+
+	return nil
+}
+
+func (t *RouteTable) reconcileKey(ctx context.Context, key string, p pending) (string, error) {
+	if p.deleted {
+		var err error
+
+		if p.expect == "" {
+			err = t.primary.Del(ctx, key)
+		} else {
+			err = t.primary.DelIfSame(ctx, key, p.expect)
+		}
+
+		switch {
+		case err == nil:
+			return resultDeleted, nil
+		case errors.Is(err, xerrors.ErrRouteTableNotFound) || errors.Is(err, xerrors.ErrRouteTableValueNotSame):
+			return resultSkipped, nil
+		default:
+			return "", err
+		}
+	}
+
+	vals, ttls, err := t.local.BatchGetWithTTL(ctx, []string{key})
+	if err != nil {
+		return "", err
+	}
+
+	val, ttl := vals[0], ttls[0]
+	if val == "" {
+		// expired locally before the primary recovered
+		return resultSkipped, nil
+	}
+
+	if p.base != "" && p.base != val {
+		err := t.primary.CompareAndSwap(ctx, key, p.base, val, ttl)
+		if err == nil {
+			return resultWritten, nil
+		}
+
+		// the primary has been changed meanwhile, or has lost the key
+		if !errors.Is(err, xerrors.ErrRouteTableNotFound) && !errors.Is(err, xerrors.ErrRouteTableValueNotSame) {
+			return "", err
+		}
+	}
+
+	set, cur, err := t.primary.SetNxOrGet(ctx, key, val, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	if set {
+		return resultWritten, nil
+	}
+
+	if cur == val {
+		// renewed while degraded
+		if ttl > 0 {
+			if err := t.primary.ExpireIfSame(ctx, key, val, ttl); err != nil && !errors.Is(err, xerrors.ErrRouteTableNotFound) &&
+				!errors.Is(err, xerrors.ErrRouteTableValueNotSame) {
+				return "", err
+			}
+		}
+
+		return resultWritten, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// a key written again since is reconciled by the next round
+	if _, ok := t.pending[key]; !ok {
+		_ = t.local.Set(ctx, key, cur, t.localTTL)
+	}
+
+	return resultConflict, nil
+}
@@ -0,0 +1,570 @@
+// Package tiered provides a route table data store that keeps a local copy of a primary store,
+// so that routing keeps working from the local tier while the primary is unreachable.
+package tiered
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"github.com/go-pantheon/fabrica-util/xsync"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	defaultProbeInterval = time.Second
+	defaultLocalTTL      = 10 * time.Minute
+)
+
+var _ routetable.Data = (*RouteTable)(nil)
+
+// ErrDegraded is returned by HealthCheck while the primary store is failing.
+var ErrDegraded = errors.New("route table degraded")
+
+// Option is a function type that configures a RouteTable instance.
+type Option func(*RouteTable)
+
+// WithProbeInterval returns an Option that sets how often a degraded route table probes the primary store.
+// dur must be greater than 0, otherwise the default interval will be used.
+func WithProbeInterval(dur time.Duration) Option {
+	return func(t *RouteTable) {
+		if dur <= 0 {
+			dur = defaultProbeInterval
+		}
+
+		t.probeInterval = dur
+	}
+}
+
+// WithLocalTTL returns an Option that sets how long the values read from the primary store are kept
+// in the local tier. It bounds the staleness of the entries served while the route table is degraded.
+// dur must be greater than 0, otherwise the default ttl will be used.
+func WithLocalTTL(dur time.Duration) Option {
+	return func(t *RouteTable) {
+		if dur <= 0 {
+			dur = defaultLocalTTL
+		}
+
+		t.localTTL = dur
+	}
+}
+
+// WithMeterProvider returns an Option that sets the provider of the metrics of the route table.
+// The global provider is used by default.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(t *RouteTable) {
+		if mp != nil {
+			t.meterProvider = mp
+		}
+	}
+}
+
+// pending is a write served by the local tier while degraded, which is reconciled into the primary.
+type pending struct {
+	// deleted is set if the key has been deleted, otherwise the current local value is written back.
+	deleted bool
+	// expect is the value the key had when it was deleted conditionally, or empty for an unconditional delete.
+	expect string
+	// base is the local value of the key before its first write while degraded, which the primary is
+	// expected to still hold, or empty if the key did not exist in the local tier.
+	base string
+}
+
+// RouteTable implements the routetable.Data interface on a primary store and a local tier, usually a memory.RouteTable.
+//
+// Writes go to the primary and are mirrored to the local tier, and reads populate the local tier.
+// When the primary fails with an error other than a missing or different value, the route table
+// becomes degraded: every operation is served by the local tier and the written keys are recorded.
+// A background prober checks the primary and, once it responds, reconciles the recorded keys:
+// local assignments are written back unless the primary has been changed by another node meanwhile, which then wins.
+type RouteTable struct {
+	primary routetable.Data
+	local   routetable.Data
+
+	probeInterval time.Duration
+	localTTL      time.Duration
+	meterProvider metric.MeterProvider
+	metrics       *metrics
+
+	degraded atomic.Bool
+	// mu serializes the degraded operations with the transitions of the state and guards pending.
+	mu      sync.Mutex
+	pending map[string]pending
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// New creates a tiered route table data store and starts its prober.
+// Close must be called to stop the prober. It does not close the tiers.
+func New(primary, local routetable.Data, opts ...Option) (*RouteTable, error) {
+	t := &RouteTable{
+		primary:       primary,
+		local:         local,
+		probeInterval: defaultProbeInterval,
+		localTTL:      defaultLocalTTL,
+		meterProvider: otel.GetMeterProvider(),
+		pending:       make(map[string]pending),
+		closed:        make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	m, err := newMetrics(t, t.meterProvider)
+	if err != nil {
+		return nil, errors.WithMessage(err, "create tiered route table metrics failed")
+	}
+
+	t.metrics = m
+
+	xsync.Go("routetable.tiered.probe", func() error {
+		t.probeLoop()
+		return nil
+	})
+
+	return t, nil
+}
+
+// Close stops the prober and unregisters the metrics. It is safe to call Close more than once.
+func (t *RouteTable) Close() error {
+	var err error
+
+	t.closeOnce.Do(func() {
+		close(t.closed)
+
+		err = t.metrics.close()
+	})
+
+	return err
+}
+
+// Degraded reports whether the route table is serving from the local tier.
+func (t *RouteTable) Degraded() bool {
+	return t.degraded.Load()
+}
+
+// HealthCheck returns ErrDegraded while the route table is serving from the local tier.
+// It is meant for the readiness probe of the service, which keeps routing but should be taken out of rotation.
+func (t *RouteTable) HealthCheck(ctx context.Context) error {
+	if !t.degraded.Load() {
+		return nil
+	}
+
+	t.mu.Lock()
+	n := len(t.pending)
+	t.mu.Unlock()
+
+	return errors.WithMessagef(ErrDegraded, "pending=%d", n)
+}
+
+// run runs op on the primary, or local on the local tier if the route table is or becomes degraded.
+func run[T any](t *RouteTable, ctx context.Context, op string, primary, local func() (T, error)) (ret T, err error) {
+	if t.whileDegraded(ctx, op, func() { ret, err = local() }) {
+		return ret, err
+	}
+
+	ret, err = primary()
+	if !t.fail(ctx, err) {
+		return ret, err
+	}
+
+	// the primary error is returned if the route table has already recovered
+	t.whileDegraded(ctx, op, func() { ret, err = local() })
+
+	return ret, err
+}
+
+// whileDegraded runs fn with the state locked and reports whether it ran, which is if the route table is degraded.
+func (t *RouteTable) whileDegraded(ctx context.Context, op string, fn func()) bool {
+	if !t.degraded.Load() {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.degraded.Load() {
+		return false
+	}
+
+	t.metrics.fallback(ctx, op)
+	fn()
+
+	return true
+}
+
+// fail marks the route table degraded and reports true if err is a failure of the primary.
+// Missing or different values are results rather than failures, and so is the cancellation of ctx.
+func (t *RouteTable) fail(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil ||
+		errors.Is(err, xerrors.ErrRouteTableNotFound) || errors.Is(err, xerrors.ErrRouteTableValueNotSame) {
+		return false
+	}
+
+	if t.degraded.CompareAndSwap(false, true) {
+		log.Warnf("tiered route table primary failed, serving from the local tier. err=%+v", err)
+	}
+
+	return true
+}
+
+// base returns the value of key before its first write while degraded: the recorded one if key is pending,
+// otherwise its current local value. It must be called with mu held, before key is written to the local tier.
+func (t *RouteTable) base(ctx context.Context, key string) string {
+	if p, ok := t.pending[key]; ok {
+		return p.base
+	}
+
+	val, err := t.local.Get(ctx, key)
+	if err != nil {
+		return ""
+	}
+
+	return val
+}
+
+// written records that key has been written to the local tier over base. It must be called with mu held.
+func (t *RouteTable) written(key, base string) {
+	t.pending[key] = pending{base: base}
+}
+
+// deleted records that key has been deleted from the local tier. It must be called with mu held.
+func (t *RouteTable) deleted(key, expect, base string) {
+	t.pending[key] = pending{deleted: true, expect: expect, base: base}
+}
+
+// expired records that the expiration of key has been set to expiration, which deletes it if not positive.
+// It must be called with mu held.
+func (t *RouteTable) expired(key, expect string, expiration time.Duration, base string) {
+	if expiration <= 0 {
+		t.deleted(key, expect, base)
+	} else {
+		t.written(key, base)
+	}
+}
+
+// Get loads a value from the primary and keeps a copy in the local tier.
+func (t *RouteTable) Get(ctx context.Context, key string) (string, error) {
+	return run(t, ctx, "get", func() (string, error) {
+		val, err := t.primary.Get(ctx, key)
+		t.mirrorRead(ctx, key, val, 0, err)
+
+		return val, err
+	}, func() (string, error) {
+		return t.local.Get(ctx, key)
+	})
+}
+
+// GetEx loads a value and resets its expiration time.
+func (t *RouteTable) GetEx(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return run(t, ctx, "getex", func() (string, error) {
+		val, err := t.primary.GetEx(ctx, key, ttl)
+		t.mirrorRead(ctx, key, val, ttl, err)
+
+		return val, err
+	}, func() (string, error) {
+		base := t.base(ctx, key)
+		val, err := t.local.GetEx(ctx, key, ttl)
+		if err == nil && ttl >= 0 {
+			t.written(key, base)
+		}
+
+		return val, err
+	})
+}
+
+// BatchGet loads the values of keys from the primary and keeps a copy in the local tier.
+func (t *RouteTable) BatchGet(ctx context.Context, keys []string) ([]string, error) {
+	return run(t, ctx, "batch_get", func() ([]string, error) {
+		vals, err := t.primary.BatchGet(ctx, keys)
+		if err == nil {
+			for i, val := range vals {
+				t.mirrorRead(ctx, keys[i], val, 0, nil)
+			}
+		}
+
+		return vals, err
+	}, func() ([]string, error) {
+		return t.local.BatchGet(ctx, keys)
+	})
+}
+
+// BatchGetWithTTL loads the values of keys and their remaining time to live from the primary
+// and keeps a copy in the local tier.
+func (t *RouteTable) BatchGetWithTTL(ctx context.Context, keys []string) ([]string, []time.Duration, error) {
+	type result struct {
+		vals []string
+		ttls []time.Duration
+	}
+
+	ret, err := run(t, ctx, "batch_get_ttl", func() (result, error) {
+		vals, ttls, err := t.primary.BatchGetWithTTL(ctx, keys)
+		if err == nil {
+			for i, val := range vals {
+				t.mirrorRead(ctx, keys[i], val, ttls[i], nil)
+			}
+		}
+
+		return result{vals: vals, ttls: ttls}, err
+	}, func() (result, error) {
+		vals, ttls, err := t.local.BatchGetWithTTL(ctx, keys)
+		return result{vals: vals, ttls: ttls}, err
+	})
+
+	return ret.vals, ret.ttls, err
+}
+
+// Scan iterates the keys of the primary, or of the local tier while degraded.
+// A scan that spans a change of the state may miss or repeat keys.
+func (t *RouteTable) Scan(ctx context.Context, match string, cursor uint64, count int64) ([]string, uint64, error) {
+	type result struct {
+		keys []string
+		next uint64
+	}
+
+	ret, err := run(t, ctx, "scan", func() (result, error) {
+		keys, next, err := t.primary.Scan(ctx, match, cursor, count)
+		return result{keys: keys, next: next}, err
+	}, func() (result, error) {
+		keys, next, err := t.local.Scan(ctx, match, cursor, count)
+		return result{keys: keys, next: next}, err
+	})
+
+	return ret.keys, ret.next, err
+}
+
+// Set stores a value in both tiers.
+func (t *RouteTable) Set(ctx context.Context, key, val string, ttl time.Duration) error {
+	_, err := run(t, ctx, "set", func() (struct{}, error) {
+		err := t.primary.Set(ctx, key, val, ttl)
+		if err == nil {
+			_ = t.local.Set(ctx, key, val, ttl)
+		}
+
+		return struct{}{}, err
+	}, func() (struct{}, error) {
+		base := t.base(ctx, key)
+		err := t.local.Set(ctx, key, val, ttl)
+		if err == nil {
+			t.written(key, base)
+		}
+
+		return struct{}{}, err
+	})
+
+	return err
+}
+
+// SetNxOrGet sets a value if the key does not exist, otherwise returns the current value.
+func (t *RouteTable) SetNxOrGet(ctx context.Context, key, val string, ttl time.Duration) (bool, string, error) {
+	type result struct {
+		set bool
+		cur string
+	}
+
+	ret, err := run(t, ctx, "setnx", func() (result, error) {
+		set, cur, err := t.primary.SetNxOrGet(ctx, key, val, ttl)
+		if err == nil {
+			_ = t.local.Set(ctx, key, cur, t.ttlOf(ttl))
+		}
+
+		return result{set: set, cur: cur}, err
+	}, func() (result, error) {
+		base := t.base(ctx, key)
+		set, cur, err := t.local.SetNxOrGet(ctx, key, val, ttl)
+		if err == nil && set {
+			t.written(key, base)
+		}
+
+		return result{set: set, cur: cur}, err
+	})
+
+	return ret.set, ret.cur, err
+}
+
+// GetSet sets a new value and returns the old one.
+func (t *RouteTable) GetSet(ctx context.Context, key, val string, ttl time.Duration) (string, error) {
+	return run(t, ctx, "getset", func() (string, error) {
+		old, err := t.primary.GetSet(ctx, key, val, ttl)
+		if err == nil {
+			_ = t.local.Set(ctx, key, val, ttl)
+		}
+
+		return old, err
+	}, func() (string, error) {
+		base := t.base(ctx, key)
+		old, err := t.local.GetSet(ctx, key, val, ttl)
+		if err == nil {
+			t.written(key, base)
+		}
+
+		return old, err
+	})
+}
+
+// CompareAndSwap sets key to val only if its current value is old.
+func (t *RouteTable) CompareAndSwap(ctx context.Context, key, old, val string, ttl time.Duration) error {
+	_, err := run(t, ctx, "cas", func() (struct{}, error) {
+		err := t.primary.CompareAndSwap(ctx, key, old, val, ttl)
+		t.mirrorWrite(ctx, key, val, ttl, err)
+
+		return struct{}{}, err
+	}, func() (struct{}, error) {
+		base := t.base(ctx, key)
+		err := t.local.CompareAndSwap(ctx, key, old, val, ttl)
+		if err == nil {
+			t.written(key, base)
+		}
+
+		return struct{}{}, err
+	})
+
+	return err
+}
+
+// Assign sets key to val with a new epoch if the condition of mode holds. While degraded, the epoch
+// is allocated by the local tier and the assignment is reconciled like the other writes.
+func (t *RouteTable) Assign(ctx context.Context, mode routetable.AssignMode, key, expect, val string, ttl time.Duration) (routetable.AssignResult, error) {
+	return run(t, ctx, "assign", func() (routetable.AssignResult, error) {
+		ret, err := t.primary.Assign(ctx, mode, key, expect, val, ttl)
+		t.mirrorWrite(ctx, key, ret.Value, t.ttlOf(ttl), err)
+
+		return ret, err
+	}, func() (routetable.AssignResult, error) {
+		base := t.base(ctx, key)
+		ret, err := t.local.Assign(ctx, mode, key, expect, val, ttl)
+		if err == nil && ret.Assigned {
+			t.written(key, base)
+		}
+
+		return ret, err
+	})
+}
+
+// Expire sets an expiration time for a key.
+func (t *RouteTable) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	_, err := run(t, ctx, "expire", func() (struct{}, error) {
+		err := t.primary.Expire(ctx, key, expiration)
+		if err == nil {
+			_ = t.local.Expire(ctx, key, expiration)
+		}
+
+		return struct{}{}, err
+	}, func() (struct{}, error) {
+		base := t.base(ctx, key)
+		err := t.local.Expire(ctx, key, expiration)
+		if err == nil {
+			t.expired(key, "", expiration, base)
+		}
+
+		return struct{}{}, err
+	})
+
+	return err
+}
+
+// ExpireIfSame sets an expiration time for a key only if its current value matches value.
+func (t *RouteTable) ExpireIfSame(ctx context.Context, key, value string, expiration time.Duration) error {
+	_, err := run(t, ctx, "expire_same", func() (struct{}, error) {
+		err := t.primary.ExpireIfSame(ctx, key, value, expiration)
+		if expiration <= 0 {
+			value = ""
+		}
+
+		t.mirrorWrite(ctx, key, value, expiration, err)
+
+		return struct{}{}, err
+	}, func() (struct{}, error) {
+		base := t.base(ctx, key)
+		err := t.local.ExpireIfSame(ctx, key, value, expiration)
+		if err == nil {
+			t.expired(key, value, expiration, base)
+		}
+
+		return struct{}{}, err
+	})
+
+	return err
+}
+
+// Del deletes a key from both tiers.
+func (t *RouteTable) Del(ctx context.Context, key string) error {
+	_, err := run(t, ctx, "del", func() (struct{}, error) {
+		err := t.primary.Del(ctx, key)
+		if err == nil {
+			_ = t.local.Del(ctx, key)
+		}
+
+		return struct{}{}, err
+	}, func() (struct{}, error) {
+		base := t.base(ctx, key)
+		err := t.local.Del(ctx, key)
+		if err == nil {
+			t.deleted(key, "", base)
+		}
+
+		return struct{}{}, err
+	})
+
+	return err
+}
+
+// DelIfSame deletes a key only if its current value matches value.
+func (t *RouteTable) DelIfSame(ctx context.Context, key, value string) error {
+	_, err := run(t, ctx, "del_same", func() (struct{}, error) {
+		err := t.primary.DelIfSame(ctx, key, value)
+		t.mirrorWrite(ctx, key, "", 0, err)
+
+		return struct{}{}, err
+	}, func() (struct{}, error) {
+		base := t.base(ctx, key)
+		err := t.local.DelIfSame(ctx, key, value)
+		if err == nil {
+			t.deleted(key, value, base)
+		}
+
+		return struct{}{}, err
+	})
+
+	return err
+}
+
+// ttlOf is the local ttl of a value written to the primary with ttl, which may not expire.
+func (t *RouteTable) ttlOf(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return t.localTTL
+	}
+
+	return ttl
+}
+
+// mirrorRead updates the local copy of key with the result of a read from the primary.
+// ttl is the remaining time to live of val if known.
+func (t *RouteTable) mirrorRead(ctx context.Context, key, val string, ttl time.Duration, err error) {
+	switch {
+	case err == nil && val != "":
+		_ = t.local.Set(ctx, key, val, t.ttlOf(ttl))
+	case err == nil || errors.Is(err, xerrors.ErrRouteTableNotFound):
+		_ = t.local.Del(ctx, key)
+	}
+}
+
+// mirrorWrite updates the local copy of key with the result of a conditional write to the primary,
+// which leaves key with val, or deleted if val is empty.
+// A failed condition means the local copy is stale, so it is dropped.
+func (t *RouteTable) mirrorWrite(ctx context.Context, key, val string, ttl time.Duration, err error) {
+	switch {
+	case err == nil && val != "":
+		_ = t.local.Set(ctx, key, val, ttl)
+	case err == nil || errors.Is(err, xerrors.ErrRouteTableNotFound) || errors.Is(err, xerrors.ErrRouteTableValueNotSame):
+		_ = t.local.Del(ctx, key)
+	}
+}
@@ -0,0 +1,237 @@
+package tiered
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pantheon/fabrica-kit/router/routetable"
+	"github.com/go-pantheon/fabrica-kit/router/routetable/memory"
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnavailable = errors.New("primary unavailable")
+
+// flakyData is a memory route table that fails the operations used by the tests while it is down.
+type flakyData struct {
+	*memory.RouteTable
+
+	down atomic.Bool
+}
+
+func (d *flakyData) Get(ctx context.Context, key string) (string, error) {
+	if d.down.Load() {
+		return "", errUnavailable
+	}
+
+	return d.RouteTable.Get(ctx, key)
+}
+
+func (d *flakyData) BatchGet(ctx context.Context, keys []string) ([]string, error) {
+	if d.down.Load() {
+		return nil, errUnavailable
+	}
+
+	return d.RouteTable.BatchGet(ctx, keys)
+}
+
+func (d *flakyData) Set(ctx context.Context, key, val string, ttl time.Duration) error {
+	if d.down.Load() {
+		return errUnavailable
+	}
+
+	return d.RouteTable.Set(ctx, key, val, ttl)
+}
+
+func (d *flakyData) SetNxOrGet(ctx context.Context, key, val string, ttl time.Duration) (bool, string, error) {
+	if d.down.Load() {
+		return false, "", errUnavailable
+	}
+
+	return d.RouteTable.SetNxOrGet(ctx, key, val, ttl)
+}
+
+func (d *flakyData) CompareAndSwap(ctx context.Context, key, old, val string, ttl time.Duration) error {
+	if d.down.Load() {
+		return errUnavailable
+	}
+
+	return d.RouteTable.CompareAndSwap(ctx, key, old, val, ttl)
+}
+
+func (d *flakyData) DelIfSame(ctx context.Context, key, val string) error {
+	if d.down.Load() {
+		return errUnavailable
+	}
+
+	return d.RouteTable.DelIfSame(ctx, key, val)
+}
+
+func newTestRouteTable(t *testing.T) (*RouteTable, *flakyData, *memory.RouteTable) {
+	t.Helper()
+
+	primary := &flakyData{RouteTable: memory.New()}
+	local := memory.New()
+
+	rt, err := New(primary, local, WithProbeInterval(time.Hour))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = rt.Close()
+		_ = primary.Close()
+		_ = local.Close()
+	})
+
+	return rt, primary, local
+}
+
+func TestRouteTableWriteThrough(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, primary, local := newTestRouteTable(t)
+
+	require.NoError(t, rt.Set(ctx, "k1", "a", time.Minute))
+
+	for _, d := range []routetable.Data{primary, local} {
+		val, err := d.Get(ctx, "k1")
+		require.NoError(t, err)
+		assert.Equal(t, "a", val)
+	}
+
+	// reads keep a local copy
+	require.NoError(t, primary.RouteTable.Set(ctx, "k2", "b", 0))
+
+	vals, err := rt.BatchGet(ctx, []string{"k1", "k2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, vals)
+
+	val, err := local.Get(ctx, "k2")
+	require.NoError(t, err)
+	assert.Equal(t, "b", val)
+
+	// a failed condition drops the stale local copy
+	require.NoError(t, primary.RouteTable.Set(ctx, "k1", "c", time.Minute))
+	require.ErrorIs(t, rt.DelIfSame(ctx, "k1", "a"), xerrors.ErrRouteTableValueNotSame)
+
+	_, err = local.Get(ctx, "k1")
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+	assert.False(t, rt.Degraded())
+}
+
+func TestRouteTableDegraded(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, primary, _ := newTestRouteTable(t)
+
+	require.NoError(t, rt.Set(ctx, "k1", "a", time.Minute))
+	require.NoError(t, rt.HealthCheck(ctx))
+
+	primary.down.Store(true)
+
+	val, err := rt.Get(ctx, "k1")
+	require.NoError(t, err)
+	assert.Equal(t, "a", val)
+	assert.True(t, rt.Degraded())
+
+	set, cur, err := rt.SetNxOrGet(ctx, "k2", "b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, set)
+	assert.Equal(t, "b", cur)
+
+	err = rt.HealthCheck(ctx)
+	require.ErrorIs(t, err, ErrDegraded)
+	assert.Contains(t, err.Error(), "pending=1")
+
+	// the primary is still down
+	require.ErrorIs(t, rt.Recover(ctx), errUnavailable)
+	assert.True(t, rt.Degraded())
+
+	primary.down.Store(false)
+
+	require.NoError(t, rt.Recover(ctx))
+	assert.False(t, rt.Degraded())
+	require.NoError(t, rt.HealthCheck(ctx))
+
+	val, err = primary.Get(ctx, "k2")
+	require.NoError(t, err)
+	assert.Equal(t, "b", val)
+}
+
+func TestRouteTableReconcile(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, primary, local := newTestRouteTable(t)
+
+	require.NoError(t, rt.Set(ctx, "owned", "a", time.Minute))
+	require.NoError(t, rt.Set(ctx, "released", "a", time.Minute))
+
+	primary.down.Store(true)
+
+	_, _, err := rt.SetNxOrGet(ctx, "contested", "a", time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, rt.ExpireIfSame(ctx, "owned", "a", time.Hour))
+	require.NoError(t, rt.DelIfSame(ctx, "released", "a"))
+
+	// another node assigns the contested key meanwhile
+	require.NoError(t, primary.RouteTable.Set(ctx, "contested", "b", time.Minute))
+
+	primary.down.Store(false)
+	require.NoError(t, rt.Recover(ctx))
+
+	// the primary wins a conflict
+	for _, d := range []routetable.Data{primary, local} {
+		val, err := d.Get(ctx, "contested")
+		require.NoError(t, err)
+		assert.Equal(t, "b", val)
+	}
+
+	// the renewal is written back
+	_, ttls, err := primary.BatchGetWithTTL(ctx, []string{"owned"})
+	require.NoError(t, err)
+	assert.Greater(t, ttls[0], time.Minute)
+
+	_, err = primary.Get(ctx, "released")
+	require.ErrorIs(t, err, xerrors.ErrRouteTableNotFound)
+}
+
+func TestRouteTableReconcileTakeover(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	rt, primary, local := newTestRouteTable(t)
+
+	require.NoError(t, rt.Set(ctx, "taken", "a", time.Minute))
+	require.NoError(t, rt.Set(ctx, "contested", "a", time.Minute))
+
+	primary.down.Store(true)
+
+	// the keys are taken over from the local tier
+	require.NoError(t, rt.CompareAndSwap(ctx, "taken", "a", "b", time.Minute))
+	require.NoError(t, rt.CompareAndSwap(ctx, "contested", "a", "b", time.Minute))
+	require.NoError(t, rt.CompareAndSwap(ctx, "contested", "b", "c", time.Minute))
+
+	// another node assigns the contested key meanwhile
+	require.NoError(t, primary.RouteTable.Set(ctx, "contested", "d", time.Minute))
+
+	primary.down.Store(false)
+	require.NoError(t, rt.Recover(ctx))
+
+	for _, d := range []routetable.Data{primary, local} {
+		// the takeover survives the recovery
+		val, err := d.Get(ctx, "taken")
+		require.NoError(t, err)
+		assert.Equal(t, "b", val)
+
+		// the primary wins a conflict
+		val, err = d.Get(ctx, "contested")
+		require.NoError(t, err)
+		assert.Equal(t, "d", val)
+	}
+}
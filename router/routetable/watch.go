@@ -0,0 +1,191 @@
+package routetable
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"github.com/go-pantheon/fabrica-util/xsync"
+)
+
+// ErrWatchNotSupported is returned by Watch and WatchAll when the data store is not a Watcher.
+var ErrWatchNotSupported = errors.New("route table watch not supported")
+
+// watchBufferSize is the capacity of the event channels returned by Watch and WatchAll.
+const watchBufferSize = 256
+
+// EventReason is the reason of a routing entry change.
+type EventReason string
+
+const (
+	// EventSet means the entry has been assigned to a new address.
+	EventSet EventReason = "set"
+	// EventExpired means the entry has expired.
+	EventExpired EventReason = "expired"
+	// EventDeleted means the entry has been deleted.
+	EventDeleted EventReason = "deleted"
+)
+
+// Event is a change of the routing entry of (Color, OID).
+// OldAddr is empty if the entry did not exist or its previous value is unknown to the watcher.
+// NewAddr is empty if the entry has expired or been deleted.
+type Event struct {
+	Color   string
+	OID     int64
+	OldAddr string
+	NewAddr string
+	// NewEpoch is the epoch of the new owner, or 0 if NewAddr is empty.
+	NewEpoch uint64
+	Reason   EventReason
+}
+
+// DataEvent is a change of a key in a data store.
+type DataEvent struct {
+	Key    string
+	Old    string
+	New    string
+	Reason EventReason
+}
+
+// Watcher is implemented by data stores that can stream the changes of their keys.
+type Watcher interface {
+	// Watch streams the changes of the keys matching the glob pattern until ctx is done.
+	// The returned channel is closed when the watch stops.
+	Watch(ctx context.Context, pattern string) (<-chan DataEvent, error)
+}
+
+// Watch streams the changes of the routing entry of (color, oid) until ctx is done.
+func (r *readOnlyRouteTable) Watch(ctx context.Context, color string, oid int64) (<-chan Event, error) {
+	return r.watch(ctx, EscapePattern(r.BuildKey(color, oid)))
+}
+
+// WatchAll streams the changes of every routing entry of color until ctx is done.
+func (r *readOnlyRouteTable) WatchAll(ctx context.Context, color string) (<-chan Event, error) {
+	return r.watch(ctx, r.codec.Pattern(r.name, color))
+}
+
+func (r *readOnlyRouteTable) watch(ctx context.Context, pattern string) (<-chan Event, error) {
+	w, ok := r.data.(Watcher)
+	if !ok {
+		return nil, errors.WithMessagef(ErrWatchNotSupported, "name=%s", r.name)
+	}
+
+	in, err := w.Watch(ctx, pattern)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "watch route table failed. pattern=%s", pattern)
+	}
+
+	out := make(chan Event, watchBufferSize)
+
+	xsync.Go("routetable.watch", func() error {
+		defer close(out)
+
+		for de := range in {
+			name, color, oid, err := r.codec.Decode(de.Key)
+			if err != nil || name != r.name {
+				continue
+			}
+
+			old, oerr := decodeEntry(de.Key, de.Old)
+			cur, nerr := decodeEntry(de.Key, de.New)
+
+			if oerr != nil || nerr != nil {
+				log.Warnf("decode route table event failed. key=%s err=%+v", de.Key, errors.Join(oerr, nerr))
+				continue
+			}
+
+			ev := Event{
+				Color:    color,
+				OID:      oid,
+				OldAddr:  old.Addr,
+				NewAddr:  cur.Addr,
+				NewEpoch: cur.Epoch,
+				Reason:   de.Reason,
+			}
+
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		return nil
+	})
+
+	return out, nil
+}
+
+// EscapePattern escapes the glob metacharacters of s, so that the pattern matches s literally.
+func EscapePattern(s string) string {
+	if !strings.ContainsAny(s, `*?[]\`) {
+		return s
+	}
+
+	var b strings.Builder
+
+	b.Grow(len(s) + 4)
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// MatchPattern reports whether key matches the glob pattern with the syntax of Redis KEYS,
+// limited to '*', '?' and backslash escapes, which are all that patterns of this package use.
+func MatchPattern(pattern, key string) bool {
+	var (
+		p, k         int
+		starP, starK = -1, 0
+	)
+
+	for k < len(key) {
+		if p < len(pattern) {
+			switch c := pattern[p]; {
+			case c == '*':
+				starP, starK = p, k
+				p++
+
+				continue
+			case c == '?':
+				p++
+				k++
+
+				continue
+			case c == '\\' && p+1 < len(pattern):
+				if pattern[p+1] == key[k] {
+					p += 2
+					k++
+
+					continue
+				}
+			case c == key[k]:
+				p++
+				k++
+
+				continue
+			}
+		}
+
+		if starP < 0 {
+			return false
+		}
+
+		starK++
+		p, k = starP+1, starK
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
@@ -0,0 +1,58 @@
+package routetable
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPattern(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{pattern: "abc", key: "abc", match: true},
+		{pattern: "abc", key: "abd", match: false},
+		{pattern: "a*", key: "a", match: true},
+		{pattern: "a*c", key: "abbbc", match: true},
+		{pattern: "a*c", key: "abbbd", match: false},
+		{pattern: "a?c", key: "abc", match: true},
+		{pattern: "a?c", key: "ac", match: false},
+		{pattern: `a\*c`, key: "a*c", match: true},
+		{pattern: `a\*c`, key: "abc", match: false},
+		{pattern: "*", key: "", match: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.key, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.match, MatchPattern(tt.pattern, tt.key))
+		})
+	}
+}
+
+func TestEscapePattern(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []string{"plain", "a*b?c", `[x]\y`, "r_p_{c}_{1}"} {
+		assert.True(t, MatchPattern(EscapePattern(s), s), s)
+		assert.False(t, MatchPattern(EscapePattern(s), s+"x"), s)
+	}
+}
+
+func TestKeyCodecPattern(t *testing.T) {
+	t.Parallel()
+
+	for _, codec := range []KeyCodec{V1KeyCodec, LegacyKeyCodec, LegacyClusterKeyCodec} {
+		pattern := codec.Pattern("player*", "blue")
+
+		assert.True(t, MatchPattern(pattern, codec.Encode("player*", "blue", 42)), pattern)
+		assert.True(t, MatchPattern(pattern, codec.Encode("player*", "blue", -1)), pattern)
+		assert.False(t, MatchPattern(pattern, codec.Encode("player*", "red", 42)), pattern)
+		assert.False(t, MatchPattern(pattern, codec.Encode("playerx", "blue", 42)), pattern)
+	}
+}
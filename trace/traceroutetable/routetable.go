@@ -0,0 +1,74 @@
+// Package traceroutetable provides OpenTelemetry spans of route table operations.
+package traceroutetable
+
+import (
+	"context"
+
+	"github.com/go-pantheon/fabrica-kit/xerrors"
+	"github.com/go-pantheon/fabrica-util/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys of the route table spans.
+const (
+	NameKey      = attribute.Key("routetable.name")
+	OperationKey = attribute.Key("routetable.operation")
+	ColorKey     = attribute.Key("routetable.color")
+	OIDKey       = attribute.Key("routetable.oid")
+	KeyKey       = attribute.Key("routetable.key")
+	CountKey     = attribute.Key("routetable.count")
+	ResultKey    = attribute.Key("routetable.result")
+)
+
+// TracingConfig holds configuration for route table tracing
+type TracingConfig struct {
+	TracerProvider trace.TracerProvider
+	TracerName     string
+}
+
+// DefaultTracingConfig returns default tracing configuration
+func DefaultTracingConfig() *TracingConfig {
+	return &TracingConfig{
+		TracerProvider: otel.GetTracerProvider(),
+		TracerName:     "routetable",
+	}
+}
+
+// Tracer returns the tracer of config
+func Tracer(config *TracingConfig) trace.Tracer {
+	if config == nil {
+		config = DefaultTracingConfig()
+	}
+
+	return config.TracerProvider.Tracer(config.TracerName)
+}
+
+// StartSpan creates a span for an operation of the route table name
+func StartSpan(ctx context.Context, tracer trace.Tracer, name, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, "routetable."+op, trace.WithSpanKind(trace.SpanKindClient))
+
+	span.SetAttributes(NameKey.String(name), OperationKey.String(op))
+	span.SetAttributes(attrs...)
+
+	return ctx, span
+}
+
+// EndSpan records err on span and ends it. A missing or changed routing entry is a result
+// of the operation rather than a failure, so it does not set the error status.
+func EndSpan(span trace.Span, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, xerrors.ErrRouteTableNotFound):
+		span.SetAttributes(ResultKey.String("not_found"))
+	case errors.Is(err, xerrors.ErrRouteTableValueNotSame):
+		span.SetAttributes(ResultKey.String("not_same"))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}